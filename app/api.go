@@ -19,19 +19,34 @@ package app
 import (
 	"bytes"
 	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
 	"strconv"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"github.com/golang/protobuf/ptypes"
 	"github.com/google/trillian"
 	"github.com/google/trillian/crypto/keyspb"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/index"
 	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/models"
 	"github.com/projectrekor/rekor-server/types"
+	"github.com/projectrekor/rekor-server/webhook"
 	"github.com/spf13/viper"
 	"google.golang.org/grpc/codes"
 )
@@ -40,43 +55,19 @@ type API struct {
 	tLogID    int64
 	logClient trillian.TrillianLogClient
 	pubkey    *keyspb.PublicKey
-}
-
-type addResponse struct {
-	Status RespStatusCode
-}
-
-type getResponse struct {
-	Status       RespStatusCode
-	FileRecieved FileRecieved
-	Leaves       []*trillian.LogLeaf
-}
-
-type getLatestResponse struct {
-	Status RespStatusCode
-	Proof  *trillian.GetLatestSignedLogRootResponse
-	Key    []byte
-}
-
-type getProofResponse struct {
-	Status       string
-	FileRecieved FileRecieved
-	Proof        *trillian.GetInclusionProofByHashResponse
-	Key          []byte
-}
-
-type getLeafResponse struct {
-	Status RespStatusCode
-	Leaf   *trillian.GetLeavesByIndexResponse
-	Key    []byte
-}
-
-type RespStatusCode struct {
-	Code string `json:"file_recieved"`
-}
-
-type FileRecieved struct {
-	File string `json:"file_recieved"`
+	signer    crypto.Signer
+	hostname  string
+	index     index.Index
+	// roots holds the log roots verified so far, shared by every request
+	roots *rootHistory
+	// webhooks is nil unless webhooks are configured
+	webhooks *webhook.Dispatcher
+	// feed pushes new entries to streaming clients
+	feed *entryFeed
+
+	// stop cancels the background goroutines started by start, and background waits for them to return
+	stop       context.CancelFunc
+	background sync.WaitGroup
 }
 
 func NewAPI() (*API, error) {
@@ -107,11 +98,93 @@ func NewAPI() (*API, error) {
 		return nil, err
 	}
 
-	return &API{
+	signer, err := newSigner()
+	if err != nil {
+		return nil, err
+	}
+
+	idx, err := index.New(viper.GetString("index.backend"), viper.GetString("index.path"))
+	if err != nil {
+		return nil, err
+	}
+
+	roots, err := openRootHistory(viper.GetString("rekor_server.root_history_path"), tLogID)
+	if err != nil {
+		idx.Close()
+		return nil, err
+	}
+
+	webhooks, err := newDispatcher()
+	if err != nil {
+		roots.Close()
+		idx.Close()
+		return nil, err
+	}
+
+	api := &API{
 		tLogID:    tLogID,
 		logClient: logClient,
 		pubkey:    t.PublicKey,
-	}, nil
+		signer:    signer,
+		hostname:  viper.GetString("rekor_server.hostname"),
+		index:     idx,
+		roots:     roots,
+		webhooks:  webhooks,
+	}
+	api.feed = newEntryFeed(api.logServer(), streamPollInterval())
+	api.start()
+	return api, nil
+}
+
+// start runs the background work of the API until it is closed
+func (api *API) start() {
+	ctx, stop := context.WithCancel(context.Background())
+	api.stop = stop
+	if api.webhooks != nil {
+		api.background.Add(2)
+		go func() {
+			defer api.background.Done()
+			api.webhooks.Run(ctx)
+		}()
+		go func() {
+			defer api.background.Done()
+			api.watchIntegration(ctx, webhookPollInterval())
+		}()
+	}
+}
+
+// Close stops the background work of the API and releases the resources it holds, once the server
+// has stopped serving requests
+func (api *API) Close() error {
+	if api.feed != nil {
+		api.feed.Close()
+	}
+	if api.stop != nil {
+		api.stop()
+	}
+	api.background.Wait()
+
+	var err error
+	if api.webhooks != nil {
+		err = api.webhooks.Close()
+	}
+	if indexErr := api.index.Close(); err == nil {
+		err = indexErr
+	}
+	if rootsErr := api.roots.Close(); err == nil {
+		err = rootsErr
+	}
+	return err
+}
+
+// logServer returns a client for the log's tree that verifies the log roots Trillian returns
+func (api *API) logServer() *trillianclient {
+	return &trillianclient{
+		client: api.logClient,
+		logID:  api.tLogID,
+		pubkey: api.pubkey,
+		roots:  api.roots,
+	}
 }
 
 type apiHandler func(r *http.Request) (interface{}, error)
@@ -126,11 +199,12 @@ func wrap(h apiHandler) http.HandlerFunc {
 
 		respObj, err := h(r)
 		if err != nil {
-			writeError(w, err)
+			writeError(w, r, err)
+			return
 		}
 		b, err := json.Marshal(respObj)
 		if err != nil {
-			writeError(w, err)
+			writeError(w, r, err)
 			return
 		}
 		w.Header().Set("Content-Type", "application/json")
@@ -142,19 +216,39 @@ func (api *API) ping(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprintf(w, "pong!")
 }
 
-func (api *API) getHandler(r *http.Request) (interface{}, error) {
+// getOpenAPIHandler serves the OpenAPI document describing this API
+func getOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprint(w, models.OpenAPI)
+}
+
+// entryBody returns the JSON encoded entry submitted with r, either as the request body or as the
+// "fileupload" field of a multipart form, along with the name of the uploaded file if there was one
+func entryBody(r *http.Request) (io.ReadCloser, string, error) {
+	if mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err == nil && mediaType == "application/json" {
+		return r.Body, "", nil
+	}
+
 	file, header, err := r.FormFile("fileupload")
+	if err != nil {
+		return nil, "", badRequest(err)
+	}
+	return file, header.Filename, nil
+}
+
+func (api *API) getHandler(r *http.Request) (interface{}, error) {
+	file, filename, err := entryBody(r)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	logging.RequestIDLogger(r).Info("Received file: ", header.Filename)
+	logging.RequestIDLogger(r).Info("Received file: ", filename)
 
 	leaf, err := types.ParseRekorLeaf(file)
 	if err != nil {
 		logging.RequestIDLogger(r).Errorf("Not a valid rekor entry: %s", err)
-		return nil, err
+		return nil, badRequest(err)
 	}
 
 	byteLeaf, err := json.Marshal(leaf)
@@ -162,7 +256,7 @@ func (api *API) getHandler(r *http.Request) (interface{}, error) {
 		return nil, err
 	}
 
-	server := serverInstance(api.logClient, api.tLogID)
+	server := api.logServer()
 	resp, err := server.getLeaf(byteLeaf, api.tLogID)
 	if err != nil {
 		return nil, err
@@ -171,21 +265,21 @@ func (api *API) getHandler(r *http.Request) (interface{}, error) {
 
 	logResults := resp.getLeafResult.GetLeaves()
 
-	return getResponse{
-		Status:       RespStatusCode{Code: getGprcCode(resp.status)},
-		FileRecieved: FileRecieved{File: header.Filename},
+	return models.GetResponse{
+		Status:       models.StatusCode{Code: getGprcCode(resp.status)},
+		FileReceived: models.UploadedFile{File: filename},
 		Leaves:       logResults,
 	}, nil
 }
 
 func (api *API) getProofHandler(r *http.Request) (interface{}, error) {
-	file, header, err := r.FormFile("fileupload")
+	file, filename, err := entryBody(r)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	logging.RequestIDLogger(r).Info("Received file : ", header.Filename)
+	logging.RequestIDLogger(r).Info("Received file : ", filename)
 
 	leaf, err := types.ParseRekorLeaf(file)
 	if err != nil || leaf.SHA == "" {
@@ -193,7 +287,7 @@ func (api *API) getProofHandler(r *http.Request) (interface{}, error) {
 			err = errors.New("missing SHA sum")
 		}
 		logging.RequestIDLogger(r).Errorf("Not a valid rekor entry: %s", err)
-		return nil, err
+		return nil, badRequest(err)
 	}
 
 	byteLeaf, err := json.Marshal(leaf)
@@ -201,7 +295,7 @@ func (api *API) getProofHandler(r *http.Request) (interface{}, error) {
 		return nil, err
 	}
 
-	server := serverInstance(api.logClient, api.tLogID)
+	server := api.logServer()
 	resp, err := server.getProof(byteLeaf, api.tLogID)
 	if err != nil {
 		return nil, err
@@ -217,9 +311,9 @@ func (api *API) getProofHandler(r *http.Request) (interface{}, error) {
 
 	logging.RequestIDLogger(r).Info("Return Proof Result: ", string(proofResultsJSON))
 
-	return getProofResponse{
+	return models.GetProofResponse{
 		Status:       getGprcCode(resp.status),
-		FileRecieved: FileRecieved{File: header.Filename},
+		FileReceived: models.UploadedFile{File: filename},
 		Proof:        proofResults,
 		Key:          api.pubkey.Der,
 	}, nil
@@ -227,47 +321,46 @@ func (api *API) getProofHandler(r *http.Request) (interface{}, error) {
 }
 
 func (api *API) addHandler(r *http.Request) (interface{}, error) {
-	file, header, err := r.FormFile("fileupload")
+	file, filename, err := entryBody(r)
 	if err != nil {
 		return nil, err
 	}
 	defer file.Close()
 
-	logging.RequestIDLogger(r).Info("Received file : ", header.Filename)
+	logging.RequestIDLogger(r).Info("Received file : ", filename)
 
 	var byteEntry bytes.Buffer
 	tee := io.TeeReader(file, &byteEntry)
 
 	// See if this is a valid RekorLeaf
-	rekorLeaf, err := types.ParseRekorLeaf(tee)
+	rekorLeaf, err := types.ParseProposedLeaf(tee)
 	if err != nil {
 		logging.RequestIDLogger(r).Errorf("Not a valid rekor entry: %s", err)
-		return nil, err
+		return nil, badRequest(err)
 	}
 
 	// Check to see if the entry already exists, only if we have a full leaf
-	server := serverInstance(api.logClient, api.tLogID)
-	if rekorLeaf.SHA != "" {
-		byteLeaf, err := json.Marshal(rekorLeaf)
+	server := api.logServer()
+	var checkedLeaf []byte
+	if rekorLeaf.SHA != "" && rekorLeaf.Complete() {
+		checkedLeaf, err = json.Marshal(rekorLeaf)
 		if err != nil {
 			return nil, err
 		}
 
-		if resp, err := server.getLeaf(byteLeaf, api.tLogID); err != nil && len(resp.getLeafResult.Leaves) != 0 {
-			return addResponse{
-				Status: RespStatusCode{Code: getGprcCode(codes.AlreadyExists)},
-			}, nil
+		if err := api.checkDuplicate(server, checkedLeaf); err != nil {
+			return nil, err
 		}
 	}
 
 	rekorEntry, err := types.ParseRekorEntry(&byteEntry, rekorLeaf)
 	if err != nil {
-		return nil, err
+		return nil, badRequest(err)
 	}
 
 	// Now load/validate it before adding. This can be expensive, so we first check if the data already exists.
 	if err := rekorEntry.Load(r.Context()); err != nil {
-		return nil, err
+		return nil, loadError(err)
 	}
 
 	leafToAdd, err := json.Marshal(&(rekorEntry.RekorLeaf))
@@ -275,6 +368,13 @@ func (api *API) addHandler(r *http.Request) (interface{}, error) {
 		return nil, err
 	}
 
+	// the SHA, signature or public key are only known now if the client did not supply them
+	if !bytes.Equal(leafToAdd, checkedLeaf) {
+		if err := api.checkDuplicate(server, leafToAdd); err != nil {
+			return nil, err
+		}
+	}
+
 	resp, err := server.addLeaf(leafToAdd, api.tLogID)
 	if err != nil {
 		return nil, err
@@ -282,32 +382,112 @@ func (api *API) addHandler(r *http.Request) (interface{}, error) {
 
 	logging.RequestIDLogger(r).Infof("Server PUT Response: %s", resp.status)
 
-	return addResponse{
-		Status: RespStatusCode{Code: getGprcCode(resp.status)},
+	// an identical leaf may have been queued since the check above
+	if resp.status == codes.AlreadyExists {
+		existing := resp.queuedLeaf.GetLeaf()
+		if existing == nil {
+			existing = &trillian.LogLeaf{LeafValue: leafToAdd}
+		}
+		return nil, duplicateEntry(existing)
+	}
+
+	set, err := api.signEntryTimestamp(resp.queuedLeaf.GetLeaf())
+	if err != nil {
+		return nil, err
+	}
+
+	uuid := entryUUID(rfc6962.DefaultHasher.HashLeaf(leafToAdd))
+	// the leaf is already queued, so a failure here only affects searches and is not returned to the caller
+	if err := api.index.Insert(uuid, index.KeysForLeaf(&rekorEntry.RekorLeaf)); err != nil {
+		logging.RequestIDLogger(r).Errorf("Error indexing entry %v: %s", uuid, err)
+	}
+	if api.webhooks != nil {
+		if err := api.webhooks.Queued(webhookEntry(uuid, &rekorEntry.RekorLeaf)); err != nil {
+			logging.RequestIDLogger(r).Errorf("Error sending webhook event for entry %v: %s", uuid, err)
+		}
+	}
+
+	return models.AddResponse{
+		Status:               models.StatusCode{Code: getGprcCode(resp.status)},
+		UUID:                 uuid,
+		SignedEntryTimestamp: set,
 	}, nil
 }
 
+// checkDuplicate returns a conflict error if leafValue is already in the log
+func (api *API) checkDuplicate(server *trillianclient, leafValue []byte) error {
+	resp, err := server.getLeaf(leafValue, api.tLogID)
+	if err != nil {
+		return err
+	}
+	if leaves := resp.getLeafResult.GetLeaves(); len(leaves) != 0 {
+		return duplicateEntry(leaves[0])
+	}
+	return nil
+}
+
+// duplicateEntry reports that leaf is already in the log, identifying it so that retried uploads can find it
+func duplicateEntry(leaf *trillian.LogLeaf) error {
+	leafHash := hashLeaf(leaf)
+
+	existing := models.ExistingEntry{UUID: entryUUID(leafHash)}
+	// leaves that are still queued have not been assigned an index yet
+	if leaf.GetIntegrateTimestamp() != nil {
+		logIndex := leaf.LeafIndex
+		existing.LogIndex = &logIndex
+	}
+	return conflict(fmt.Sprintf("entry already exists with UUID %v", existing.UUID), existing)
+}
+
+// signEntryTimestamp promises that a queued leaf will be integrated into the log
+func (api *API) signEntryTimestamp(leaf *trillian.LogLeaf) (*types.SignedEntryTimestamp, error) {
+	if leaf == nil {
+		return nil, errors.New("no leaf returned from log")
+	}
+
+	logID, err := types.LogID(api.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	leafHash := hashLeaf(leaf)
+
+	// the timestamp is signed as soon as the leaf is queued, before Trillian has integrated it
+	queuedTime := time.Now()
+	if ts := leaf.GetQueueTimestamp(); ts != nil {
+		if queuedTime, err = ptypes.Timestamp(ts); err != nil {
+			return nil, err
+		}
+	}
+
+	return types.NewSignedEntryTimestamp(types.EntryTimestamp{
+		LogID:      logID,
+		LeafHash:   hex.EncodeToString(leafHash),
+		QueuedTime: queuedTime.Unix(),
+	}, api.signer)
+}
+
 func (api *API) getLatestHandler(r *http.Request) (interface{}, error) {
 	lastSizeInt := int64(0)
 	lastSize := r.URL.Query().Get("lastSize")
-	logging.RequestIDLogger(r).Info("Last Tree Recieved: ", lastSize)
+	logging.RequestIDLogger(r).Info("Last Tree Received: ", lastSize)
 	if lastSize != "" {
 		var err error
 		lastSizeInt, err = strconv.ParseInt(lastSize, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, badRequest(err)
 		}
 	}
 
-	server := serverInstance(api.logClient, api.tLogID)
+	server := api.logServer()
 
 	resp, err := server.getLatest(api.tLogID, lastSizeInt)
 	if err != nil {
 		return nil, err
 	}
 
-	return getLatestResponse{
-		Status: RespStatusCode{Code: getGprcCode(resp.status)},
+	return models.GetLatestResponse{
+		Status: models.StatusCode{Code: getGprcCode(resp.status)},
 		Proof:  resp.getLatestResult,
 		Key:    api.pubkey.Der,
 	}, nil
@@ -323,11 +503,11 @@ func (api *API) getLeafByIndexHandler(r *http.Request) (interface{}, error) {
 		var err error
 		leafSizeInt, err = strconv.ParseInt(leafIndex, 10, 64)
 		if err != nil {
-			return nil, err
+			return nil, badRequest(err)
 		}
 	}
 
-	server := serverInstance(api.logClient, api.tLogID)
+	server := api.logServer()
 
 	resp, err := server.getLeafByIndex(api.tLogID, leafSizeInt)
 	if err != nil {
@@ -341,34 +521,409 @@ func (api *API) getLeafByIndexHandler(r *http.Request) (interface{}, error) {
 
 	logging.RequestIDLogger(r).Info("Return getLeafByIndex :", string(respJSON))
 
-	return getLeafResponse{
-		Status: RespStatusCode{Code: getGprcCode(resp.status)},
+	return models.GetLeafResponse{
+		Status: models.StatusCode{Code: getGprcCode(resp.status)},
 		Leaf:   resp.getLeafByIndexResult,
 		Key:    api.pubkey.Der,
 	}, nil
 }
 
-func New() (*chi.Mux, error) {
+// entryUUID is the stable identifier of an entry: the hex encoded RFC 6962 hash of its leaf
+func entryUUID(leafHash []byte) string {
+	return hex.EncodeToString(leafHash)
+}
+
+// hashLeaf returns the RFC 6962 hash of a leaf's value. The MerkleLeafHash Trillian returns alongside the
+// value is not trusted, as nothing ties it to the value
+func hashLeaf(leaf *trillian.LogLeaf) []byte {
+	return rfc6962.DefaultHasher.HashLeaf(leaf.LeafValue)
+}
+
+func parseEntryUUID(uuid string) ([]byte, error) {
+	leafHash, err := hex.DecodeString(uuid)
+	if err != nil || len(leafHash) != rfc6962.DefaultHasher.Size() {
+		return nil, badRequest(fmt.Errorf("invalid entry UUID '%v'", uuid))
+	}
+	return leafHash, nil
+}
+
+// decodeLogEntry decodes a leaf stored in the log
+func decodeLogEntry(leaf *trillian.LogLeaf) (models.LogEntry, error) {
+	rekorLeaf, err := types.ParseRekorLeaf(bytes.NewReader(leaf.LeafValue))
+	if err != nil {
+		return models.LogEntry{}, fmt.Errorf("error decoding entry at index %d: %w", leaf.LeafIndex, err)
+	}
+
+	var integratedTime int64
+	if ts := leaf.GetIntegrateTimestamp(); ts != nil {
+		t, err := ptypes.Timestamp(ts)
+		if err != nil {
+			return models.LogEntry{}, err
+		}
+		integratedTime = t.Unix()
+	}
+
+	leafHash := hashLeaf(leaf)
+
+	return models.LogEntry{
+		UUID:           entryUUID(leafHash),
+		LogIndex:       leaf.LeafIndex,
+		IntegratedTime: integratedTime,
+		Entry:          rekorLeaf,
+	}, nil
+}
+
+// newLogEntryResponse decodes a leaf returned with its inclusion proof
+func newLogEntryResponse(resp *Response) (*models.LogEntryResponse, error) {
+	if resp.status == codes.NotFound {
+		return nil, notFound("entry not found")
+	}
+
+	entry, err := decodeLogEntry(resp.getEntryResult.Leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.LogEntryResponse{
+		LogEntry: entry,
+		InclusionProof: models.InclusionProof{
+			TreeSize: int64(resp.root.TreeSize),
+			RootHash: resp.root.RootHash,
+			Hashes:   resp.getEntryResult.Proof.GetHashes(),
+		},
+	}, nil
+}
+
+// encodePageToken and decodePageToken convert between the index a page starts at and the opaque
+// continuation token handed to clients
+func encodePageToken(index int64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(index, 10)))
+}
+
+func decodePageToken(token string) (int64, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, badRequest(errors.New("invalid page token"))
+	}
+	index, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil || index < 0 {
+		return 0, badRequest(errors.New("invalid page token"))
+	}
+	return index, nil
+}
+
+// getEntriesRangeHandler returns up to pageSize consecutive entries, starting at the index in either
+// the start or pageToken parameter
+func (api *API) getEntriesRangeHandler(r *http.Request) (interface{}, error) {
+	query := r.URL.Query()
+
+	start := int64(0)
+	var err error
+	switch {
+	case query.Get("pageToken") != "":
+		if start, err = decodePageToken(query.Get("pageToken")); err != nil {
+			return nil, err
+		}
+	case query.Get("start") != "":
+		if start, err = strconv.ParseInt(query.Get("start"), 10, 64); err != nil || start < 0 {
+			return nil, badRequest(fmt.Errorf("invalid start index '%v'", query.Get("start")))
+		}
+	}
+
+	maxPageSize := viper.GetInt64("rekor_server.max_page_size")
+	if maxPageSize < 1 {
+		maxPageSize = 100
+	}
+	pageSize := maxPageSize
+	if query.Get("pageSize") != "" {
+		if pageSize, err = strconv.ParseInt(query.Get("pageSize"), 10, 64); err != nil || pageSize < 1 {
+			return nil, badRequest(fmt.Errorf("invalid page size '%v'", query.Get("pageSize")))
+		}
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+	}
+
+	server := api.logServer()
+	resp, err := server.getLeavesByRange(start, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// a leaf that cannot be decoded is reported rather than failing the page, so clients can page past it
+	leaves := resp.getLeavesByRangeResult.GetLeaves()
+	result := models.EntriesRangeResponse{Entries: []models.LogEntry{}}
+	for _, leaf := range leaves {
+		entry, err := decodeLogEntry(leaf)
+		if err != nil {
+			logging.RequestIDLogger(r).Errorf("Skipping undecodable leaf: %s", err)
+			result.Errors = append(result.Errors, models.EntryError{
+				UUID:     entryUUID(hashLeaf(leaf)),
+				LogIndex: leaf.LeafIndex,
+				Error:    err.Error(),
+			})
+			continue
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+
+	if next := start + int64(len(leaves)); len(leaves) > 0 && uint64(next) < resp.root.TreeSize {
+		result.NextPageToken = encodePageToken(next)
+	}
+	return result, nil
+}
+
+func (api *API) getEntryByUUIDHandler(r *http.Request) (interface{}, error) {
+	leafHash, err := parseEntryUUID(chi.URLParam(r, "uuid"))
+	if err != nil {
+		return nil, err
+	}
+
+	server := api.logServer()
+	resp, err := server.getLeafAndProofByHash(leafHash)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLogEntryResponse(resp)
+}
+
+// getEntryBundleHandler returns the entry with the given UUID along with everything needed to verify
+// its inclusion in the log offline
+func (api *API) getEntryBundleHandler(r *http.Request) (interface{}, error) {
+	leafHash, err := parseEntryUUID(chi.URLParam(r, "uuid"))
+	if err != nil {
+		return nil, err
+	}
+
+	server := api.logServer()
+	resp, err := server.getLeafAndProofByHash(leafHash)
+	if err != nil {
+		return nil, err
+	}
+	entry, err := newLogEntryResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	checkpoint, err := api.signCheckpoint(resp.root)
+	if err != nil {
+		return nil, err
+	}
+	key, err := api.publicKeyPEM()
+	if err != nil {
+		return nil, err
+	}
+
+	return models.Bundle{
+		UUID:             entry.UUID,
+		LogIndex:         entry.LogIndex,
+		LeafValue:        resp.getEntryResult.Leaf.LeafValue,
+		InclusionProof:   entry.InclusionProof,
+		SignedCheckpoint: string(checkpoint),
+		PublicKey:        key,
+	}, nil
+}
+
+func (api *API) getEntryByIndexHandler(r *http.Request) (interface{}, error) {
+	logIndex, err := strconv.ParseInt(r.URL.Query().Get("logIndex"), 10, 64)
+	if err != nil {
+		return nil, badRequest(fmt.Errorf("invalid log index: %w", err))
+	}
+
+	server := api.logServer()
+	resp, err := server.getLeafAndProofByIndex(logIndex)
+	if err != nil {
+		return nil, err
+	}
+
+	return newLogEntryResponse(resp)
+}
+
+// searchIndexHandler returns the UUIDs of entries matching every criterion provided in the request
+func (api *API) searchIndexHandler(r *http.Request) (interface{}, error) {
+	var query models.SearchIndexRequest
+	if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+		return nil, badRequest(fmt.Errorf("invalid search request: %w", err))
+	}
+
+	var keys []string
+	if query.Hash != "" {
+		keys = append(keys, index.HashKey(query.Hash))
+	}
+	if query.PublicKeyFingerprint != "" {
+		keys = append(keys, index.FingerprintKey(query.PublicKeyFingerprint))
+	}
+	if query.Email != "" {
+		keys = append(keys, index.EmailKey(query.Email))
+	}
+	if query.UserID != "" {
+		keys = append(keys, index.UserIDKey(query.UserID))
+	}
+	if len(keys) == 0 {
+		return nil, badRequest(errors.New("at least one of Hash, PublicKeyFingerprint, Email or UserID must be provided"))
+	}
+
+	var uuids []string
+	for i, key := range keys {
+		matches, err := api.index.Lookup(key)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			uuids = matches
+			continue
+		}
+		uuids = intersect(uuids, matches)
+	}
+
+	return models.SearchIndexResponse{UUIDs: uuids}, nil
+}
+
+// intersect returns the members of a that are also in b, preserving the order of a
+func intersect(a, b []string) []string {
+	inB := make(map[string]bool, len(b))
+	for _, v := range b {
+		inB[v] = true
+	}
+	out := []string{}
+	for _, v := range a {
+		if inB[v] {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func (api *API) getConsistencyProofHandler(r *http.Request) (interface{}, error) {
+	firstSize, err := strconv.ParseInt(r.URL.Query().Get("first"), 10, 64)
+	if err != nil {
+		return nil, badRequest(fmt.Errorf("invalid first tree size: %w", err))
+	}
+
+	lastSize := int64(0)
+	if last := r.URL.Query().Get("last"); last != "" {
+		lastSize, err = strconv.ParseInt(last, 10, 64)
+		if err != nil {
+			return nil, badRequest(fmt.Errorf("invalid last tree size: %w", err))
+		}
+	}
+
+	// callers may give the root hashes of their own checkpoints, to check the proof against sizes the
+	// server has not recorded a signed log root for
+	var rootHashes [2][]byte
+	for i, param := range []string{"firstRootHash", "lastRootHash"} {
+		if h := r.URL.Query().Get(param); h != "" {
+			rootHashes[i], err = hex.DecodeString(h)
+			if err != nil || len(rootHashes[i]) != sha256.Size {
+				return nil, badRequest(fmt.Errorf("invalid %v '%v'", param, h))
+			}
+		}
+	}
+
+	server := api.logServer()
+	resp, err := server.getConsistencyProof(api.tLogID, firstSize, lastSize, rootHashes[0], rootHashes[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return models.ConsistencyProofResponse{
+		Status:        models.StatusCode{Code: getGprcCode(resp.status)},
+		FirstSize:     firstSize,
+		LastSize:      resp.lastTreeSize,
+		FirstRootHash: resp.firstRootHash,
+		LastRootHash:  resp.lastRootHash,
+		Proof:         resp.getConsistencyResult,
+		Key:           api.pubkey.Der,
+	}, nil
+}
+
+func (api *API) getCheckpointHandler(w http.ResponseWriter, r *http.Request) {
+	server := api.logServer()
+	root, err := server.root()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	text, err := api.signCheckpoint(root)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	_, _ = w.Write(text)
+}
+
+// signCheckpoint returns the signed note committing to root
+func (api *API) signCheckpoint(root ttypes.LogRootV1) ([]byte, error) {
+	checkpoint := types.SignedCheckpoint{
+		Checkpoint: types.Checkpoint{
+			Origin:       fmt.Sprintf("%s - %d", api.hostname, api.tLogID),
+			Size:         root.TreeSize,
+			Hash:         root.RootHash,
+			OtherContent: []string{fmt.Sprintf("Timestamp: %d", root.TimestampNanos)},
+		},
+	}
+	if err := checkpoint.Sign(api.hostname, api.signer); err != nil {
+		return nil, err
+	}
+	return checkpoint.MarshalText()
+}
+
+// publicKeyPEM returns the PEM encoded public key that checkpoints and entry timestamps are signed with
+func (api *API) publicKeyPEM() ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(api.signer.Public())
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+func (api *API) getPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := api.publicKeyPEM()
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-pem-file")
+	_, _ = w.Write(key)
+}
+
+// maxUploadSize is the largest request body the server will accept, in bytes
+func maxUploadSize() int64 {
+	if size := viper.GetInt64("rekor_server.max_upload_size"); size > 0 {
+		return size
+	}
+	return 32 << 20
+}
+
+func newRouter(api *API) *chi.Mux {
 	router := chi.NewRouter()
 	router.Use(middleware.RequestID)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
+	router.Use(limitRequestBody(maxUploadSize()))
 
-	api, err := NewAPI()
-	if err != nil {
-		return nil, err
-	}
 	router.Post("/api/v1/add", wrap(api.addHandler))
 	router.Post("/api/v1/get", wrap(api.getHandler))
 	router.Post("/api/v1/getproof", wrap(api.getProofHandler))
 	router.Post("/api/v1/latest", wrap(api.getLatestHandler))
 	router.Get("/api/v1/getleaf", wrap(api.getLeafByIndexHandler))
+	router.Get("/api/v1/log/checkpoint", api.getCheckpointHandler)
+	router.Get("/api/v1/log/proof/consistency", wrap(api.getConsistencyProofHandler))
+	router.Get("/api/v1/log/entries", wrap(api.getEntryByIndexHandler))
+	router.Get("/api/v1/log/entries/range", wrap(api.getEntriesRangeHandler))
+	router.Get("/api/v1/log/entries/stream", api.feed.getEntriesStreamHandler)
+	router.Get("/api/v1/log/entries/{uuid}", wrap(api.getEntryByUUIDHandler))
+	router.Get("/api/v1/log/entries/{uuid}/bundle", wrap(api.getEntryBundleHandler))
+	router.Post("/api/v1/index/retrieve", wrap(api.searchIndexHandler))
+	router.Get("/api/v1/log/publicKey", api.getPublicKeyHandler)
+	router.Get("/api/v1/openapi.json", getOpenAPIHandler)
+	router.Get("/api/v1/ping", api.ping)
+	// kept for clients of the original, mistyped ping route
 	router.Get("/api/v1//ping", api.ping)
-	return router, nil
-}
-
-func writeError(w http.ResponseWriter, err error) {
-	logging.Logger.Error(err)
-	w.WriteHeader(http.StatusInternalServerError)
-	fmt.Fprintf(w, "Server error: %v\n", err)
+	return router
 }
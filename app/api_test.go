@@ -0,0 +1,1640 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/google/trillian"
+	tcrypto "github.com/google/trillian/crypto"
+	"github.com/google/trillian/crypto/keys/der"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/index"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/verify"
+	"github.com/projectrekor/rekor-server/webhook"
+	"github.com/spf13/viper"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeLogClient is an in-memory stand in for the Trillian log server; leaves are integrated as soon as they are queued
+type fakeLogClient struct {
+	trillian.TrillianLogClient
+
+	mu     sync.Mutex
+	tree   *merkle.InMemoryMerkleTree
+	leaves []*trillian.LogLeaf
+	byHash map[string]int64
+	// signer is the tree key log roots are signed with
+	signer *ecdsa.PrivateKey
+}
+
+func newFakeLogClient() *fakeLogClient {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	return &fakeLogClient{
+		tree:   merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher),
+		byHash: map[string]int64{},
+		signer: signer,
+	}
+}
+
+func (f *fakeLogClient) signedRoot() *trillian.SignedLogRoot {
+	root := ttypes.LogRootV1{
+		TreeSize:       uint64(len(f.leaves)),
+		RootHash:       f.tree.CurrentRoot().Hash(),
+		TimestampNanos: uint64(time.Now().UnixNano()),
+	}
+	if len(f.leaves) == 0 {
+		root.RootHash = rfc6962.DefaultHasher.EmptyRoot()
+	}
+	slr, err := tcrypto.NewSHA256Signer(f.signer).SignLogRoot(&root)
+	if err != nil {
+		panic(err)
+	}
+	return slr
+}
+
+func (f *fakeLogClient) proof(index, treeSize int64) *trillian.Proof {
+	var hashes [][]byte
+	for _, node := range f.tree.PathToRootAtSnapshot(index+1, treeSize) {
+		hashes = append(hashes, node.Value.Hash())
+	}
+	return &trillian.Proof{LeafIndex: index, Hashes: hashes}
+}
+
+func (f *fakeLogClient) QueueLeaf(ctx context.Context, in *trillian.QueueLeafRequest, opts ...grpc.CallOption) (*trillian.QueueLeafResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	leafHash := rfc6962.DefaultHasher.HashLeaf(in.Leaf.LeafValue)
+	if idx, ok := f.byHash[string(leafHash)]; ok {
+		return &trillian.QueueLeafResponse{QueuedLeaf: &trillian.QueuedLogLeaf{
+			Leaf:   f.leaves[idx],
+			Status: status.New(codes.AlreadyExists, "already exists").Proto(),
+		}}, nil
+	}
+
+	now := ptypes.TimestampNow()
+	leaf := &trillian.LogLeaf{
+		MerkleLeafHash:     leafHash,
+		LeafValue:          in.Leaf.LeafValue,
+		LeafIndex:          int64(len(f.leaves)),
+		LeafIdentityHash:   leafHash,
+		QueueTimestamp:     now,
+		IntegrateTimestamp: now,
+	}
+	f.tree.AddLeaf(in.Leaf.LeafValue)
+	f.byHash[string(leafHash)] = leaf.LeafIndex
+	f.leaves = append(f.leaves, leaf)
+
+	return &trillian.QueueLeafResponse{QueuedLeaf: &trillian.QueuedLogLeaf{
+		Leaf:   leaf,
+		Status: status.New(codes.OK, "").Proto(),
+	}}, nil
+}
+
+func (f *fakeLogClient) GetLatestSignedLogRoot(ctx context.Context, in *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &trillian.GetLatestSignedLogRootResponse{SignedLogRoot: f.signedRoot()}, nil
+}
+
+func (f *fakeLogClient) GetLeavesByHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &trillian.GetLeavesByHashResponse{SignedLogRoot: f.signedRoot()}
+	for _, h := range in.LeafHash {
+		if idx, ok := f.byHash[string(h)]; ok {
+			resp.Leaves = append(resp.Leaves, f.leaves[idx])
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeLogClient) GetLeavesByIndex(ctx context.Context, in *trillian.GetLeavesByIndexRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByIndexResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	resp := &trillian.GetLeavesByIndexResponse{SignedLogRoot: f.signedRoot()}
+	for _, idx := range in.LeafIndex {
+		if idx < 0 || idx >= int64(len(f.leaves)) {
+			return nil, status.Errorf(codes.OutOfRange, "leaf index %d out of range", idx)
+		}
+		resp.Leaves = append(resp.Leaves, f.leaves[idx])
+	}
+	return resp, nil
+}
+
+func (f *fakeLogClient) GetLeavesByRange(ctx context.Context, in *trillian.GetLeavesByRangeRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByRangeResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if in.StartIndex < 0 || in.Count < 1 {
+		return nil, status.Error(codes.InvalidArgument, "invalid range")
+	}
+	resp := &trillian.GetLeavesByRangeResponse{SignedLogRoot: f.signedRoot()}
+	for i := in.StartIndex; i < in.StartIndex+in.Count && i < int64(len(f.leaves)); i++ {
+		resp.Leaves = append(resp.Leaves, f.leaves[i])
+	}
+	return resp, nil
+}
+
+func (f *fakeLogClient) GetInclusionProofByHash(ctx context.Context, in *trillian.GetInclusionProofByHashRequest, opts ...grpc.CallOption) (*trillian.GetInclusionProofByHashResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	idx, ok := f.byHash[string(in.LeafHash)]
+	if !ok || idx >= in.TreeSize {
+		return nil, status.Error(codes.NotFound, "leaf not found")
+	}
+	return &trillian.GetInclusionProofByHashResponse{
+		Proof:         []*trillian.Proof{f.proof(idx, in.TreeSize)},
+		SignedLogRoot: f.signedRoot(),
+	}, nil
+}
+
+func (f *fakeLogClient) GetEntryAndProof(ctx context.Context, in *trillian.GetEntryAndProofRequest, opts ...grpc.CallOption) (*trillian.GetEntryAndProofResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if in.LeafIndex < 0 || in.LeafIndex >= in.TreeSize || in.TreeSize > int64(len(f.leaves)) {
+		return nil, status.Error(codes.OutOfRange, "invalid leaf index or tree size")
+	}
+	return &trillian.GetEntryAndProofResponse{
+		Proof:         f.proof(in.LeafIndex, in.TreeSize),
+		Leaf:          f.leaves[in.LeafIndex],
+		SignedLogRoot: f.signedRoot(),
+	}, nil
+}
+
+func (f *fakeLogClient) GetConsistencyProof(ctx context.Context, in *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if in.FirstTreeSize < 1 || in.FirstTreeSize > in.SecondTreeSize || in.SecondTreeSize > int64(len(f.leaves)) {
+		return nil, status.Error(codes.InvalidArgument, "invalid tree sizes")
+	}
+	var hashes [][]byte
+	for _, node := range f.tree.SnapshotConsistency(in.FirstTreeSize, in.SecondTreeSize) {
+		hashes = append(hashes, node.Value.Hash())
+	}
+	return &trillian.GetConsistencyProofResponse{
+		Proof:         &trillian.Proof{Hashes: hashes},
+		SignedLogRoot: f.signedRoot(),
+	}, nil
+}
+
+// newTestServer returns an httptest server wired to an API backed by a fakeLogClient
+func newTestServer(t *testing.T) (*httptest.Server, *fakeLogClient, *API) {
+	t.Helper()
+
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logClient := newFakeLogClient()
+	treeKey, err := der.ToPublicProto(logClient.signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{
+		tLogID:    1,
+		logClient: logClient,
+		pubkey:    treeKey,
+		signer:    signer,
+		hostname:  "rekor.test",
+		index:     index.NewMemoryIndex(),
+		roots:     newRootHistory(),
+	}
+	api.feed = newEntryFeed(api.logServer(), streamPollInterval())
+	server := httptest.NewServer(newRouter(api))
+	t.Cleanup(server.Close)
+	return server, logClient, api
+}
+
+func getJSON(t *testing.T, url string, v interface{}) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body bytes.Buffer
+	if _, err := body.ReadFrom(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	if v != nil && resp.StatusCode == http.StatusOK {
+		if err := json.Unmarshal(body.Bytes(), v); err != nil {
+			t.Fatalf("error decoding response from %v: %v\n%s", url, err, body.String())
+		}
+	}
+	return resp.StatusCode
+}
+
+// tamperedLogClient returns consistency proofs with their first hash altered
+type tamperedLogClient struct {
+	*fakeLogClient
+}
+
+func (c tamperedLogClient) GetConsistencyProof(ctx context.Context, in *trillian.GetConsistencyProofRequest, opts ...grpc.CallOption) (*trillian.GetConsistencyProofResponse, error) {
+	resp, err := c.fakeLogClient.GetConsistencyProof(ctx, in, opts...)
+	if err == nil && len(resp.Proof.Hashes) > 0 {
+		resp.Proof.Hashes[0] = rfc6962.DefaultHasher.HashLeaf([]byte("tampered"))
+	}
+	return resp, err
+}
+
+func TestNewSigner(t *testing.T) {
+	// a server without a signing key refuses to start rather than sign with a key that will be lost
+	if _, err := newSigner(); err == nil {
+		t.Errorf("expected an error without a signing key")
+	}
+
+	viper.Set("rekor_server.ephemeral_signing_key", true)
+	defer viper.Set("rekor_server.ephemeral_signing_key", nil)
+	if signer, err := newSigner(); err != nil || signer == nil {
+		t.Errorf("expected an ephemeral signing key, got %v", err)
+	}
+}
+
+func TestConsistencyProof(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+
+	// publish a checkpoint at every size, so the server has seen a signed root for each
+	for i := 0; i < 7; i++ {
+		if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+			Leaf: &trillian.LogLeaf{LeafValue: []byte(fmt.Sprintf("leaf %d", i))},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if code := getJSON(t, server.URL+"/api/v1/log/checkpoint", nil); code != http.StatusOK {
+			t.Fatalf("unexpected status %d fetching checkpoint", code)
+		}
+	}
+
+	v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
+	for _, sizes := range [][2]int64{{1, 7}, {3, 7}, {4, 6}, {7, 7}} {
+		var resp models.ConsistencyProofResponse
+		url := fmt.Sprintf("%s/api/v1/log/proof/consistency?first=%d&last=%d", server.URL, sizes[0], sizes[1])
+		if code := getJSON(t, url, &resp); code != http.StatusOK {
+			t.Fatalf("unexpected status %d for sizes %v", code, sizes)
+		}
+		if !bytes.Equal(resp.FirstRootHash, logClient.tree.RootAtSnapshot(sizes[0]).Hash()) {
+			t.Errorf("unexpected first root hash for sizes %v", sizes)
+		}
+		if err := v.VerifyConsistencyProof(sizes[0], sizes[1], resp.FirstRootHash, resp.LastRootHash, resp.Proof.Proof.Hashes); err != nil {
+			t.Errorf("consistency proof for sizes %v did not verify: %v", sizes, err)
+		}
+	}
+
+	var resp models.ConsistencyProofResponse
+	if code := getJSON(t, server.URL+"/api/v1/log/proof/consistency?first=2", &resp); code != http.StatusOK || resp.LastSize != 7 {
+		t.Errorf("last size should default to the current tree size, got %d (status %d)", resp.LastSize, code)
+	}
+
+	for _, query := range []string{"", "first=0&last=3", "first=5&last=3", "first=1&last=8", "first=abc"} {
+		if code := getJSON(t, server.URL+"/api/v1/log/proof/consistency?"+query, nil); code == http.StatusOK {
+			t.Errorf("unexpected success for query %q", query)
+		}
+	}
+
+	// a server that has not seen signed roots for the sizes still serves the proof, checking it against
+	// the root hashes the caller gives from its own checkpoints
+	fresh := httptest.NewServer(newRouter(&API{
+		tLogID:    api.tLogID,
+		logClient: logClient,
+		pubkey:    api.pubkey,
+		signer:    api.signer,
+		hostname:  api.hostname,
+		index:     api.index,
+		roots:     newRootHistory(),
+	}))
+	defer fresh.Close()
+	resp = models.ConsistencyProofResponse{}
+	if code := getJSON(t, fresh.URL+"/api/v1/log/proof/consistency?first=3", &resp); code != http.StatusOK {
+		t.Fatalf("unexpected status %d from server without root history", code)
+	}
+	if resp.FirstRootHash != nil || !bytes.Equal(resp.LastRootHash, logClient.tree.CurrentRoot().Hash()) {
+		t.Errorf("only the root hash of the current tree should be returned without root history, got %+v", resp)
+	}
+	if err := v.VerifyConsistencyProof(3, 7, logClient.tree.RootAtSnapshot(3).Hash(), resp.LastRootHash, resp.Proof.Proof.Hashes); err != nil {
+		t.Errorf("consistency proof from server without root history did not verify: %v", err)
+	}
+
+	rootAt := func(size int64) string { return hex.EncodeToString(logClient.tree.RootAtSnapshot(size).Hash()) }
+	url := fmt.Sprintf("%s/api/v1/log/proof/consistency?first=2&last=5&firstRootHash=%s&lastRootHash=%s", fresh.URL, rootAt(2), rootAt(5))
+	resp = models.ConsistencyProofResponse{}
+	if code := getJSON(t, url, &resp); code != http.StatusOK {
+		t.Fatalf("unexpected status %d for a proof between given root hashes", code)
+	}
+	if resp.FirstRootHash == nil || resp.LastRootHash == nil {
+		t.Errorf("the given root hashes should be returned, got %+v", resp)
+	}
+
+	// a root hash that is not consistent with the log is reported as a conflict, whether the server has
+	// recorded a root for its size or not
+	for _, url := range []string{
+		fmt.Sprintf("%s/api/v1/log/proof/consistency?first=2&firstRootHash=%s", fresh.URL, rootAt(3)),
+		fmt.Sprintf("%s/api/v1/log/proof/consistency?first=2&firstRootHash=%s", server.URL, rootAt(3)),
+	} {
+		var errResp models.ErrorResponse
+		if code := getError(t, url, &errResp); code != http.StatusConflict || !strings.Contains(errResp.Message, "tree size 2") {
+			t.Errorf("unexpected status %d for an inconsistent root hash: %+v", code, errResp)
+		}
+	}
+	if code := getJSON(t, server.URL+"/api/v1/log/proof/consistency?first=2&firstRootHash=abc", nil); code != http.StatusBadRequest {
+		t.Errorf("unexpected status %d for an invalid root hash", code)
+	}
+
+	tampered := httptest.NewServer(newRouter(&API{
+		tLogID:    api.tLogID,
+		logClient: tamperedLogClient{logClient},
+		pubkey:    api.pubkey,
+		signer:    api.signer,
+		hostname:  api.hostname,
+		index:     api.index,
+		roots:     api.roots,
+	}))
+	defer tampered.Close()
+	if code := getJSON(t, tampered.URL+"/api/v1/log/proof/consistency?first=3", nil); code == http.StatusOK {
+		t.Errorf("tampered consistency proof should not be returned")
+	}
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, err := der.ToPublicProto(otherKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey := httptest.NewServer(newRouter(&API{
+		tLogID:    api.tLogID,
+		logClient: logClient,
+		pubkey:    otherPub,
+		signer:    api.signer,
+		hostname:  api.hostname,
+		index:     api.index,
+		roots:     newRootHistory(),
+	}))
+	defer wrongKey.Close()
+	for _, path := range []string{"/api/v1/log/checkpoint", "/api/v1/log/proof/consistency?first=3"} {
+		if code := getJSON(t, wrongKey.URL+path, nil); code == http.StatusOK {
+			t.Errorf("%v should fail when log roots are not signed by the tree key", path)
+		}
+	}
+}
+
+// testEntry builds the JSON for a valid PGP signed entry using the pki test data
+func testEntry(t *testing.T) []byte {
+	t.Helper()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile("../pki/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	entry, err := json.Marshal(map[string]interface{}{
+		"Data":      read("hello_world.txt"),
+		"Signature": read("hello_world.txt.asc.sig"),
+		"PublicKey": read("valid_armored_public.pgp"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry
+}
+
+// postFile submits content to url as the multipart "fileupload" field
+func postFile(t *testing.T, url string, content []byte, v interface{}) int {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("fileupload", "entry.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(url, mw.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != nil {
+		if err := json.Unmarshal(respBody, v); err != nil {
+			t.Fatalf("error decoding response from %v: %v\n%s", url, err, respBody)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestAddReturnsSignedEntryTimestamp(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+
+	var resp models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &resp); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+	set := resp.SignedEntryTimestamp
+	if set == nil {
+		t.Fatalf("no signed entry timestamp returned")
+	}
+
+	if err := set.Verify(api.signer.Public()); err != nil {
+		t.Errorf("signed entry timestamp did not verify: %v", err)
+	}
+	if set.Payload.LeafHash != hex.EncodeToString(logClient.leaves[0].MerkleLeafHash) {
+		t.Errorf("signed entry timestamp is for leaf %v, expected %x", set.Payload.LeafHash, logClient.leaves[0].MerkleLeafHash)
+	}
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err := set.Verify(otherKey.Public()); err == nil {
+		t.Errorf("signed entry timestamp unexpectedly verified with another key")
+	}
+	if queued := logClient.leaves[0].QueueTimestamp; set.Payload.QueuedTime != queued.Seconds {
+		t.Errorf("signed entry timestamp has time %d, expected the time the leaf was queued %d", set.Payload.QueuedTime, queued.Seconds)
+	}
+	set.Payload.QueuedTime++
+	if err := set.Verify(api.signer.Public()); err == nil {
+		t.Errorf("modified signed entry timestamp unexpectedly verified")
+	}
+}
+
+func TestGetEntry(t *testing.T) {
+	server, logClient, _ := newTestServer(t)
+
+	for i := 0; i < 3; i++ {
+		if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+			Leaf: &trillian.LogLeaf{LeafValue: []byte(fmt.Sprintf("leaf %d", i))},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var added models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+
+	v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
+	for _, url := range []string{
+		server.URL + "/api/v1/log/entries/" + added.UUID,
+		server.URL + "/api/v1/log/entries?logIndex=3",
+	} {
+		var entry models.LogEntryResponse
+		if code := getJSON(t, url, &entry); code != http.StatusOK {
+			t.Fatalf("unexpected status %d fetching %v", code, url)
+		}
+		if entry.UUID != added.UUID || entry.LogIndex != 3 || entry.IntegratedTime == 0 {
+			t.Errorf("unexpected entry returned from %v: %+v", url, entry)
+		}
+		if entry.Entry == nil || entry.Entry.SHA == "" {
+			t.Errorf("entry from %v was not decoded", url)
+		}
+
+		leafHash, _ := hex.DecodeString(entry.UUID)
+		p := entry.InclusionProof
+		if err := v.VerifyInclusionProof(entry.LogIndex, p.TreeSize, p.Hashes, p.RootHash, leafHash); err != nil {
+			t.Errorf("inclusion proof from %v did not verify: %v", url, err)
+		}
+	}
+
+	for _, url := range []string{
+		server.URL + "/api/v1/log/entries/" + strings.Repeat("0", 64),
+		server.URL + "/api/v1/log/entries/not-a-uuid",
+		server.URL + "/api/v1/log/entries?logIndex=4",
+		server.URL + "/api/v1/log/entries?logIndex=-1",
+	} {
+		if code := getJSON(t, url, nil); code == http.StatusOK {
+			t.Errorf("unexpected success fetching %v", url)
+		}
+	}
+}
+
+// leafSwappingLogClient returns the value of the first leaf in the log in place of the one requested,
+// along with the hash and proof of the requested leaf
+type leafSwappingLogClient struct {
+	*fakeLogClient
+}
+
+func (c leafSwappingLogClient) GetEntryAndProof(ctx context.Context, in *trillian.GetEntryAndProofRequest, opts ...grpc.CallOption) (*trillian.GetEntryAndProofResponse, error) {
+	resp, err := c.fakeLogClient.GetEntryAndProof(ctx, in, opts...)
+	if err == nil {
+		resp.Leaf = &trillian.LogLeaf{
+			MerkleLeafHash:     resp.Leaf.MerkleLeafHash,
+			LeafValue:          c.leaves[0].LeafValue,
+			LeafIndex:          resp.Leaf.LeafIndex,
+			IntegrateTimestamp: resp.Leaf.IntegrateTimestamp,
+		}
+	}
+	return resp, err
+}
+
+// wrongLeafLogClient answers every lookup by hash with the first leaf in the log
+type wrongLeafLogClient struct {
+	*fakeLogClient
+}
+
+func (c wrongLeafLogClient) GetLeavesByHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	return c.fakeLogClient.GetLeavesByHash(ctx, &trillian.GetLeavesByHashRequest{
+		LogId:    in.LogId,
+		LeafHash: [][]byte{c.leaves[0].MerkleLeafHash},
+	}, opts...)
+}
+
+func TestGetEntryChecksLeafHash(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 2)
+	uuid := entryUUID(logClient.leaves[1].MerkleLeafHash)
+	if code := getJSON(t, server.URL+"/api/v1/log/entries/"+uuid, nil); code != http.StatusOK {
+		t.Fatalf("unexpected status %d fetching entry", code)
+	}
+
+	for name, client := range map[string]trillian.TrillianLogClient{
+		"swapped leaf value": leafSwappingLogClient{logClient},
+		"wrong leaf by hash": wrongLeafLogClient{logClient},
+	} {
+		bad := httptest.NewServer(newRouter(&API{
+			tLogID:    api.tLogID,
+			logClient: client,
+			pubkey:    api.pubkey,
+			signer:    api.signer,
+			hostname:  api.hostname,
+			index:     api.index,
+			roots:     newRootHistory(),
+		}))
+		if code := getJSON(t, bad.URL+"/api/v1/log/entries/"+uuid, nil); code == http.StatusOK {
+			t.Errorf("%v: entry should not be returned by UUID", name)
+		}
+		if name == "swapped leaf value" {
+			if code := getJSON(t, bad.URL+"/api/v1/log/entries?logIndex=1", nil); code == http.StatusOK {
+				t.Errorf("%v: entry should not be returned by index", name)
+			}
+		}
+		bad.Close()
+	}
+}
+
+func TestSearchIndex(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	var added models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+
+	search := func(query string) (int, []string) {
+		resp, err := http.Post(server.URL+"/api/v1/index/retrieve", "application/json", strings.NewReader(query))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var result models.SearchIndexResponse
+		if resp.StatusCode == http.StatusOK {
+			if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return resp.StatusCode, result.UUIDs
+	}
+
+	sha := sha256.Sum256([]byte("Hello, World!\n"))
+	tests := map[string]int{
+		fmt.Sprintf(`{"Hash": "%x"}`, sha):                                             1,
+		`{"PublicKeyFingerprint": "0x86F575529D0F9FF4"}`:                               1,
+		`{"PublicKeyFingerprint": "df8d33c4b29e3e3396a9d55e1e75e9895d24124f"}`:         1,
+		fmt.Sprintf(`{"Hash": "%x", "PublicKeyFingerprint": "86f575529d0f9ff4"}`, sha): 1,
+		fmt.Sprintf(`{"Hash": "%x", "PublicKeyFingerprint": "0000000000000000"}`, sha): 0,
+		`{"Email": "nobody@example.com"}`:                                              0,
+		// the user ID of the test key has no email address in angle brackets
+		`{"UserID": " Not@Real.com"}`: 1,
+		`{"UserID": "nobody"}`:        0,
+	}
+	for query, expected := range tests {
+		code, uuids := search(query)
+		if code != http.StatusOK || len(uuids) != expected {
+			t.Errorf("query %v returned %d, %v; expected %d results", query, code, uuids, expected)
+		}
+		if expected == 1 && uuids[0] != added.UUID {
+			t.Errorf("query %v returned %v, expected %v", query, uuids[0], added.UUID)
+		}
+	}
+
+	if code, _ := search(`{}`); code == http.StatusOK {
+		t.Errorf("unexpected success for empty query")
+	}
+}
+
+func TestAPIClose(t *testing.T) {
+	dir := t.TempDir()
+	idx, err := index.NewBoltIndex(dir + "/index.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher, err := webhook.New(webhook.Config{
+		URLs:       []string{"http://127.0.0.1:1"},
+		Secret:     []byte("test secret"),
+		OutboxPath: dir + "/outbox.db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots, err := openRootHistory(dir+"/roots.db", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := &API{logClient: newFakeLogClient(), index: idx, webhooks: dispatcher, roots: roots}
+	api.start()
+	if err := api.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the databases are locked for as long as they are open
+	reopened, err := index.NewBoltIndex(dir + "/index.db")
+	if err != nil {
+		t.Fatalf("index should be released once the API is closed: %v", err)
+	}
+	reopened.Close()
+	outbox, err := webhook.New(webhook.Config{
+		URLs:       []string{"http://127.0.0.1:1"},
+		Secret:     []byte("test secret"),
+		OutboxPath: dir + "/outbox.db",
+	})
+	if err != nil {
+		t.Fatalf("webhook outbox should be released once the API is closed: %v", err)
+	}
+	outbox.Close()
+	reopenedRoots, err := openRootHistory(dir+"/roots.db", 1)
+	if err != nil {
+		t.Fatalf("root history should be released once the API is closed: %v", err)
+	}
+	reopenedRoots.Close()
+}
+
+func TestRootHistoryPersisted(t *testing.T) {
+	path := t.TempDir() + "/roots.db"
+	hash := rfc6962.DefaultHasher.HashLeaf([]byte("root"))
+
+	roots, err := openRootHistory(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := roots.add(3, hash); err != nil {
+		t.Fatal(err)
+	}
+	roots.Close()
+
+	roots, err = openRootHistory(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seen, ok := roots.get(3); !ok || !bytes.Equal(seen, hash) {
+		t.Errorf("root recorded before a restart should be remembered, got %x", seen)
+	}
+	if err := roots.add(3, rfc6962.DefaultHasher.HashLeaf([]byte("other root"))); err == nil {
+		t.Errorf("a root conflicting with one recorded before a restart should be rejected")
+	}
+	if _, ok := roots.get(4); ok {
+		t.Errorf("unexpected root for a size that was never recorded")
+	}
+
+	roots.Close()
+
+	other, err := openRootHistory(path, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+	if _, ok := other.get(3); ok {
+		t.Errorf("roots of one tree should not be visible to another")
+	}
+}
+
+// addTestEntries adds count distinct valid entries to the log by varying the artifact content
+func addTestEntries(t *testing.T, logClient *fakeLogClient, count int) {
+	t.Helper()
+	addTestEntriesFrom(t, logClient, 0, count)
+}
+
+// addTestEntriesFrom adds count entries distinct from those added with a different range of first
+func addTestEntriesFrom(t *testing.T, logClient *fakeLogClient, first, count int) {
+	t.Helper()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(testEntry(t), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for i := first; i < first+count; i++ {
+		// the SHA is not checked when reading leaves back, so varying it is enough to make them distinct
+		leaf := map[string]interface{}{
+			"SHA":       fmt.Sprintf("%064x", i),
+			"Signature": entry["Signature"],
+			"PublicKey": entry["PublicKey"],
+		}
+		leafValue, err := json.Marshal(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+			Leaf: &trillian.LogLeaf{LeafValue: leafValue},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestGetEntriesRange(t *testing.T) {
+	server, logClient, _ := newTestServer(t)
+	addTestEntries(t, logClient, 7)
+
+	viper.Set("rekor_server.max_page_size", 3)
+	defer viper.Set("rekor_server.max_page_size", nil)
+
+	var seen []int64
+	url := server.URL + "/api/v1/log/entries/range?start=1&pageSize=10"
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatalf("too many pages returned")
+		}
+		var page models.EntriesRangeResponse
+		if code := getJSON(t, url, &page); code != http.StatusOK {
+			t.Fatalf("unexpected status %d fetching %v", code, url)
+		}
+		if len(page.Entries) > 3 {
+			t.Errorf("page size was not capped: %d entries", len(page.Entries))
+		}
+		for _, e := range page.Entries {
+			seen = append(seen, e.LogIndex)
+			if e.Entry == nil || e.UUID == "" {
+				t.Errorf("entry %d was not decoded", e.LogIndex)
+			}
+		}
+		if page.NextPageToken == "" {
+			break
+		}
+		url = server.URL + "/api/v1/log/entries/range?pageToken=" + page.NextPageToken
+	}
+
+	if !reflect.DeepEqual(seen, []int64{1, 2, 3, 4, 5, 6}) {
+		t.Errorf("unexpected indices returned: %v", seen)
+	}
+
+	var empty models.EntriesRangeResponse
+	if code := getJSON(t, server.URL+"/api/v1/log/entries/range?start=7", &empty); code != http.StatusOK || len(empty.Entries) != 0 || empty.NextPageToken != "" {
+		t.Errorf("unexpected result past the end of the log: %d %+v", code, empty)
+	}
+
+	for _, query := range []string{"start=-1", "pageSize=0", "pageToken=bm90LWEtbnVtYmVy", "start=abc"} {
+		if code := getJSON(t, server.URL+"/api/v1/log/entries/range?"+query, nil); code == http.StatusOK {
+			t.Errorf("unexpected success for query %q", query)
+		}
+	}
+
+	// an undecodable leaf is reported without failing the rest of the page
+	if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+		Leaf: &trillian.LogLeaf{LeafValue: []byte("not an entry")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addTestEntriesFrom(t, logClient, 7, 2)
+
+	var withBad models.EntriesRangeResponse
+	if code := getJSON(t, server.URL+"/api/v1/log/entries/range?start=6", &withBad); code != http.StatusOK {
+		t.Fatalf("unexpected status %d fetching a page with an undecodable leaf", code)
+	}
+	seen = nil
+	for _, e := range withBad.Entries {
+		seen = append(seen, e.LogIndex)
+	}
+	if !reflect.DeepEqual(seen, []int64{6, 8}) {
+		t.Errorf("unexpected indices returned around an undecodable leaf: %v", seen)
+	}
+	if len(withBad.Errors) != 1 || withBad.Errors[0].LogIndex != 7 || withBad.Errors[0].UUID != entryUUID(rfc6962.DefaultHasher.HashLeaf([]byte("not an entry"))) {
+		t.Errorf("undecodable leaf was not reported: %+v", withBad.Errors)
+	}
+	if withBad.NextPageToken != encodePageToken(9) {
+		t.Errorf("next page should start after the undecodable leaf, got token %q", withBad.NextPageToken)
+	}
+}
+
+// unavailableLogClient simulates a Trillian log server that cannot be reached
+type unavailableLogClient struct {
+	*fakeLogClient
+}
+
+func (u unavailableLogClient) GetLatestSignedLogRoot(ctx context.Context, in *trillian.GetLatestSignedLogRootRequest, opts ...grpc.CallOption) (*trillian.GetLatestSignedLogRootResponse, error) {
+	return nil, status.Error(codes.Unavailable, "connection refused")
+}
+
+func TestErrorResponses(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 2)
+
+	type TestCase struct {
+		caseDesc string
+		path     string
+		code     int
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Non-numeric log index", path: "/api/v1/log/entries?logIndex=abc", code: http.StatusBadRequest},
+		{caseDesc: "Log index past the end of the log", path: "/api/v1/log/entries?logIndex=5", code: http.StatusNotFound},
+		{caseDesc: "Malformed UUID", path: "/api/v1/log/entries/not-a-uuid", code: http.StatusBadRequest},
+		{caseDesc: "Unknown UUID", path: "/api/v1/log/entries/" + strings.Repeat("ab", 32), code: http.StatusNotFound},
+		{caseDesc: "Inconsistent tree sizes", path: "/api/v1/log/proof/consistency?first=2&last=1", code: http.StatusBadRequest},
+		{caseDesc: "Invalid page token", path: "/api/v1/log/entries/range?pageToken=bm90LWEtbnVtYmVy", code: http.StatusBadRequest},
+	}
+
+	for _, tc := range testCases {
+		var errResp models.ErrorResponse
+		if code := getError(t, server.URL+tc.path, &errResp); code != tc.code {
+			t.Errorf("%v: expected status %v, got %v", tc.caseDesc, tc.code, code)
+		}
+		if errResp.Code != tc.code || errResp.Message == "" {
+			t.Errorf("%v: unexpected error body %+v", tc.caseDesc, errResp)
+		}
+	}
+
+	var errResp models.ErrorResponse
+	if code := postFile(t, server.URL+"/api/v1/add", []byte("not json"), &errResp); code != http.StatusBadRequest {
+		t.Errorf("expected status %v for an invalid entry, got %v", http.StatusBadRequest, code)
+	}
+
+	viper.Set("rekor_server.max_upload_size", 1024)
+	defer viper.Set("rekor_server.max_upload_size", 0)
+	limited := httptest.NewServer(newRouter(api))
+	defer limited.Close()
+
+	errResp = models.ErrorResponse{}
+	if code := postFile(t, limited.URL+"/api/v1/add", bytes.Repeat([]byte("a"), 4096), &errResp); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status %v for an oversized upload, got %v", http.StatusRequestEntityTooLarge, code)
+	}
+
+	api.logClient = unavailableLogClient{logClient}
+	unavailable := httptest.NewServer(newRouter(api))
+	defer unavailable.Close()
+
+	errResp = models.ErrorResponse{}
+	if code := getError(t, unavailable.URL+"/api/v1/log/entries/range", &errResp); code != http.StatusServiceUnavailable {
+		t.Errorf("expected status %v when the log server is down, got %v", http.StatusServiceUnavailable, code)
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	type TestCase struct {
+		caseDesc string
+		err      error
+		code     int
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Bad request", err: badRequest(fmt.Errorf("invalid")), code: http.StatusBadRequest},
+		{caseDesc: "Oversized body", err: errRequestTooLarge, code: http.StatusRequestEntityTooLarge},
+		{caseDesc: "Oversized body wrapped in a bad request", err: badRequest(fmt.Errorf("reading entry: %w", errRequestTooLarge)), code: http.StatusRequestEntityTooLarge},
+		{caseDesc: "Log server unavailable", err: status.Error(codes.Unavailable, "connection refused"), code: http.StatusServiceUnavailable},
+		{caseDesc: "Unexpected error", err: fmt.Errorf("unexpected"), code: http.StatusInternalServerError},
+	}
+
+	for _, tc := range testCases {
+		if code, _ := errorStatus(tc.err); code != tc.code {
+			t.Errorf("%v: expected status %v, got %v", tc.caseDesc, tc.code, code)
+		}
+	}
+}
+
+func getError(t *testing.T, url string, v *models.ErrorResponse) int {
+	t.Helper()
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected a JSON error body from %v, got %q", url, ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		t.Fatalf("error decoding response from %v: %v", url, err)
+	}
+	return resp.StatusCode
+}
+
+// racingLogClient hides existing leaves from lookups, as if an identical leaf was queued after the duplicate check
+type racingLogClient struct {
+	*fakeLogClient
+}
+
+func (r racingLogClient) GetLeavesByHash(ctx context.Context, in *trillian.GetLeavesByHashRequest, opts ...grpc.CallOption) (*trillian.GetLeavesByHashResponse, error) {
+	return &trillian.GetLeavesByHashResponse{}, nil
+}
+
+func TestAddDuplicate(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 2)
+
+	var added models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+
+	var withSHA map[string]interface{}
+	if err := json.Unmarshal(testEntry(t), &withSHA); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	sum := sha256.Sum256(data)
+	withSHA["SHA"] = hex.EncodeToString(sum[:])
+	shaEntry, _ := json.Marshal(withSHA)
+
+	racing := httptest.NewServer(newRouter(&API{
+		tLogID:    api.tLogID,
+		logClient: racingLogClient{logClient},
+		pubkey:    api.pubkey,
+		signer:    api.signer,
+		hostname:  api.hostname,
+		index:     api.index,
+		roots:     api.roots,
+	}))
+	defer racing.Close()
+
+	type TestCase struct {
+		caseDesc string
+		url      string
+		entry    []byte
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Duplicate detected after the SHA is computed", url: server.URL, entry: testEntry(t)},
+		{caseDesc: "Duplicate detected from the SHA supplied by the client", url: server.URL, entry: shaEntry},
+		{caseDesc: "Duplicate reported by the log server", url: racing.URL, entry: testEntry(t)},
+	}
+
+	for _, tc := range testCases {
+		var errResp struct {
+			Code    int
+			Details models.ExistingEntry
+		}
+		if code := postFile(t, tc.url+"/api/v1/add", tc.entry, &errResp); code != http.StatusConflict {
+			t.Errorf("%v: expected status %v, got %v", tc.caseDesc, http.StatusConflict, code)
+			continue
+		}
+		if errResp.Details.UUID != added.UUID {
+			t.Errorf("%v: expected existing UUID %v, got %v", tc.caseDesc, added.UUID, errResp.Details.UUID)
+		}
+		if errResp.Details.LogIndex == nil || *errResp.Details.LogIndex != 2 {
+			t.Errorf("%v: expected existing log index 2, got %v", tc.caseDesc, errResp.Details.LogIndex)
+		}
+	}
+
+	if len(logClient.leaves) != 3 {
+		t.Errorf("expected 3 leaves in the log, found %d", len(logClient.leaves))
+	}
+}
+
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	server, _, api := newTestServer(t)
+
+	var doc struct {
+		Servers []struct {
+			URL string
+		}
+		Paths map[string]map[string]interface{}
+	}
+	if code := getJSON(t, server.URL+"/api/v1/openapi.json", &doc); code != http.StatusOK {
+		t.Fatalf("unexpected status %d fetching the OpenAPI document", code)
+	}
+	if len(doc.Servers) != 1 {
+		t.Fatalf("expected a single server in the OpenAPI document, found %d", len(doc.Servers))
+	}
+
+	documented := map[string]bool{}
+	for path, ops := range doc.Paths {
+		for method := range ops {
+			documented[strings.ToUpper(method)+" "+doc.Servers[0].URL+path] = true
+		}
+	}
+
+	routes := map[string]bool{}
+	walk := func(method string, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if route != "/api/v1//ping" {
+			routes[method+" "+route] = true
+		}
+		return nil
+	}
+	if err := chi.Walk(newRouter(api), walk); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(routes, documented) {
+		t.Errorf("routes %v do not match the OpenAPI document %v", routes, documented)
+	}
+}
+
+// postJSON submits content to url as an application/json request body
+func postJSON(t *testing.T, url string, content []byte, v interface{}) int {
+	t.Helper()
+
+	resp, err := http.Post(url, "application/json; charset=utf-8", bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if v != nil {
+		if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+			t.Fatalf("error decoding response from %v: %v", url, err)
+		}
+	}
+	return resp.StatusCode
+}
+
+func TestJSONRequestBodies(t *testing.T) {
+	server, logClient, _ := newTestServer(t)
+
+	var added models.AddResponse
+	if code := postJSON(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+	if len(logClient.leaves) != 1 || added.UUID != hex.EncodeToString(logClient.leaves[0].MerkleLeafHash) {
+		t.Fatalf("entry was not added to the log: %+v", added)
+	}
+
+	// the same entry uploaded as a file is a duplicate of the one submitted as JSON
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &models.ErrorResponse{}); code != http.StatusConflict {
+		t.Errorf("expected status %v adding the entry again, got %v", http.StatusConflict, code)
+	}
+
+	var leaf map[string]interface{}
+	if err := json.Unmarshal(logClient.leaves[0].LeafValue, &leaf); err != nil {
+		t.Fatal(err)
+	}
+	leafJSON, _ := json.Marshal(leaf)
+
+	var got models.GetResponse
+	if code := postJSON(t, server.URL+"/api/v1/get", leafJSON, &got); code != http.StatusOK {
+		t.Fatalf("unexpected status %d getting entry", code)
+	}
+	if len(got.Leaves) != 1 || got.Leaves[0].LeafIndex != 0 {
+		t.Errorf("unexpected leaves returned: %+v", got.Leaves)
+	}
+
+	var proof models.GetProofResponse
+	if code := postJSON(t, server.URL+"/api/v1/getproof", leafJSON, &proof); code != http.StatusOK {
+		t.Fatalf("unexpected status %d getting proof", code)
+	}
+	if proof.Proof == nil || len(proof.Proof.Proof) != 1 {
+		t.Errorf("no inclusion proof returned: %+v", proof)
+	}
+
+	if code := postJSON(t, server.URL+"/api/v1/add", []byte(`{"Data": "not base64"}`), &models.ErrorResponse{}); code != http.StatusBadRequest {
+		t.Errorf("expected status %v for an invalid entry, got %v", http.StatusBadRequest, code)
+	}
+}
+
+func TestGetEntryBundle(t *testing.T) {
+	server, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 3)
+
+	var added models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+			Leaf: &trillian.LogLeaf{LeafValue: []byte(fmt.Sprintf("leaf %d", i))},
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var bundle models.Bundle
+	if code := getJSON(t, server.URL+"/api/v1/log/entries/"+added.UUID+"/bundle", &bundle); code != http.StatusOK {
+		t.Fatalf("unexpected status %d fetching bundle", code)
+	}
+
+	leaf, err := verify.Bundle(&bundle, api.signer.Public())
+	if err != nil {
+		t.Fatalf("bundle did not verify: %v", err)
+	}
+	if bundle.LogIndex != 3 || bundle.InclusionProof.TreeSize != 6 {
+		t.Errorf("unexpected bundle for entry %v: %+v", added.UUID, bundle)
+	}
+
+	artifact, err := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := verify.Artifact(leaf, bytes.NewReader(artifact)); err != nil {
+		t.Errorf("artifact did not verify against the bundle: %v", err)
+	}
+
+	if code := getJSON(t, server.URL+"/api/v1/log/entries/"+strings.Repeat("0", 64)+"/bundle", nil); code != http.StatusNotFound {
+		t.Errorf("expected status %v for an unknown UUID, got %v", http.StatusNotFound, code)
+	}
+}
+
+// readStream returns the lines of a streaming response as they arrive
+func readStream(t *testing.T, ctx context.Context, url string, header http.Header) (int, <-chan string) {
+	t.Helper()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer resp.Body.Close()
+		defer close(lines)
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			select {
+			case lines <- scanner.Text():
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return resp.StatusCode, lines
+}
+
+func TestEntriesStream(t *testing.T) {
+	viper.Set("rekor_server.stream_poll_interval", 10*time.Millisecond)
+	defer viper.Set("rekor_server.stream_poll_interval", nil)
+
+	server, logClient, _ := newTestServer(t)
+	addTestEntries(t, logClient, 3)
+	url := server.URL + "/api/v1/log/entries/stream"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// entries already in the log are replayed from start, followed by new ones
+	code, lines := readStream(t, ctx, url+"?start=1", nil)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d opening stream", code)
+	}
+	addTestEntriesFrom(t, logClient, 3, 2)
+	for want := int64(1); want < 5; want++ {
+		var entry models.LogEntry
+		if err := json.Unmarshal([]byte(<-lines), &entry); err != nil {
+			t.Fatalf("error decoding streamed entry: %v", err)
+		}
+		if entry.LogIndex != want || entry.UUID != hex.EncodeToString(logClient.leaves[want].MerkleLeafHash) || entry.Entry == nil {
+			t.Errorf("unexpected streamed entry, expected index %d: %+v", want, entry)
+		}
+	}
+
+	// server-sent events resume after the last event ID
+	code, events := readStream(t, ctx, url, http.Header{"Accept": {"text/event-stream"}, "Last-Event-ID": {"3"}})
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d opening event stream", code)
+	}
+	addTestEntriesFrom(t, logClient, 5, 1)
+	for _, want := range []int64{4, 5} {
+		var id, event, data string
+		for line := range events {
+			if line == "" {
+				break
+			}
+			switch {
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		var entry models.LogEntry
+		if err := json.Unmarshal([]byte(data), &entry); err != nil {
+			t.Fatalf("error decoding event data %q: %v", data, err)
+		}
+		if id != fmt.Sprint(want) || event != "entry" || entry.LogIndex != want {
+			t.Errorf("unexpected event, expected index %d: id %v, event %v, entry %+v", want, id, event, entry)
+		}
+	}
+
+	// a leaf that cannot be decoded is reported in its place, both when it is published and when it is
+	// replayed, so that clients can tell it was not sent
+	if _, err := logClient.QueueLeaf(context.Background(), &trillian.QueueLeafRequest{
+		Leaf: &trillian.LogLeaf{LeafValue: []byte("not an entry")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	addTestEntriesFrom(t, logClient, 6, 1)
+	badUUID := hex.EncodeToString(rfc6962.DefaultHasher.HashLeaf([]byte("not an entry")))
+	_, replayed := readStream(t, ctx, url+"?start=5", nil)
+	for name, stream := range map[string]<-chan string{"published": lines, "replayed": replayed} {
+		for _, want := range []int64{5, 6, 7} {
+			var entry struct {
+				models.LogEntry
+				Error string
+			}
+			if err := json.Unmarshal([]byte(<-stream), &entry); err != nil {
+				t.Fatalf("error decoding %v entry: %v", name, err)
+			}
+			if entry.LogIndex != want || (want == 6) != (entry.Error != "") {
+				t.Errorf("unexpected %v entry, expected index %d: %+v", name, want, entry)
+			}
+			if want == 6 && (entry.UUID != badUUID || entry.Entry != nil) {
+				t.Errorf("unexpected %v error for an undecodable leaf: %+v", name, entry)
+			}
+		}
+	}
+
+	// and as an error event to clients of server-sent events
+	_, events = readStream(t, ctx, url+"?start=6", http.Header{"Accept": {"text/event-stream"}})
+	var errorEvent []string
+	for line := range events {
+		if line == "" {
+			break
+		}
+		errorEvent = append(errorEvent, line)
+	}
+	if len(errorEvent) != 3 || errorEvent[0] != "id: 6" || errorEvent[1] != "event: error" || !strings.Contains(errorEvent[2], badUUID) {
+		t.Errorf("unexpected event for an undecodable leaf: %q", errorEvent)
+	}
+
+	for _, query := range []string{"?start=-1", "?start=abc"} {
+		if code := getJSON(t, url+query, nil); code != http.StatusBadRequest {
+			t.Errorf("expected status 400 for query %q, got %d", query, code)
+		}
+	}
+}
+
+func TestEntriesStreamCatchUp(t *testing.T) {
+	viper.Set("rekor_server.stream_poll_interval", 10*time.Millisecond)
+	defer viper.Set("rekor_server.stream_poll_interval", nil)
+
+	server, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 3)
+
+	// a client behind the feed is not attached to it until it has read up to it from the log
+	if ch, next, err := api.feed.subscribe(1); err != nil || ch != nil || next != 3 {
+		t.Errorf("expected a client from index 1 to read up to index 3 first, got %v, %d (%v)", ch, next, err)
+	}
+	ch, next, err := api.feed.subscribe(3)
+	if err != nil || ch == nil || next != 3 {
+		t.Fatalf("expected a client from index 3 to be attached, got %v, %d (%v)", ch, next, err)
+	}
+	api.feed.unsubscribe(ch)
+
+	// a client that falls behind the feed is sent what it missed from the log rather than disconnected
+	api.feed.buffer = 1
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	code, lines := readStream(t, ctx, server.URL+"/api/v1/log/entries/stream?start=0", nil)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d opening stream", code)
+	}
+	addTestEntriesFrom(t, logClient, 3, 300)
+	for want := int64(0); want < 303; want++ {
+		var entry models.LogEntry
+		line, ok := <-lines
+		if !ok {
+			t.Fatalf("stream ended before entry %d", want)
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("error decoding streamed entry: %v", err)
+		}
+		if entry.LogIndex != want {
+			t.Fatalf("expected entry %d, got %d", want, entry.LogIndex)
+		}
+	}
+}
+
+func TestShutdownWithStreamingClient(t *testing.T) {
+	_, logClient, api := newTestServer(t)
+	addTestEntries(t, logClient, 1)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := newServer(api, listener.Addr().String())
+	served := make(chan error, 1)
+	go func() {
+		served <- srv.Serve(listener)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	code, lines := readStream(t, ctx, "http://"+listener.Addr().String()+"/api/v1/log/entries/stream", nil)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status %d opening stream", code)
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(ctx, 5*time.Second)
+	defer cancelShutdown()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("error shutting down with a streaming client connected: %v", err)
+	}
+	if err := <-served; err != http.ErrServerClosed {
+		t.Errorf("unexpected error from the stopped server: %v", err)
+	}
+	for range lines {
+	}
+	if ctx.Err() != nil {
+		t.Errorf("stream was not ended by the shutdown")
+	}
+	if _, _, err := api.feed.subscribe(-1); err == nil {
+		t.Errorf("expected an error subscribing to a closed feed")
+	}
+}
+
+func TestAddWebhooks(t *testing.T) {
+	server, _, api := newTestServer(t)
+	secret := []byte("test secret")
+
+	events := make(chan webhook.Event, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		if !webhook.VerifySignature(secret, body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("invalid webhook signature")
+		}
+		var event webhook.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Error(err)
+		}
+		events <- event
+	}))
+	defer receiver.Close()
+
+	dispatcher, err := webhook.New(webhook.Config{
+		URLs:       []string{receiver.URL},
+		Secret:     secret,
+		OutboxPath: t.TempDir() + "/outbox.db",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dispatcher.Close()
+	api.webhooks = dispatcher
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go dispatcher.Run(ctx)
+
+	var added models.AddResponse
+	if code := postFile(t, server.URL+"/api/v1/add", testEntry(t), &added); code != http.StatusOK {
+		t.Fatalf("unexpected status %d adding entry", code)
+	}
+	if err := api.checkIntegrated(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{webhook.EntryQueued, webhook.EntryIntegrated} {
+		select {
+		case event := <-events:
+			if event.Type != want || event.UUID != added.UUID || event.SHA == "" || len(event.Fingerprints) == 0 {
+				t.Errorf("unexpected %v event: %+v", want, event)
+			}
+			if want == webhook.EntryIntegrated && (event.LogIndex == nil || *event.LogIndex != 0) {
+				t.Errorf("integrated event has wrong log index: %+v", event)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for %v event", want)
+		}
+	}
+
+	if pending, err := dispatcher.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("expected no entries awaiting integration, got %v (%v)", pending, err)
+	}
+}
+
+func TestAddFromURL(t *testing.T) {
+	server, _, _ := newTestServer(t)
+
+	var fetched int
+	artifact := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetched++
+		http.ServeFile(w, r, "../pki/testdata/hello_world.txt")
+	}))
+	defer artifact.Close()
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(testEntry(t), &entry); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	sum := sha256.Sum256(data)
+	delete(entry, "Data")
+	entry["URL"] = artifact.URL
+	entry["SHA"] = hex.EncodeToString(sum[:])
+	content, _ := json.Marshal(entry)
+
+	// the artifact server is on a loopback address, which the server refuses to fetch from by default
+	if code := postJSON(t, server.URL+"/api/v1/add", content, nil); code != http.StatusBadRequest || fetched != 0 {
+		t.Errorf("expected fetching from a loopback address to be refused, got status %d after %d requests", code, fetched)
+	}
+
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	var added models.AddResponse
+	if code := postJSON(t, server.URL+"/api/v1/add", content, &added); code != http.StatusOK || fetched != 1 {
+		t.Errorf("unexpected status %d adding entry from URL after %d requests", code, fetched)
+	}
+}
+
+func TestAddFetchErrors(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	server, _, _ := newTestServer(t)
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+		case "/missing":
+			http.NotFound(w, r)
+		case "/failing":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/unavailable":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			http.ServeFile(w, r, "../pki/testdata/hello_world.txt")
+		}
+	}))
+	defer upstream.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+
+	var inline map[string]interface{}
+	if err := json.Unmarshal(testEntry(t), &inline); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	sum := sha256.Sum256(data)
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	_, _ = zw.Write(data)
+	zw.Close()
+
+	type TestCase struct {
+		caseDesc     string
+		entry        map[string]interface{}
+		setting      string
+		value        interface{}
+		expectedCode int
+	}
+
+	fromURL := func(url string) map[string]interface{} {
+		return map[string]interface{}{"URL": url, "SHA": hex.EncodeToString(sum[:]), "Signature": inline["Signature"], "PublicKey": inline["PublicKey"]}
+	}
+	testCases := []TestCase{
+		{caseDesc: "Upstream timeout", entry: fromURL(upstream.URL + "/slow"), setting: "fetch.timeout", value: 100 * time.Millisecond, expectedCode: http.StatusGatewayTimeout},
+		{caseDesc: "Connection refused", entry: fromURL(closed.URL + "/artifact"), expectedCode: http.StatusBadGateway},
+		{caseDesc: "Upstream error", entry: fromURL(upstream.URL + "/failing"), expectedCode: http.StatusBadGateway},
+		{caseDesc: "Upstream unavailable", entry: fromURL(upstream.URL + "/unavailable"), expectedCode: http.StatusServiceUnavailable},
+		{caseDesc: "Missing content", entry: fromURL(upstream.URL + "/missing"), expectedCode: http.StatusBadRequest},
+		{caseDesc: "Content over the fetch limit", entry: fromURL(upstream.URL + "/artifact"), setting: "fetch.max_size", value: 4, expectedCode: http.StatusRequestEntityTooLarge},
+		{caseDesc: "Content over the decompression limit", entry: map[string]interface{}{"Data": compressed.Bytes(), "Decompress": true, "Signature": inline["Signature"], "PublicKey": inline["PublicKey"]}, setting: "decompress.max_size", value: 4, expectedCode: http.StatusRequestEntityTooLarge},
+		{caseDesc: "Content fetched", entry: fromURL(upstream.URL + "/artifact"), expectedCode: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		if tc.setting != "" {
+			viper.Set(tc.setting, tc.value)
+		}
+		content, _ := json.Marshal(tc.entry)
+		var errResp models.ErrorResponse
+		code := postJSON(t, server.URL+"/api/v1/add", content, &errResp)
+		if tc.setting != "" {
+			viper.Set(tc.setting, nil)
+		}
+		if code != tc.expectedCode {
+			t.Errorf("%v: expected status %d, got %d: %v", tc.caseDesc, tc.expectedCode, code, errResp.Message)
+		}
+	}
+}
+
+func TestAddWithSignatureAndKeyURLs(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	server, _, _ := newTestServer(t)
+
+	files := httptest.NewServer(http.FileServer(http.Dir("../pki/testdata")))
+	defer files.Close()
+
+	var inline map[string]interface{}
+	if err := json.Unmarshal(testEntry(t), &inline); err != nil {
+		t.Fatal(err)
+	}
+
+	type TestCase struct {
+		caseDesc     string
+		signature    bool
+		publicKey    bool
+		signatureURL string
+		publicKeyURL string
+		expectedCode int
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Neither signature nor signature URL", publicKey: true, expectedCode: http.StatusBadRequest},
+		{caseDesc: "Both public key and public key URL", signature: true, publicKey: true, publicKeyURL: "/valid_armored_public.pgp", expectedCode: http.StatusBadRequest},
+		{caseDesc: "Missing signature", publicKey: true, signatureURL: "/missing.sig", expectedCode: http.StatusBadRequest},
+		{caseDesc: "Key that did not make the signature", signature: true, publicKeyURL: "/valid_armored_complex_public.pgp", expectedCode: http.StatusBadRequest},
+		{caseDesc: "Signature and key by URL", signatureURL: "/hello_world.txt.asc.sig", publicKeyURL: "/valid_armored_public.pgp", expectedCode: http.StatusOK},
+		// the fetched signature and key are stored as if they had been submitted inline
+		{caseDesc: "Same entry submitted inline", signature: true, publicKey: true, expectedCode: http.StatusConflict},
+	}
+
+	for _, tc := range testCases {
+		entry := map[string]interface{}{"Data": inline["Data"]}
+		if tc.signature {
+			entry["Signature"] = inline["Signature"]
+		}
+		if tc.publicKey {
+			entry["PublicKey"] = inline["PublicKey"]
+		}
+		if tc.signatureURL != "" {
+			entry["SignatureURL"] = files.URL + tc.signatureURL
+		}
+		if tc.publicKeyURL != "" {
+			entry["PublicKeyURL"] = files.URL + tc.publicKeyURL
+		}
+		content, _ := json.Marshal(entry)
+
+		if code := postJSON(t, server.URL+"/api/v1/add", content, nil); code != tc.expectedCode {
+			t.Errorf("%v: expected status %d, got %d", tc.caseDesc, tc.expectedCode, code)
+		}
+	}
+}
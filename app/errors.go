@@ -0,0 +1,199 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/projectrekor/rekor-server/fetch"
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiError is an error that is reported to the client with a specific HTTP status
+type apiError struct {
+	code    int
+	message string
+	details interface{}
+	err     error
+}
+
+func (e *apiError) Error() string {
+	if e.err != nil {
+		return fmt.Sprintf("%s: %v", e.message, e.err)
+	}
+	return e.message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.err
+}
+
+// badRequest reports a request that failed validation
+func badRequest(err error) error {
+	return &apiError{code: http.StatusBadRequest, message: err.Error(), err: err}
+}
+
+// notFound reports that the requested entry does not exist
+func notFound(message string) error {
+	return &apiError{code: http.StatusNotFound, message: message}
+}
+
+// conflict reports that the submitted entry is already in the log; details identifies the existing entry
+func conflict(message string, details interface{}) error {
+	return &apiError{code: http.StatusConflict, message: message, details: details}
+}
+
+// inconsistentRoot reports that the root hash the caller gave for a tree size is not consistent with the
+// log, so the caller's checkpoint and the log have forked
+func inconsistentRoot(treeSize int64, err error) error {
+	return &apiError{
+		code:    http.StatusConflict,
+		message: fmt.Sprintf("root hash given for tree size %d is not consistent with the log", treeSize),
+		details: map[string]int64{"TreeSize": treeSize},
+		err:     err,
+	}
+}
+
+// loadError reports a failure to load a submitted entry. Content that could not be fetched is reported
+// as the failure of the server it was fetched from, and content over a size limit as too large; any
+// other failure means the entry is invalid
+func loadError(err error) error {
+	var fetchErr *fetch.Error
+	switch {
+	case errors.Is(err, fetch.ErrTooLarge), errors.Is(err, types.ErrDecompressionLimit):
+		return &apiError{code: http.StatusRequestEntityTooLarge, message: err.Error(), err: err}
+	case errors.As(err, &fetchErr):
+		switch {
+		case fetchErr.Timeout():
+			return &apiError{code: http.StatusGatewayTimeout, message: err.Error(), err: err}
+		case fetchErr.StatusCode == http.StatusServiceUnavailable || fetchErr.StatusCode == http.StatusTooManyRequests:
+			return &apiError{code: http.StatusServiceUnavailable, message: err.Error(), err: err}
+		case fetchErr.StatusCode/100 == 4:
+			// the entry named content that does not exist or cannot be read
+			return badRequest(err)
+		}
+		return &apiError{code: http.StatusBadGateway, message: err.Error(), err: err}
+	}
+	return badRequest(err)
+}
+
+// errorStatus determines the HTTP status and client facing message for err
+func errorStatus(err error) (int, string) {
+	// checked first, as handlers may have wrapped the error from reading the body in a bad request
+	if errors.Is(err, errRequestTooLarge) {
+		return http.StatusRequestEntityTooLarge, errRequestTooLarge.Error()
+	}
+
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return apiErr.code, apiErr.message
+	}
+
+	// errors from the Trillian log server carry a gRPC status
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.InvalidArgument, codes.OutOfRange:
+			return http.StatusBadRequest, s.Message()
+		case codes.NotFound:
+			return http.StatusNotFound, s.Message()
+		case codes.AlreadyExists:
+			return http.StatusConflict, s.Message()
+		case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+			return http.StatusServiceUnavailable, "log server is unavailable, retry later"
+		}
+	}
+
+	return http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := errorStatus(err)
+	if code >= http.StatusInternalServerError {
+		logging.RequestIDLogger(r).Error(err)
+	} else {
+		logging.RequestIDLogger(r).Info(err)
+	}
+
+	resp := models.ErrorResponse{
+		Code:      code,
+		Message:   message,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		resp.Details = apiErr.details
+	}
+
+	body, _ := json.Marshal(resp)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_, _ = w.Write(body)
+}
+
+var errRequestTooLarge = errors.New("request body exceeds the maximum upload size")
+
+// limitedBody fails reads with errRequestTooLarge once more than limit bytes have been read
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, errRequestTooLarge
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	// read one byte past the limit so a body of exactly the limit is not rejected
+	if int64(len(p))-1 > l.remaining {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	if int64(n) <= l.remaining {
+		l.remaining -= int64(n)
+		return n, err
+	}
+	n = int(l.remaining)
+	l.remaining = -1
+	return n, errRequestTooLarge
+}
+
+// limitRequestBody rejects request bodies larger than limit bytes
+func limitRequestBody(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				writeError(w, r, errRequestTooLarge)
+				return
+			}
+			if r.Body != nil {
+				r.Body = &limitedBody{ReadCloser: r.Body, remaining: limit}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
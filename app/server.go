@@ -22,6 +22,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"time"
 
 	"github.com/projectrekor/rekor-server/logging"
 	"github.com/spf13/viper"
@@ -30,11 +31,12 @@ import (
 // Server provides an http.Server.
 type Server struct {
 	*http.Server
+	api *API
 }
 
 // NewServer creates and configures an APIServer serving all application routes.
 func NewServer() (*Server, error) {
-	api, err := New()
+	api, err := NewAPI()
 	if err != nil {
 		return nil, err
 	}
@@ -43,12 +45,26 @@ func NewServer() (*Server, error) {
 		viper.GetString("rekor_server.address"),
 		viper.GetUint("rekor_server.port"))
 
+	return newServer(api, addr), nil
+}
+
+func newServer(api *API, addr string) *Server {
 	srv := http.Server{
 		Addr:    addr,
-		Handler: api,
+		Handler: newRouter(api),
 	}
+	// Shutdown waits for connections to go idle, which streaming connections never do
+	srv.RegisterOnShutdown(api.feed.Close)
+
+	return &Server{&srv, api}
+}
 
-	return &Server{&srv}, nil
+// shutdownTimeout is how long the server waits for requests in progress to complete when it stops
+func shutdownTimeout() time.Duration {
+	if timeout := viper.GetDuration("rekor_server.shutdown_timeout"); timeout > 0 {
+		return timeout
+	}
+	return 30 * time.Second
 }
 
 func (srv *Server) Start() {
@@ -65,8 +81,14 @@ func (srv *Server) Start() {
 	sig := <-quit
 	logging.Logger.Info("Shutting down server... Reason:", sig)
 
-	if err := srv.Shutdown(context.Background()); err != nil {
-		panic(err)
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout())
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logging.Logger.Errorf("Error shutting down server, closing remaining connections: %v", err)
+		_ = srv.Close()
+	}
+	if err := srv.api.Close(); err != nil {
+		logging.Logger.Errorf("Error closing API: %v", err)
 	}
 	logging.Logger.Info("Server gracefully stopped")
 }
@@ -0,0 +1,45 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+
+	"github.com/google/trillian/crypto/keys/pem"
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/spf13/viper"
+)
+
+// newSigner loads the key rekor-server uses to sign checkpoints and other statements about the log.
+// An ephemeral key is only generated when rekor_server.ephemeral_signing_key is set, as nothing signed
+// with it can be verified after a restart and clients that pinned it will report the new key.
+func newSigner() (crypto.Signer, error) {
+	keyPath := viper.GetString("rekor_server.signing_key")
+	if keyPath != "" {
+		return pem.ReadPrivateKeyFile(keyPath, viper.GetString("rekor_server.signing_key_password"))
+	}
+	if !viper.GetBool("rekor_server.ephemeral_signing_key") {
+		return nil, errors.New("rekor_server.signing_key is required; set rekor_server.ephemeral_signing_key to generate a throwaway key for testing")
+	}
+
+	logging.Logger.Warn("Generating an ephemeral signing key; nothing it signs can be verified after a restart")
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
@@ -0,0 +1,391 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/google/trillian"
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/spf13/viper"
+)
+
+const (
+	// streamPageSize is the number of leaves fetched from Trillian at a time by the feed
+	streamPageSize = 100
+	// subscriberBuffer is the number of entries a streaming client may fall behind the feed by before it
+	// goes back to reading entries from the log
+	subscriberBuffer = 1024
+	// streamHeartbeat is how often an idle event stream is sent a comment to keep it open
+	streamHeartbeat = 15 * time.Second
+)
+
+// streamPollInterval is how often the feed checks the tree size for new entries
+func streamPollInterval() time.Duration {
+	if interval := viper.GetDuration("rekor_server.stream_poll_interval"); interval > 0 {
+		return interval
+	}
+	return time.Second
+}
+
+// streamedEntry is an entry as it is written to streaming clients. It is encoded once, when it is read
+// from the log, as encoding the public keys of some entries is not safe for concurrent use.
+type streamedEntry struct {
+	logIndex int64
+	// event is "entry" for a LogEntry, or "error" for an EntryError reporting a leaf that could not be
+	// decoded, so that clients can tell that an index was not sent as an entry
+	event string
+	data  []byte
+	err   error
+}
+
+func encodeStreamedEntry(leaf *trillian.LogLeaf) streamedEntry {
+	entry, err := decodeLogEntry(leaf)
+	if err == nil {
+		var data []byte
+		if data, err = json.Marshal(entry); err == nil {
+			return streamedEntry{logIndex: leaf.LeafIndex, event: "entry", data: data}
+		}
+	}
+	data, _ := json.Marshal(models.EntryError{
+		UUID:     entryUUID(hashLeaf(leaf)),
+		LogIndex: leaf.LeafIndex,
+		Error:    err.Error(),
+	})
+	return streamedEntry{logIndex: leaf.LeafIndex, event: "error", data: data, err: err}
+}
+
+// entryFeed polls Trillian for newly integrated entries and fans them out to the streaming clients,
+// so that any number of clients cost a single poller. The poller only runs while there are clients.
+type entryFeed struct {
+	server   *trillianclient
+	interval time.Duration
+	// buffer is the number of entries each subscriber may fall behind by
+	buffer int
+
+	mu          sync.Mutex
+	subscribers map[chan streamedEntry]struct{}
+	next        int64 // index of the next entry to be published
+	stop        context.CancelFunc
+	closed      bool
+	// polling waits for the poller goroutines to return
+	polling sync.WaitGroup
+}
+
+func newEntryFeed(server *trillianclient, interval time.Duration) *entryFeed {
+	return &entryFeed{
+		server:      server,
+		interval:    interval,
+		buffer:      subscriberBuffer,
+		subscribers: map[chan streamedEntry]struct{}{},
+	}
+}
+
+// subscribe returns a channel receiving every entry published from the returned index onwards, which
+// is start unless start is negative. A subscriber is only attached once it has caught up with the feed:
+// while start is before the next entry to be published, no channel is returned, and the caller reads
+// up to the returned index from the log before subscribing again. The channel is closed if the
+// subscriber falls too far behind or the feed is closed.
+func (f *entryFeed) subscribe(start int64) (chan streamedEntry, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.closed {
+		return nil, 0, &apiError{code: http.StatusServiceUnavailable, message: "server is shutting down"}
+	}
+	if f.stop == nil {
+		root, err := f.server.root()
+		if err != nil {
+			return nil, 0, err
+		}
+		if start >= 0 && start < int64(root.TreeSize) {
+			return nil, int64(root.TreeSize), nil
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		f.next = int64(root.TreeSize)
+		f.stop = cancel
+		f.polling.Add(1)
+		go func() {
+			defer f.polling.Done()
+			f.poll(ctx)
+		}()
+	} else if start >= 0 && start < f.next {
+		return nil, f.next, nil
+	}
+
+	ch := make(chan streamedEntry, f.buffer)
+	f.subscribers[ch] = struct{}{}
+	if start < 0 {
+		start = f.next
+	}
+	return ch, start, nil
+}
+
+func (f *entryFeed) unsubscribe(ch chan streamedEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.remove(ch)
+}
+
+// remove closes and forgets a subscriber, stopping the poller after the last one; f.mu must be held
+func (f *entryFeed) remove(ch chan streamedEntry) {
+	if _, ok := f.subscribers[ch]; !ok {
+		return
+	}
+	delete(f.subscribers, ch)
+	close(ch)
+	if len(f.subscribers) == 0 && f.stop != nil {
+		f.stop()
+		f.stop = nil
+	}
+}
+
+// Close disconnects every streaming client and waits for the poller to stop. Streams never go idle, so
+// the server calls it on shutdown; later subscriptions fail.
+func (f *entryFeed) Close() {
+	f.mu.Lock()
+	f.closed = true
+	for ch := range f.subscribers {
+		f.remove(ch)
+	}
+	f.mu.Unlock()
+	f.polling.Wait()
+}
+
+func (f *entryFeed) isClosed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *entryFeed) poll(ctx context.Context) {
+	ticker := time.NewTicker(f.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := f.publishNew(ctx); err != nil {
+				logging.Logger.Warnf("polling for new entries: %v", err)
+			}
+		}
+	}
+}
+
+// publishNew sends the entries integrated since the last poll to every subscriber
+func (f *entryFeed) publishNew(ctx context.Context) error {
+	f.mu.Lock()
+	next := f.next
+	f.mu.Unlock()
+
+	for {
+		resp, err := f.server.getLeavesByRange(next, streamPageSize)
+		if err != nil {
+			return err
+		}
+		leaves := resp.getLeavesByRangeResult.GetLeaves()
+		if len(leaves) == 0 {
+			return nil
+		}
+
+		for _, leaf := range leaves {
+			entry := encodeStreamedEntry(leaf)
+
+			f.mu.Lock()
+			// a poller stopped while it was fetching must not publish, as a new one may have started
+			if ctx.Err() != nil || leaf.LeafIndex != f.next {
+				f.mu.Unlock()
+				return nil
+			}
+			if entry.err != nil {
+				// reported to subscribers rather than retried, as it would stall the feed for every one
+				logging.Logger.Errorf("sending error event for leaf in entry stream: %v", entry.err)
+			}
+			for ch := range f.subscribers {
+				select {
+				case ch <- entry:
+				default:
+					f.remove(ch)
+				}
+			}
+			f.next++
+			next = f.next
+			f.mu.Unlock()
+		}
+	}
+}
+
+// getEntriesStreamHandler streams each entry as it is integrated into the log, as server-sent events
+// if the client accepts text/event-stream and as newline delimited JSON otherwise. A leaf that cannot
+// be decoded is sent as an EntryError, in an error event or as a JSON object with an Error field. A
+// client resumes from an index with the start parameter, or with the Last-Event-ID header for
+// server-sent events.
+func (f *entryFeed) getEntriesStreamHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	r = r.WithContext(logging.WithRequestID(ctx, middleware.GetReqID(ctx)))
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, r, errors.New("streaming is not supported by the connection"))
+		return
+	}
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+
+	start := int64(-1)
+	if s := r.URL.Query().Get("start"); s != "" {
+		var err error
+		if start, err = strconv.ParseInt(s, 10, 64); err != nil || start < 0 {
+			writeError(w, r, badRequest(fmt.Errorf("invalid start index '%v'", s)))
+			return
+		}
+	} else if id := r.Header.Get("Last-Event-ID"); sse && id != "" {
+		last, err := strconv.ParseInt(id, 10, 64)
+		if err != nil || last < 0 {
+			writeError(w, r, badRequest(fmt.Errorf("invalid Last-Event-ID '%v'", id)))
+			return
+		}
+		start = last + 1
+	}
+
+	ch, next, err := f.subscribe(start)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	defer func() {
+		if ch != nil {
+			f.unsubscribe(ch)
+		}
+	}()
+	if start < 0 {
+		start = next
+	}
+
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	write := func(entry streamedEntry) error {
+		var err error
+		if sse {
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", entry.logIndex, entry.event, entry.data)
+		} else {
+			_, err = fmt.Fprintf(w, "%s\n", entry.data)
+		}
+		flusher.Flush()
+		return err
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		// a client behind the feed reads from the log until it has caught up, and is only attached to the
+		// feed then, so that it is not disconnected for falling behind while it catches up
+		for ch == nil {
+			if start, err = f.replay(r, start, next, write); err != nil {
+				return
+			}
+			if ch, next, err = f.subscribe(start); err != nil {
+				logging.RequestIDLogger(r).Info(err)
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			if sse {
+				_, _ = fmt.Fprint(w, ": keepalive\n\n")
+				flusher.Flush()
+			}
+		case entry, ok := <-ch:
+			if !ok {
+				if f.isClosed() {
+					logging.RequestIDLogger(r).Info("disconnecting streaming client as the server is shutting down")
+					return
+				}
+				// a client that fell behind the feed goes back to reading from the log
+				ch, next = nil, start
+				continue
+			}
+			if entry.logIndex < start {
+				continue
+			}
+			if err := write(entry); err != nil {
+				return
+			}
+			start = entry.logIndex + 1
+		}
+	}
+}
+
+// replay writes the entries from start up to next read from the log, returning the index of the next
+// entry to write. It fails if the client goes away, or the log does not return the entries.
+func (f *entryFeed) replay(r *http.Request, start, next int64, write func(streamedEntry) error) (int64, error) {
+	for start < next {
+		if err := r.Context().Err(); err != nil {
+			return start, err
+		}
+		resp, err := f.server.getLeavesByRange(start, streamPageSize)
+		if err != nil {
+			logging.RequestIDLogger(r).Error(err)
+			return start, err
+		}
+		leaves := resp.getLeavesByRangeResult.GetLeaves()
+		if len(leaves) == 0 {
+			err := fmt.Errorf("log returned no entries from index %d of %d", start, next)
+			logging.RequestIDLogger(r).Error(err)
+			return start, err
+		}
+		for _, leaf := range leaves {
+			if start >= next {
+				break
+			}
+			if leaf.LeafIndex != start {
+				err := fmt.Errorf("log returned entry %d in place of %d", leaf.LeafIndex, start)
+				logging.RequestIDLogger(r).Error(err)
+				return start, err
+			}
+			entry := encodeStreamedEntry(leaf)
+			if entry.err != nil {
+				logging.RequestIDLogger(r).Errorf("sending error event for leaf in entry stream: %v", entry.err)
+			}
+			if err := write(entry); err != nil {
+				return start, err
+			}
+			start++
+		}
+	}
+	return start, nil
+}
@@ -17,8 +17,13 @@ limitations under the License.
 package app
 
 import (
+	"bytes"
 	"context"
+	"crypto"
+	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
@@ -26,11 +31,14 @@ import (
 
 	"github.com/google/trillian"
 	"github.com/google/trillian/client"
+	tcrypto "github.com/google/trillian/crypto"
+	"github.com/google/trillian/crypto/keys/der"
 	"github.com/google/trillian/crypto/keyspb"
 	"github.com/google/trillian/crypto/sigpb"
 	"github.com/google/trillian/merkle"
 	"github.com/google/trillian/merkle/rfc6962"
 	"github.com/google/trillian/types"
+	bolt "go.etcd.io/bbolt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -38,35 +46,61 @@ import (
 type trillianclient struct {
 	client trillian.TrillianLogClient
 	logID  int64
+	pubkey *keyspb.PublicKey
+	roots  *rootHistory
 }
 
 type Response struct {
-	status               codes.Code
-	getLeafResult        *trillian.GetLeavesByHashResponse
-	getProofResult       *trillian.GetInclusionProofByHashResponse
-	getLeafByIndexResult *trillian.GetLeavesByIndexResponse
-	getLatestResult      *trillian.GetLatestSignedLogRootResponse
-}
-
-func serverInstance(client trillian.TrillianLogClient, tLogID int64) *trillianclient {
-	return &trillianclient{
-		client: client,
-		logID:  tLogID,
-	}
+	status                 codes.Code
+	queuedLeaf             *trillian.QueuedLogLeaf
+	getLeafResult          *trillian.GetLeavesByHashResponse
+	getProofResult         *trillian.GetInclusionProofByHashResponse
+	getLeafByIndexResult   *trillian.GetLeavesByIndexResponse
+	getLatestResult        *trillian.GetLatestSignedLogRootResponse
+	getEntryResult         *trillian.GetEntryAndProofResponse
+	getLeavesByRangeResult *trillian.GetLeavesByRangeResponse
+	root                   types.LogRootV1
+	getConsistencyResult   *trillian.GetConsistencyProofResponse
+	firstRootHash          []byte
+	lastRootHash           []byte
+	lastTreeSize           int64
 }
 
 func (s *trillianclient) root() (types.LogRootV1, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
 	rqst := &trillian.GetLatestSignedLogRootRequest{
 		LogId: s.logID,
 	}
-	resp, err := s.client.GetLatestSignedLogRoot(context.Background(), rqst)
+	resp, err := s.client.GetLatestSignedLogRoot(ctx, rqst)
 	if err != nil {
 		return types.LogRootV1{}, err
 	}
-	var root types.LogRootV1
-	if err := root.UnmarshalBinary(resp.SignedLogRoot.LogRoot); err != nil {
+	root, err := s.verifyRoot(resp.GetSignedLogRoot())
+	if err != nil {
 		return types.LogRootV1{}, err
 	}
+	return *root, nil
+}
+
+// verifyRoot checks the signature on a log root returned by Trillian against the tree key and records the
+// root in the history consistency proofs are checked against
+func (s *trillianclient) verifyRoot(slr *trillian.SignedLogRoot) (*types.LogRootV1, error) {
+	if slr == nil {
+		return nil, errors.New("no signed log root returned")
+	}
+	key, err := der.UnmarshalPublicKey(s.pubkey.GetDer())
+	if err != nil {
+		return nil, fmt.Errorf("parsing tree public key: %w", err)
+	}
+	root, err := tcrypto.VerifySignedLogRoot(key, crypto.SHA256, slr)
+	if err != nil {
+		return nil, fmt.Errorf("verifying signed log root: %w", err)
+	}
+	if err := s.roots.add(root.TreeSize, root.RootHash); err != nil {
+		return nil, err
+	}
 	return root, nil
 }
 
@@ -80,11 +114,12 @@ func (s *trillianclient) addLeaf(byteValue []byte, tLogID int64) (*Response, err
 	}
 	resp, err := s.client.QueueLeaf(context.Background(), rqst)
 	if err != nil {
-		fmt.Println(err)
+		return &Response{}, err
 	}
 
 	return &Response{
-		status: codes.Code(resp.QueuedLeaf.GetStatus().GetCode()),
+		status:     codes.Code(resp.QueuedLeaf.GetStatus().GetCode()),
+		queuedLeaf: resp.QueuedLeaf,
 	}, nil
 }
 
@@ -99,11 +134,30 @@ func (s *trillianclient) getLeaf(byteValue []byte, tlog_id int64) (*Response, er
 
 	resp, err := s.client.GetLeavesByHash(context.Background(), rqst)
 	if err != nil {
-		logging.Logger.Fatal(err)
+		return &Response{status: status.Code(err)}, err
 	}
 
 	return &Response{
-		status:        status.Code(err),
+		status:        codes.OK,
+		getLeafResult: resp,
+	}, nil
+}
+
+// getLeavesByHashes returns the integrated leaves with the given Merkle leaf hashes
+func (s *trillianclient) getLeavesByHashes(leafHashes [][]byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	resp, err := s.client.GetLeavesByHash(ctx, &trillian.GetLeavesByHashRequest{
+		LogId:    s.logID,
+		LeafHash: leafHashes,
+	})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
+
+	return &Response{
+		status:        codes.OK,
 		getLeafResult: resp,
 	}, nil
 }
@@ -118,6 +172,9 @@ func (s *trillianclient) getLeafByIndex(tLogID int64, leafSizeInt int64) (*Respo
 			LogId:     tLogID,
 			LeafIndex: []int64{leafSizeInt},
 		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
 
 	return &Response{
 		status:               status.Code(err),
@@ -143,6 +200,9 @@ func (s *trillianclient) getProof(byteValue []byte, tLogID int64) (*Response, er
 			LeafHash: leafHash,
 			TreeSize: int64(root.TreeSize),
 		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
 
 	v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
 
@@ -174,6 +234,12 @@ func (s *trillianclient) getLatest(tLogID int64, leafSizeInt int64) (*Response,
 			LogId:         tLogID,
 			FirstTreeSize: leafSizeInt,
 		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
+	if _, err := s.verifyRoot(resp.GetSignedLogRoot()); err != nil {
+		return &Response{}, err
+	}
 
 	return &Response{
 		status:          status.Code(err),
@@ -181,6 +247,310 @@ func (s *trillianclient) getLatest(tLogID int64, leafSizeInt int64) (*Response,
 	}, nil
 }
 
+// getLeafAndProofByIndex fetches a leaf along with an inclusion proof against the current tree head,
+// verifying the proof before it is returned
+func (s *trillianclient) getLeafAndProofByIndex(index int64) (*Response, error) {
+	return s.getLeafAndProof(index, nil)
+}
+
+// getLeafAndProof is getLeafAndProofByIndex, additionally checking that the leaf's value hashes to
+// wantHash when it is set
+func (s *trillianclient) getLeafAndProof(index int64, wantHash []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	root, err := s.root()
+	if err != nil {
+		return &Response{}, err
+	}
+	if index < 0 || uint64(index) >= root.TreeSize {
+		return &Response{status: codes.NotFound}, nil
+	}
+
+	resp, err := s.client.GetEntryAndProof(ctx,
+		&trillian.GetEntryAndProofRequest{
+			LogId:     s.logID,
+			LeafIndex: index,
+			TreeSize:  int64(root.TreeSize),
+		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
+	if resp.GetLeaf() == nil || resp.GetProof() == nil {
+		return &Response{status: codes.NotFound}, nil
+	}
+
+	// the proof is checked for the hash of the value being returned, not the hash Trillian reports for it
+	leafHash := hashLeaf(resp.Leaf)
+	if len(resp.Leaf.MerkleLeafHash) != 0 && !bytes.Equal(leafHash, resp.Leaf.MerkleLeafHash) {
+		return &Response{}, fmt.Errorf("leaf at index %d has hash %x, not the %x reported by the log", index, leafHash, resp.Leaf.MerkleLeafHash)
+	}
+	if wantHash != nil && !bytes.Equal(leafHash, wantHash) {
+		return &Response{}, fmt.Errorf("leaf at index %d has hash %x, not the %x requested", index, leafHash, wantHash)
+	}
+	v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
+	if err := v.VerifyInclusionProof(index, int64(root.TreeSize), resp.Proof.GetHashes(), root.RootHash, leafHash); err != nil {
+		return &Response{}, err
+	}
+
+	return &Response{
+		status:         codes.OK,
+		getEntryResult: resp,
+		root:           root,
+	}, nil
+}
+
+// getLeavesByRange fetches up to count leaves starting at start, stopping at the end of the tree
+func (s *trillianclient) getLeavesByRange(start, count int64) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	root, err := s.root()
+	if err != nil {
+		return &Response{}, err
+	}
+	if uint64(start) >= root.TreeSize {
+		return &Response{status: codes.OK, getLeavesByRangeResult: &trillian.GetLeavesByRangeResponse{}, root: root}, nil
+	}
+	if remaining := int64(root.TreeSize) - start; count > remaining {
+		count = remaining
+	}
+
+	resp, err := s.client.GetLeavesByRange(ctx,
+		&trillian.GetLeavesByRangeRequest{
+			LogId:      s.logID,
+			StartIndex: start,
+			Count:      count,
+		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
+
+	return &Response{
+		status:                 codes.OK,
+		getLeavesByRangeResult: resp,
+		root:                   root,
+	}, nil
+}
+
+// getLeafAndProofByHash is getLeafAndProofByIndex for a leaf identified by its Merkle leaf hash
+func (s *trillianclient) getLeafAndProofByHash(leafHash []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	resp, err := s.client.GetLeavesByHash(ctx,
+		&trillian.GetLeavesByHashRequest{
+			LogId:    s.logID,
+			LeafHash: [][]byte{leafHash},
+		})
+	if err != nil {
+		return &Response{status: status.Code(err)}, err
+	}
+	if len(resp.GetLeaves()) == 0 {
+		return &Response{status: codes.NotFound}, nil
+	}
+
+	return s.getLeafAndProof(resp.Leaves[0].LeafIndex, leafHash)
+}
+
+// getConsistencyProof returns the proof that the log at firstSize is a prefix of the log at lastSize.
+// The proof is checked against the root hash of each size that the server has recorded from a signed
+// log root, or else that the caller gave from its own checkpoint, which is nil when it has none.
+func (s *trillianclient) getConsistencyProof(tLogID int64, firstSize, lastSize int64, firstRootHash, lastRootHash []byte) (*Response, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	root, err := s.root()
+	if err != nil {
+		return &Response{}, err
+	}
+
+	if lastSize == 0 {
+		lastSize = int64(root.TreeSize)
+	}
+	if firstSize < 1 || firstSize > lastSize || uint64(lastSize) > root.TreeSize {
+		return &Response{}, status.Errorf(codes.InvalidArgument, "invalid tree sizes %d and %d for log of size %d", firstSize, lastSize, root.TreeSize)
+	}
+
+	resp, err := s.client.GetConsistencyProof(ctx,
+		&trillian.GetConsistencyProofRequest{
+			LogId:          tLogID,
+			FirstTreeSize:  firstSize,
+			SecondTreeSize: lastSize,
+		})
+	if err != nil {
+		return &Response{}, err
+	}
+	// the signed root of the tree the proof was served from is recorded, as the tree may have grown since
+	// the root above was fetched
+	if slr := resp.GetSignedLogRoot(); slr != nil {
+		if _, err := s.verifyRoot(slr); err != nil {
+			return &Response{}, err
+		}
+	}
+
+	firstRoot, err := s.rootHash(firstSize, firstRootHash)
+	if err != nil {
+		return &Response{}, err
+	}
+	lastRoot, err := s.rootHash(lastSize, lastRootHash)
+	if err != nil {
+		return &Response{}, err
+	}
+
+	// without a root for both sizes there is nothing to check the proof against here, and the caller
+	// checks it against the root hash of its own checkpoint
+	hashes := resp.GetProof().GetHashes()
+	if firstRoot != nil && lastRoot != nil {
+		v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
+		if err := v.VerifyConsistencyProof(firstSize, lastSize, firstRoot, lastRoot, hashes); err != nil {
+			if _, ok := s.roots.get(uint64(firstSize)); !ok {
+				return &Response{}, inconsistentRoot(firstSize, err)
+			}
+			if _, ok := s.roots.get(uint64(lastSize)); !ok {
+				return &Response{}, inconsistentRoot(lastSize, err)
+			}
+			return &Response{}, err
+		}
+	}
+
+	return &Response{
+		status:               status.Code(err),
+		getConsistencyResult: resp,
+		firstRootHash:        firstRoot,
+		lastRootHash:         lastRoot,
+		lastTreeSize:         lastSize,
+	}, nil
+}
+
+// rootHash returns the root hash of the log at treeSize that a consistency proof is checked against: the
+// one recorded from a signed log root, or else given, which is the caller's and may be nil. A given hash
+// that differs from the recorded one shows the caller has seen a fork of the log.
+func (s *trillianclient) rootHash(treeSize int64, given []byte) ([]byte, error) {
+	recorded, ok := s.roots.get(uint64(treeSize))
+	if !ok {
+		return given, nil
+	}
+	if given != nil && !bytes.Equal(given, recorded) {
+		return nil, inconsistentRoot(treeSize, fmt.Errorf("log root hash for tree size %d is %x", treeSize, recorded))
+	}
+	return recorded, nil
+}
+
+// maxRootHistory bounds the number of tree sizes a rootHistory keeps in memory
+const maxRootHistory = 1 << 16
+
+// rootHistory remembers the root hash of each verified log root by tree size, so consistency proofs are
+// checked against roots the log has committed to rather than ones rebuilt from Trillian's own proofs
+type rootHistory struct {
+	mu     sync.Mutex
+	hashes map[uint64][]byte
+	// sizes holds the keys of hashes in the order they were added, oldest first
+	sizes []uint64
+
+	// db persists every root across restarts when set, in bucket keyed by big endian tree size
+	db     *bolt.DB
+	bucket []byte
+}
+
+func newRootHistory() *rootHistory {
+	return &rootHistory{hashes: map[uint64][]byte{}}
+}
+
+// openRootHistory opens or creates the root history of the tree stored at path
+func openRootHistory(path string, treeID int64) (*rootHistory, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening root history at %v: %w", path, err)
+	}
+	h := newRootHistory()
+	h.db = db
+	h.bucket = []byte(fmt.Sprintf("roots-%d", treeID))
+	return h, nil
+}
+
+// Close releases the database the history is persisted to, if any
+func (h *rootHistory) Close() error {
+	if h.db == nil {
+		return nil
+	}
+	return h.db.Close()
+}
+
+// add records the root hash for treeSize, failing if a different one was recorded before
+func (h *rootHistory) add(treeSize uint64, rootHash []byte) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if seen, ok := h.hashes[treeSize]; ok {
+		return checkRootHash(treeSize, seen, rootHash)
+	}
+	if h.db != nil {
+		err := h.db.Update(func(tx *bolt.Tx) error {
+			bucket, err := tx.CreateBucketIfNotExists(h.bucket)
+			if err != nil {
+				return err
+			}
+			key := treeSizeKey(treeSize)
+			if seen := bucket.Get(key); seen != nil {
+				return checkRootHash(treeSize, seen, rootHash)
+			}
+			return bucket.Put(key, rootHash)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(h.sizes) >= maxRootHistory {
+		delete(h.hashes, h.sizes[0])
+		h.sizes = h.sizes[1:]
+	}
+	h.hashes[treeSize] = append([]byte(nil), rootHash...)
+	h.sizes = append(h.sizes, treeSize)
+	return nil
+}
+
+// get returns the root hash recorded for treeSize, if any
+func (h *rootHistory) get(treeSize uint64) ([]byte, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if hash, ok := h.hashes[treeSize]; ok {
+		return hash, true
+	}
+	if h.db == nil {
+		return nil, false
+	}
+
+	var hash []byte
+	err := h.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(h.bucket); bucket != nil {
+			if seen := bucket.Get(treeSizeKey(treeSize)); seen != nil {
+				hash = append([]byte(nil), seen...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		logging.Logger.Errorf("Error reading root history: %v", err)
+	}
+	return hash, hash != nil
+}
+
+func checkRootHash(treeSize uint64, seen, rootHash []byte) error {
+	if !bytes.Equal(seen, rootHash) {
+		return fmt.Errorf("log root hash %x for tree size %d conflicts with %x seen before", rootHash, treeSize, seen)
+	}
+	return nil
+}
+
+func treeSizeKey(treeSize uint64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, treeSize)
+	return key
+}
+
 func createAndInitTree(ctx context.Context, adminClient trillian.TrillianAdminClient, logClient trillian.TrillianLogClient) (*trillian.Tree, error) {
 	// First look for and use an existing tree
 	trees, err := adminClient.ListTrees(ctx, &trillian.ListTreesRequest{})
@@ -0,0 +1,143 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package app
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/pki"
+	"github.com/projectrekor/rekor-server/types"
+	"github.com/projectrekor/rekor-server/webhook"
+	"github.com/spf13/viper"
+)
+
+// integrationBatchSize is the number of pending entries looked up in Trillian at a time
+const integrationBatchSize = 100
+
+// newDispatcher returns the webhook dispatcher configured under webhook, or nil if no webhook URLs
+// are configured
+func newDispatcher() (*webhook.Dispatcher, error) {
+	urls := viper.GetStringSlice("webhook.urls")
+	if len(urls) == 0 {
+		return nil, nil
+	}
+
+	secretFile := viper.GetString("webhook.secret_file")
+	if secretFile == "" {
+		return nil, fmt.Errorf("webhook.secret_file is required when webhooks are configured")
+	}
+	secret, err := ioutil.ReadFile(secretFile)
+	if err != nil {
+		return nil, fmt.Errorf("error reading webhook secret: %w", err)
+	}
+
+	return webhook.New(webhook.Config{
+		URLs:          urls,
+		Secret:        []byte(strings.TrimSpace(string(secret))),
+		OutboxPath:    viper.GetString("webhook.outbox_path"),
+		Timeout:       viper.GetDuration("webhook.timeout"),
+		MaxOutbox:     viper.GetInt("webhook.max_outbox"),
+		MaxPending:    viper.GetInt("webhook.max_pending"),
+		MaxPendingAge: viper.GetDuration("webhook.max_pending_age"),
+	})
+}
+
+// webhookPollInterval is how often entries awaiting integration are looked up
+func webhookPollInterval() time.Duration {
+	if interval := viper.GetDuration("webhook.poll_interval"); interval > 0 {
+		return interval
+	}
+	return time.Second
+}
+
+func webhookEntry(uuid string, leaf *types.RekorLeaf) webhook.Entry {
+	entry := webhook.Entry{UUID: uuid, SHA: leaf.SHA}
+	if ids, ok := leaf.PublicKeyObject().(pki.KeyIdentities); ok {
+		entry.Fingerprints = ids.Fingerprints()
+	}
+	return entry
+}
+
+// watchIntegration sends the integration events of queued entries until ctx is done
+func (api *API) watchIntegration(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := api.checkIntegrated(); err != nil {
+				logging.Logger.Warnf("checking integration of queued entries: %v", err)
+			}
+		}
+	}
+}
+
+// checkIntegrated sends an integration event for each pending entry that is now in the log
+func (api *API) checkIntegrated() error {
+	pending, err := api.webhooks.Pending()
+	if err != nil {
+		return err
+	}
+
+	server := api.logServer()
+	for len(pending) > 0 {
+		batch := pending
+		if len(batch) > integrationBatchSize {
+			batch = batch[:integrationBatchSize]
+		}
+		pending = pending[len(batch):]
+
+		byHash := map[string]webhook.Entry{}
+		var hashes [][]byte
+		for _, entry := range batch {
+			leafHash, err := hex.DecodeString(entry.UUID)
+			if err != nil {
+				return err
+			}
+			byHash[string(leafHash)] = entry
+			hashes = append(hashes, leafHash)
+		}
+
+		resp, err := server.getLeavesByHashes(hashes)
+		if err != nil {
+			return err
+		}
+		for _, leaf := range resp.getLeafResult.GetLeaves() {
+			entry, ok := byHash[string(hashLeaf(leaf))]
+			if !ok || leaf.GetIntegrateTimestamp() == nil {
+				continue
+			}
+			integratedTime, err := ptypes.Timestamp(leaf.IntegrateTimestamp)
+			if err != nil {
+				return err
+			}
+			if err := api.webhooks.Integrated(entry, leaf.LeafIndex, integratedTime.Unix()); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,595 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package client is a Go client for the rekor-server API. Log roots returned by the server are
+// checked against the log's public key, and inclusion proofs are verified locally before they are
+// returned to the caller.
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/trillian"
+	tclient "github.com/google/trillian/client"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+const (
+	defaultRetries   = 3
+	defaultRetryWait = 500 * time.Millisecond
+)
+
+// Client calls the API of a single rekor server
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	retries    int
+	retryWait  time.Duration
+	publicKey  crypto.PublicKey
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the http.Client used to make requests; http.DefaultClient is used otherwise
+func WithHTTPClient(c *http.Client) Option {
+	return func(client *Client) {
+		client.httpClient = c
+	}
+}
+
+// WithRetries sets how many times a request is retried after a timeout, a refused or reset connection,
+// or a response indicating that the server is temporarily unavailable
+func WithRetries(retries int) Option {
+	return func(client *Client) {
+		client.retries = retries
+	}
+}
+
+// WithRetryWait sets the delay before the first retry; it doubles with each further attempt
+func WithRetryWait(wait time.Duration) Option {
+	return func(client *Client) {
+		client.retryWait = wait
+	}
+}
+
+// WithPublicKey pins the key the log's tree roots are signed with, as returned by TreeKey. Without it,
+// log roots are verified with the key the server returns alongside them, which only proves that the
+// server is self-consistent.
+func WithPublicKey(pub crypto.PublicKey) Option {
+	return func(client *Client) {
+		client.publicKey = pub
+	}
+}
+
+// New returns a client for the rekor server at serverURL, e.g. "https://rekor.example.com"
+func New(serverURL string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(serverURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("unsupported scheme for rekor server URL %q", serverURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		httpClient: http.DefaultClient,
+		retries:    defaultRetries,
+		retryWait:  defaultRetryWait,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Error is returned when the server responds with an error status
+type Error struct {
+	StatusCode int
+	models.ErrorResponse
+	// Existing identifies the entry already in the log when an add request is rejected as a duplicate
+	Existing *models.ExistingEntry
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("rekor server returned %d %s", e.StatusCode, http.StatusText(e.StatusCode))
+	}
+	return fmt.Sprintf("rekor server returned %d: %s", e.StatusCode, e.Message)
+}
+
+// IsDuplicate reports whether err is the rejection of an entry that is already in the log
+func IsDuplicate(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict
+}
+
+// VerificationError is returned when a response from the server fails a cryptographic check, such as a
+// log root signature, a consistency proof or an inclusion proof
+type VerificationError struct {
+	err error
+}
+
+func (e *VerificationError) Error() string {
+	return e.err.Error()
+}
+
+func (e *VerificationError) Unwrap() error {
+	return e.err
+}
+
+// IsVerificationError reports whether err is a failed check of data returned by the server, as opposed
+// to an error reaching it
+func IsVerificationError(err error) bool {
+	var vErr *VerificationError
+	return errors.As(err, &vErr)
+}
+
+// Add submits an entry to the log. If the entry is already in the log, the returned error satisfies
+// IsDuplicate and identifies the existing entry.
+func (c *Client) Add(ctx context.Context, entry *models.ProposedEntry) (*models.AddResponse, error) {
+	var resp models.AddResponse
+	if err := c.post(ctx, "/api/v1/add", entry, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// Get returns the leaves of the log matching entry, which must include its SHA
+func (c *Client) Get(ctx context.Context, entry *models.ProposedEntry) ([]*trillian.LogLeaf, error) {
+	var resp models.GetResponse
+	if err := c.post(ctx, "/api/v1/get", entry, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Leaves, nil
+}
+
+// InclusionProof proves that a leaf is included in the log at Root
+type InclusionProof struct {
+	LeafHash []byte
+	Proof    *trillian.Proof
+	Root     *ttypes.LogRootV1
+}
+
+// GetProof fetches the proof that entry, which must include its SHA, is included in the log. The proof
+// is verified against a log root signed by the log before it is returned.
+func (c *Client) GetProof(ctx context.Context, entry *models.ProposedEntry) (*InclusionProof, error) {
+	leafHash, err := LeafHash(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp models.GetProofResponse
+	if err := c.post(ctx, "/api/v1/getproof", entry, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Proof == nil || len(resp.Proof.Proof) == 0 {
+		return nil, errors.New("no inclusion proof returned")
+	}
+
+	verifier, err := c.verifier(resp.Key)
+	if err != nil {
+		return nil, err
+	}
+	root, err := verifier.VerifyRoot(&ttypes.LogRootV1{}, resp.Proof.SignedLogRoot, nil)
+	if err != nil {
+		return nil, &VerificationError{fmt.Errorf("verifying log root: %w", err)}
+	}
+
+	proof := resp.Proof.Proof[0]
+	if err := verifier.VerifyInclusionByHash(root, leafHash, proof); err != nil {
+		return nil, &VerificationError{fmt.Errorf("verifying inclusion proof: %w", err)}
+	}
+
+	return &InclusionProof{
+		LeafHash: leafHash,
+		Proof:    proof,
+		Root:     root,
+	}, nil
+}
+
+// Latest returns the latest log root after verifying its signature. If trusted is not nil, the
+// returned root is also proven to be consistent with it.
+func (c *Client) Latest(ctx context.Context, trusted *ttypes.LogRootV1) (*ttypes.LogRootV1, error) {
+	path := "/api/v1/latest"
+	if trusted == nil {
+		trusted = &ttypes.LogRootV1{}
+	} else if trusted.TreeSize > 0 {
+		path += "?lastSize=" + strconv.FormatUint(trusted.TreeSize, 10)
+	}
+
+	var resp models.GetLatestResponse
+	if err := c.post(ctx, path, nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Proof == nil {
+		return nil, errors.New("no log root returned")
+	}
+
+	verifier, err := c.verifier(resp.Key)
+	if err != nil {
+		return nil, err
+	}
+	root, err := verifier.VerifyRoot(trusted, resp.Proof.SignedLogRoot, resp.Proof.GetProof().GetHashes())
+	if err != nil {
+		return nil, &VerificationError{fmt.Errorf("verifying log root: %w", err)}
+	}
+	return root, nil
+}
+
+// GetLeaf returns the leaf at index in the log
+func (c *Client) GetLeaf(ctx context.Context, index int64) (*trillian.LogLeaf, error) {
+	var resp models.GetLeafResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/getleaf?leafindex="+strconv.FormatInt(index, 10), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Leaf == nil || len(resp.Leaf.Leaves) == 0 {
+		return nil, fmt.Errorf("no leaf returned for index %d", index)
+	}
+
+	verifier, err := c.verifier(resp.Key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := verifier.VerifyRoot(&ttypes.LogRootV1{}, resp.Leaf.SignedLogRoot, nil); err != nil {
+		return nil, &VerificationError{fmt.Errorf("verifying log root: %w", err)}
+	}
+
+	leaf := resp.Leaf.Leaves[0]
+	if leaf.LeafIndex != index {
+		return nil, fmt.Errorf("requested leaf %d but server returned leaf %d", index, leaf.LeafIndex)
+	}
+	if !bytes.Equal(rfc6962.DefaultHasher.HashLeaf(leaf.LeafValue), leaf.MerkleLeafHash) {
+		return nil, fmt.Errorf("leaf hash of leaf %d does not match its value", index)
+	}
+	return leaf, nil
+}
+
+// GetEntry returns the entry with the given UUID. Its inclusion proof is checked against the root
+// hash returned with it; use GetBundle to verify the entry against a signed checkpoint.
+func (c *Client) GetEntry(ctx context.Context, uuid string) (*models.LogEntryResponse, error) {
+	var resp models.LogEntryResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/log/entries/"+url.PathEscape(uuid), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.UUID != uuid {
+		return nil, fmt.Errorf("requested entry %v but server returned %v", uuid, resp.UUID)
+	}
+	if err := verifyEntry(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetEntryByIndex returns the entry at index in the log, checked as in GetEntry
+func (c *Client) GetEntryByIndex(ctx context.Context, index int64) (*models.LogEntryResponse, error) {
+	var resp models.LogEntryResponse
+	if err := c.do(ctx, http.MethodGet, "/api/v1/log/entries?logIndex="+strconv.FormatInt(index, 10), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.LogIndex != index {
+		return nil, fmt.Errorf("requested entry %d but server returned entry %d", index, resp.LogIndex)
+	}
+	if err := verifyEntry(&resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// GetEntriesRange returns up to pageSize consecutive entries starting at index start. Each entry is
+// checked to match its UUID, and is returned with its public key and signature parsed; the entries are
+// not checked to be in the log. Leaves the server could not decode are returned as errors in place of
+// entries, ordered by index; their UUIDs are as reported by the server.
+func (c *Client) GetEntriesRange(ctx context.Context, start, pageSize int64) ([]models.LogEntry, []models.EntryError, error) {
+	var resp models.EntriesRangeResponse
+	path := fmt.Sprintf("/api/v1/log/entries/range?start=%d&pageSize=%d", start, pageSize)
+	if err := c.do(ctx, http.MethodGet, path, nil, &resp); err != nil {
+		return nil, nil, err
+	}
+
+	errored := map[int64]bool{}
+	for _, e := range resp.Errors {
+		if leafHash, err := hex.DecodeString(e.UUID); err != nil || len(leafHash) != rfc6962.DefaultHasher.Size() {
+			return nil, nil, &VerificationError{fmt.Errorf("server reported entry %d with invalid UUID %v", e.LogIndex, e.UUID)}
+		}
+		errored[e.LogIndex] = true
+	}
+
+	next := start
+	for i := range resp.Entries {
+		for errored[next] {
+			next++
+		}
+		entry := &resp.Entries[i]
+		if entry.LogIndex != next {
+			return nil, nil, fmt.Errorf("requested entry %d but server returned entry %d", next, entry.LogIndex)
+		}
+		if err := checkLeaf(entry); err != nil {
+			return nil, nil, err
+		}
+		next++
+	}
+	for errored[next] {
+		next++
+	}
+	if next-start != int64(len(resp.Entries)+len(resp.Errors)) {
+		return nil, nil, fmt.Errorf("server returned entries that are not consecutive from index %d", start)
+	}
+
+	sort.Slice(resp.Errors, func(i, j int) bool { return resp.Errors[i].LogIndex < resp.Errors[j].LogIndex })
+	return resp.Entries, resp.Errors, nil
+}
+
+// GetBundle returns the offline verification bundle for the entry with the given UUID; check it with
+// verify.Bundle
+func (c *Client) GetBundle(ctx context.Context, uuid string) (*models.Bundle, error) {
+	var resp models.Bundle
+	if err := c.do(ctx, http.MethodGet, "/api/v1/log/entries/"+url.PathEscape(uuid)+"/bundle", nil, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// PublicKey returns the key the log signs checkpoints with. It is fetched from the log itself, so it
+// should be compared with a key obtained out of band before it is trusted.
+func (c *Client) PublicKey(ctx context.Context) (crypto.PublicKey, error) {
+	var resp []byte
+	if err := c.do(ctx, http.MethodGet, "/api/v1/log/publicKey", nil, &resp); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(resp)
+	if block == nil {
+		return nil, errors.New("log public key is not PEM encoded")
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// TreeKey returns the key the log's tree roots are signed with, which is the key WithPublicKey pins and
+// differs from the checkpoint key returned by PublicKey. It is fetched from the log itself, so it
+// should be compared with a key obtained out of band before it is trusted.
+func (c *Client) TreeKey(ctx context.Context) (crypto.PublicKey, error) {
+	var resp models.GetLatestResponse
+	if err := c.post(ctx, "/api/v1/latest", nil, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Key) == 0 {
+		return nil, errors.New("no log tree key returned")
+	}
+	return x509.ParsePKIXPublicKey(resp.Key)
+}
+
+// verifyEntry checks that the content of an entry hashes to its UUID, which is its leaf hash, and the
+// inclusion proof of that leaf hash
+func verifyEntry(entry *models.LogEntryResponse) error {
+	if err := checkLeaf(&entry.LogEntry); err != nil {
+		return err
+	}
+	leafHash, err := hex.DecodeString(entry.UUID)
+	if err != nil {
+		return fmt.Errorf("invalid entry UUID %v", entry.UUID)
+	}
+	p := entry.InclusionProof
+	if err := merkle.NewLogVerifier(rfc6962.DefaultHasher).VerifyInclusionProof(entry.LogIndex, p.TreeSize, p.Hashes, p.RootHash, leafHash); err != nil {
+		return &VerificationError{fmt.Errorf("verifying inclusion proof: %w", err)}
+	}
+	return nil
+}
+
+// checkLeaf re-derives the leaf of an entry from its content and checks that it hashes to the entry's
+// UUID. The content is replaced with the parsed leaf, so that its signature and public key are loaded.
+func checkLeaf(entry *models.LogEntry) error {
+	if entry.Entry == nil {
+		return fmt.Errorf("server returned entry %d without its content", entry.LogIndex)
+	}
+	leaf, leafHash, err := parseLeaf(&models.ProposedEntry{
+		Format:     entry.Entry.Format,
+		SHA:        entry.Entry.SHA,
+		Signature:  entry.Entry.Signature,
+		PublicKey:  entry.Entry.PublicKey,
+		Decompress: entry.Entry.Decompress,
+	})
+	if err != nil {
+		return fmt.Errorf("parsing entry %d: %w", entry.LogIndex, err)
+	}
+	if entry.UUID != hex.EncodeToString(leafHash) {
+		return &VerificationError{fmt.Errorf("entry %d does not match its UUID %v", entry.LogIndex, entry.UUID)}
+	}
+	entry.Entry = leaf
+	return nil
+}
+
+// LeafHash computes the Merkle leaf hash the log assigns to entry, which must include its SHA
+func LeafHash(entry *models.ProposedEntry) ([]byte, error) {
+	if entry.SHA == "" {
+		return nil, errors.New("entry SHA is required to compute its leaf hash")
+	}
+	_, leafHash, err := parseLeaf(entry)
+	return leafHash, err
+}
+
+// parseLeaf parses entry as the log does, returning the leaf stored in the log and its Merkle leaf hash
+func parseLeaf(entry *models.ProposedEntry) (*types.RekorLeaf, []byte, error) {
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return nil, nil, err
+	}
+	leaf, err := types.ParseRekorLeaf(bytes.NewReader(b))
+	if err != nil {
+		return nil, nil, err
+	}
+	leafValue, err := json.Marshal(leaf)
+	if err != nil {
+		return nil, nil, err
+	}
+	return leaf, rfc6962.DefaultHasher.HashLeaf(leafValue), nil
+}
+
+// verifier returns a verifier for roots signed with the log key, checking that the DER encoded key
+// returned by the server matches the pinned key if there is one
+func (c *Client) verifier(der []byte) (*tclient.LogVerifier, error) {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, fmt.Errorf("parsing log public key: %w", err)
+	}
+	if c.publicKey != nil {
+		pinned, err := x509.MarshalPKIXPublicKey(c.publicKey)
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(pinned, der) {
+			return nil, &VerificationError{errors.New("log public key returned by the server does not match the pinned key")}
+		}
+	}
+	return tclient.NewLogVerifier(rfc6962.DefaultHasher, pub, crypto.SHA256), nil
+}
+
+func (c *Client) post(ctx context.Context, path string, body, v interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	return c.do(ctx, http.MethodPost, path, b, v)
+}
+
+// do sends a request, retrying while the server is unavailable, and decodes the JSON response into v
+func (c *Client) do(ctx context.Context, method, path string, body []byte, v interface{}) error {
+	ref, err := url.Parse(path)
+	if err != nil {
+		return err
+	}
+	u := c.baseURL.ResolveReference(ref)
+
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		var reqBody io.Reader
+		if body != nil {
+			reqBody = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, u.String(), reqBody)
+		if err != nil {
+			return err
+		}
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		req.Header.Set("Accept", "application/json")
+
+		err = c.roundTrip(req, v)
+		if err == nil || attempt >= c.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+func (c *Client) roundTrip(req *http.Request, v interface{}) error {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		apiErr := &Error{StatusCode: resp.StatusCode}
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+			var body struct {
+				models.ErrorResponse
+				Details json.RawMessage `json:"details,omitempty"`
+			}
+			if err := json.Unmarshal(b, &body); err == nil {
+				apiErr.ErrorResponse = body.ErrorResponse
+				if resp.StatusCode == http.StatusConflict && len(body.Details) != 0 {
+					var existing models.ExistingEntry
+					if err := json.Unmarshal(body.Details, &existing); err == nil {
+						apiErr.Existing = &existing
+						apiErr.Details = existing
+					}
+				}
+			}
+		}
+		return apiErr
+	}
+
+	if raw, ok := v.(*[]byte); ok {
+		*raw = b
+		return nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("decoding response from %v: %w", req.URL, err)
+	}
+	return nil
+}
+
+// retryable reports whether a request that failed with err may succeed if it is sent again
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && (netErr.Timeout() || netErr.Temporary()) {
+		return true
+	}
+	// the server was restarting or dropped the connection; anything else, such as a response that
+	// could not be decoded or failed verification, will fail the same way again
+	return errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET)
+}
@@ -0,0 +1,610 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	tcrypto "github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/pki"
+	"github.com/projectrekor/rekor-server/types"
+	"github.com/projectrekor/rekor-server/verify"
+)
+
+// fakeServer implements the rekor API over an in-memory log with signed roots
+type fakeServer struct {
+	t      *testing.T
+	signer *ecdsa.PrivateKey
+
+	mu            sync.Mutex
+	tree          *merkle.InMemoryMerkleTree
+	leaves        []*trillian.LogLeaf
+	unavailable   int  // number of requests to answer with 503 before succeeding
+	tamper        bool // corrupt inclusion proofs
+	tamperContent bool // serve entries whose content does not match their UUID
+}
+
+func newFakeServer(t *testing.T) (*fakeServer, *httptest.Server) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeServer{t: t, signer: signer, tree: merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher)}
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeServer) append(leafValue []byte) *trillian.LogLeaf {
+	f.tree.AddLeaf(leafValue)
+	leaf := &trillian.LogLeaf{
+		LeafValue:      leafValue,
+		MerkleLeafHash: rfc6962.DefaultHasher.HashLeaf(leafValue),
+		LeafIndex:      int64(len(f.leaves)),
+	}
+	f.leaves = append(f.leaves, leaf)
+	return leaf
+}
+
+func (f *fakeServer) signedRoot(treeSize int64) *trillian.SignedLogRoot {
+	root := &ttypes.LogRootV1{
+		TreeSize:       uint64(treeSize),
+		RootHash:       f.tree.RootAtSnapshot(treeSize).Hash(),
+		TimestampNanos: uint64(time.Now().UnixNano()),
+	}
+	slr, err := tcrypto.NewSigner(0, f.signer, crypto.SHA256).SignLogRoot(root)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return slr
+}
+
+func (f *fakeServer) key() []byte {
+	der, err := x509.MarshalPKIXPublicKey(f.signer.Public())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	return der
+}
+
+func (f *fakeServer) find(leafHash []byte) *trillian.LogLeaf {
+	for _, leaf := range f.leaves {
+		if bytes.Equal(leaf.MerkleLeafHash, leafHash) {
+			return leaf
+		}
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func (f *fakeServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.unavailable > 0 {
+		f.unavailable--
+		writeJSON(w, http.StatusServiceUnavailable, models.ErrorResponse{Code: http.StatusServiceUnavailable, Message: "unavailable"})
+		return
+	}
+
+	var entry models.ProposedEntry
+	if r.Method == http.MethodPost && r.URL.Path != "/api/v1/latest" {
+		if err := json.NewDecoder(r.Body).Decode(&entry); err != nil {
+			writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Code: http.StatusBadRequest, Message: err.Error()})
+			return
+		}
+		if entry.SHA == "" {
+			sum := sha256.Sum256(entry.Data)
+			entry.SHA = hex.EncodeToString(sum[:])
+		}
+	}
+	leafHash := func() []byte {
+		h, err := LeafHash(&entry)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		return h
+	}
+
+	size := int64(len(f.leaves))
+	switch r.URL.Path {
+	case "/api/v1/add":
+		if existing := f.find(leafHash()); existing != nil {
+			logIndex := existing.LeafIndex
+			writeJSON(w, http.StatusConflict, models.ErrorResponse{
+				Code:    http.StatusConflict,
+				Message: "entry already exists",
+				Details: models.ExistingEntry{UUID: hex.EncodeToString(existing.MerkleLeafHash), LogIndex: &logIndex},
+			})
+			return
+		}
+		b, _ := json.Marshal(entry)
+		rekorLeaf, err := types.ParseRekorLeaf(bytes.NewReader(b))
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		leafValue, _ := json.Marshal(rekorLeaf)
+		leaf := f.append(leafValue)
+		writeJSON(w, http.StatusOK, models.AddResponse{Status: models.StatusCode{Code: "OK"}, UUID: hex.EncodeToString(leaf.MerkleLeafHash)})
+	case "/api/v1/get":
+		resp := models.GetResponse{Status: models.StatusCode{Code: "OK"}}
+		if leaf := f.find(leafHash()); leaf != nil {
+			resp.Leaves = []*trillian.LogLeaf{leaf}
+		}
+		writeJSON(w, http.StatusOK, resp)
+	case "/api/v1/getproof":
+		leaf := f.find(leafHash())
+		if leaf == nil {
+			writeJSON(w, http.StatusNotFound, models.ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+			return
+		}
+		proof := &trillian.Proof{LeafIndex: leaf.LeafIndex}
+		for _, node := range f.tree.PathToRootAtSnapshot(leaf.LeafIndex+1, size) {
+			proof.Hashes = append(proof.Hashes, node.Value.Hash())
+		}
+		if f.tamper && len(proof.Hashes) > 0 {
+			proof.Hashes[0][0] ^= 1
+		}
+		writeJSON(w, http.StatusOK, models.GetProofResponse{
+			Status: "OK",
+			Proof:  &trillian.GetInclusionProofByHashResponse{Proof: []*trillian.Proof{proof}, SignedLogRoot: f.signedRoot(size)},
+			Key:    f.key(),
+		})
+	case "/api/v1/latest":
+		resp := &trillian.GetLatestSignedLogRootResponse{SignedLogRoot: f.signedRoot(size)}
+		if lastSize, err := strconv.ParseInt(r.URL.Query().Get("lastSize"), 10, 64); err == nil {
+			resp.Proof = &trillian.Proof{}
+			for _, node := range f.tree.SnapshotConsistency(lastSize, size) {
+				resp.Proof.Hashes = append(resp.Proof.Hashes, node.Value.Hash())
+			}
+		}
+		writeJSON(w, http.StatusOK, models.GetLatestResponse{Status: models.StatusCode{Code: "OK"}, Proof: resp, Key: f.key()})
+	case "/api/v1/getleaf":
+		index, err := strconv.ParseInt(r.URL.Query().Get("leafindex"), 10, 64)
+		if err != nil || index < 0 || index >= size {
+			writeJSON(w, http.StatusNotFound, models.ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, models.GetLeafResponse{
+			Status: models.StatusCode{Code: "OK"},
+			Leaf:   &trillian.GetLeavesByIndexResponse{Leaves: []*trillian.LogLeaf{f.leaves[index]}, SignedLogRoot: f.signedRoot(size)},
+			Key:    f.key(),
+		})
+	case "/api/v1/log/publicKey":
+		_ = pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: f.key()})
+	case "/api/v1/log/entries":
+		index, err := strconv.ParseInt(r.URL.Query().Get("logIndex"), 10, 64)
+		if err != nil || index < 0 || index >= size {
+			writeJSON(w, http.StatusNotFound, models.ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, f.entry(f.leaves[index], size))
+	case "/api/v1/log/entries/range":
+		start, _ := strconv.ParseInt(r.URL.Query().Get("start"), 10, 64)
+		pageSize, _ := strconv.ParseInt(r.URL.Query().Get("pageSize"), 10, 64)
+		resp := models.EntriesRangeResponse{Entries: []models.LogEntry{}}
+		for i := start; i < size && i < start+pageSize; i++ {
+			leaf, err := types.ParseRekorLeaf(bytes.NewReader(f.leaves[i].LeafValue))
+			if err != nil {
+				f.t.Fatal(err)
+			}
+			if f.tamper {
+				leaf.SHA = strings.Repeat("0", 64)
+			}
+			resp.Entries = append(resp.Entries, models.LogEntry{UUID: hex.EncodeToString(f.leaves[i].MerkleLeafHash), LogIndex: i, Entry: leaf})
+		}
+		writeJSON(w, http.StatusOK, resp)
+	default:
+		uuid := strings.TrimPrefix(r.URL.Path, "/api/v1/log/entries/")
+		bundle := strings.HasSuffix(uuid, "/bundle")
+		leafHash, err := hex.DecodeString(strings.TrimSuffix(uuid, "/bundle"))
+		if err != nil || uuid == r.URL.Path {
+			http.NotFound(w, r)
+			return
+		}
+		leaf := f.find(leafHash)
+		if leaf == nil {
+			writeJSON(w, http.StatusNotFound, models.ErrorResponse{Code: http.StatusNotFound, Message: "not found"})
+			return
+		}
+		entry := f.entry(leaf, size)
+		if !bundle {
+			writeJSON(w, http.StatusOK, entry)
+			return
+		}
+
+		checkpoint := types.SignedCheckpoint{Checkpoint: types.Checkpoint{Origin: "rekor.test - 1", Size: uint64(size), Hash: entry.InclusionProof.RootHash}}
+		if err := checkpoint.Sign("rekor.test", f.signer); err != nil {
+			f.t.Fatal(err)
+		}
+		text, _ := checkpoint.MarshalText()
+		writeJSON(w, http.StatusOK, models.Bundle{
+			UUID:             entry.UUID,
+			LogIndex:         entry.LogIndex,
+			LeafValue:        leaf.LeafValue,
+			InclusionProof:   entry.InclusionProof,
+			SignedCheckpoint: string(text),
+			PublicKey:        pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: f.key()}),
+		})
+	}
+}
+
+func (f *fakeServer) entry(leaf *trillian.LogLeaf, size int64) models.LogEntryResponse {
+	var hashes [][]byte
+	for _, node := range f.tree.PathToRootAtSnapshot(leaf.LeafIndex+1, size) {
+		hashes = append(hashes, node.Value.Hash())
+	}
+	if f.tamper && len(hashes) > 0 {
+		hashes[0][0] ^= 1
+	}
+	// leaves appended as raw bytes rather than added as entries are served without content
+	content, _ := types.ParseRekorLeaf(bytes.NewReader(leaf.LeafValue))
+	if f.tamperContent && content != nil {
+		content.SHA = strings.Repeat("0", 64)
+	}
+	return models.LogEntryResponse{
+		LogEntry: models.LogEntry{UUID: hex.EncodeToString(leaf.MerkleLeafHash), LogIndex: leaf.LeafIndex, Entry: content},
+		InclusionProof: models.InclusionProof{
+			TreeSize: size,
+			RootHash: f.tree.RootAtSnapshot(size).Hash(),
+			Hashes:   hashes,
+		},
+	}
+}
+
+func testEntry(t *testing.T) *models.ProposedEntry {
+	t.Helper()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile("../pki/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	data := read("hello_world.txt")
+	sum := sha256.Sum256(data)
+	return &models.ProposedEntry{
+		SHA:       hex.EncodeToString(sum[:]),
+		Data:      data,
+		Signature: read("hello_world.txt.asc.sig"),
+		PublicKey: read("valid_armored_public.pgp"),
+	}
+}
+
+func TestClient(t *testing.T) {
+	fake, server := newFakeServer(t)
+	for i := 0; i < 4; i++ {
+		fake.append([]byte(fmt.Sprintf("leaf %d", i)))
+	}
+
+	c, err := New(server.URL, WithPublicKey(fake.signer.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	before, err := c.Latest(ctx, nil)
+	if err != nil {
+		t.Fatalf("unexpected error getting latest root: %v", err)
+	}
+	if before.TreeSize != 4 {
+		t.Errorf("expected tree size 4, got %d", before.TreeSize)
+	}
+
+	entry := testEntry(t)
+	added, err := c.Add(ctx, entry)
+	if err != nil {
+		t.Fatalf("unexpected error adding entry: %v", err)
+	}
+
+	_, err = c.Add(ctx, entry)
+	var apiErr *Error
+	if !IsDuplicate(err) || !errors.As(err, &apiErr) {
+		t.Fatalf("expected a duplicate error adding the entry again, got %v", err)
+	}
+	if apiErr.Existing == nil || apiErr.Existing.UUID != added.UUID || *apiErr.Existing.LogIndex != 4 {
+		t.Errorf("duplicate error does not identify the existing entry: %+v", apiErr.Existing)
+	}
+
+	leaves, err := c.Get(ctx, entry)
+	if err != nil || len(leaves) != 1 {
+		t.Fatalf("unexpected result getting entry: %v, %v", leaves, err)
+	}
+
+	proof, err := c.GetProof(ctx, entry)
+	if err != nil {
+		t.Fatalf("unexpected error getting proof: %v", err)
+	}
+	if hex.EncodeToString(proof.LeafHash) != added.UUID || proof.Proof.LeafIndex != 4 || proof.Root.TreeSize != 5 {
+		t.Errorf("unexpected inclusion proof: %+v", proof)
+	}
+
+	after, err := c.Latest(ctx, before)
+	if err != nil {
+		t.Fatalf("unexpected error proving consistency with the previous root: %v", err)
+	}
+	if after.TreeSize != 5 {
+		t.Errorf("expected tree size 5, got %d", after.TreeSize)
+	}
+
+	leaf, err := c.GetLeaf(ctx, 4)
+	if err != nil {
+		t.Fatalf("unexpected error getting leaf: %v", err)
+	}
+	if !bytes.Equal(leaf.MerkleLeafHash, proof.LeafHash) {
+		t.Errorf("leaf 4 is not the added entry")
+	}
+
+	if _, err := c.GetLeaf(ctx, 5); err == nil {
+		t.Errorf("expected an error getting a leaf past the end of the log")
+	}
+}
+
+func TestClientVerification(t *testing.T) {
+	fake, server := newFakeServer(t)
+	ctx := context.Background()
+	entry := testEntry(t)
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Add(ctx, entry); err != nil {
+		t.Fatal(err)
+	}
+	fake.append([]byte("another leaf"))
+
+	fake.tamper = true
+	if _, err := c.GetProof(ctx, entry); !IsVerificationError(err) {
+		t.Errorf("expected a verification error for a corrupted inclusion proof, got %v", err)
+	}
+	fake.tamper = false
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	pinned, err := New(server.URL, WithPublicKey(otherKey.Public()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pinned.GetProof(ctx, entry); !IsVerificationError(err) {
+		t.Errorf("expected a verification error when the log key does not match the pinned key, got %v", err)
+	}
+
+	// a root that does not extend the trusted one
+	forked := &ttypes.LogRootV1{TreeSize: 1, RootHash: make([]byte, 32)}
+	if _, err := c.Latest(ctx, forked); !IsVerificationError(err) {
+		t.Errorf("expected a verification error proving consistency with a forked root, got %v", err)
+	}
+
+	unsha := *entry
+	unsha.SHA = ""
+	if _, err := c.GetProof(ctx, &unsha); err == nil {
+		t.Errorf("expected an error getting a proof without the entry SHA")
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	fake, server := newFakeServer(t)
+	ctx := context.Background()
+
+	c, err := New(server.URL, WithRetries(2), WithRetryWait(time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fake.unavailable = 2
+	if _, err := c.Latest(ctx, nil); err != nil {
+		t.Errorf("expected the request to succeed after retrying, got %v", err)
+	}
+
+	fake.unavailable = 3
+	var apiErr *Error
+	if _, err := c.Latest(ctx, nil); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected a 503 error once retries are exhausted, got %v", err)
+	}
+
+	fake.unavailable = 1
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := c.Latest(cancelled, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected a context cancellation error, got %v", err)
+	}
+
+	if _, err := New("ftp://example.com"); err == nil {
+		t.Errorf("expected an error for an unsupported scheme")
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	type TestCase struct {
+		caseDesc  string
+		err       error
+		retryable bool
+	}
+
+	dialErr := func(op string, errno syscall.Errno) error {
+		return &url.Error{Op: "Get", URL: "https://rekor.test", Err: &net.OpError{Op: op, Net: "tcp", Err: os.NewSyscallError(op, errno)}}
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "service unavailable", err: &Error{StatusCode: http.StatusServiceUnavailable}, retryable: true},
+		{caseDesc: "too many requests", err: &Error{StatusCode: http.StatusTooManyRequests}, retryable: true},
+		{caseDesc: "internal server error", err: &Error{StatusCode: http.StatusInternalServerError}, retryable: false},
+		{caseDesc: "bad request", err: &Error{StatusCode: http.StatusBadRequest}, retryable: false},
+		{caseDesc: "connection refused", err: dialErr("dial", syscall.ECONNREFUSED), retryable: true},
+		{caseDesc: "connection reset", err: dialErr("read", syscall.ECONNRESET), retryable: true},
+		{caseDesc: "timeout", err: &url.Error{Op: "Get", URL: "https://rekor.test", Err: &net.DNSError{Err: "timeout", IsTimeout: true}}, retryable: true},
+		{caseDesc: "unknown host", err: &url.Error{Op: "Get", URL: "https://rekor.test", Err: &net.DNSError{Err: "no such host", IsNotFound: true}}, retryable: false},
+		{caseDesc: "undecodable response", err: fmt.Errorf("decoding response from https://rekor.test: %w", &json.SyntaxError{}), retryable: false},
+		{caseDesc: "verification failure", err: &VerificationError{errors.New("verifying log root")}, retryable: false},
+		{caseDesc: "cancelled", err: &url.Error{Op: "Get", URL: "https://rekor.test", Err: context.Canceled}, retryable: false},
+	}
+
+	for _, tc := range testCases {
+		if got := retryable(tc.err); got != tc.retryable {
+			t.Errorf("%v: retryable returned %v, expected %v", tc.caseDesc, got, tc.retryable)
+		}
+	}
+}
+
+func TestClientEntries(t *testing.T) {
+	fake, server := newFakeServer(t)
+	fake.append([]byte("first leaf"))
+	ctx := context.Background()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := c.Add(ctx, testEntry(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fake.append([]byte("last leaf"))
+
+	byUUID, err := c.GetEntry(ctx, added.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error getting entry by UUID: %v", err)
+	}
+	byIndex, err := c.GetEntryByIndex(ctx, 1)
+	if err != nil {
+		t.Fatalf("unexpected error getting entry by index: %v", err)
+	}
+	if byUUID.LogIndex != 1 || byIndex.UUID != added.UUID {
+		t.Errorf("entries do not match: %+v, %+v", byUUID, byIndex)
+	}
+
+	pub, err := c.PublicKey(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting log public key: %v", err)
+	}
+	treeKey, err := c.TreeKey(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error getting log tree key: %v", err)
+	}
+	if der, _ := x509.MarshalPKIXPublicKey(treeKey); !bytes.Equal(der, fake.key()) {
+		t.Errorf("tree key does not match the key log roots are signed with")
+	}
+	bundle, err := c.GetBundle(ctx, added.UUID)
+	if err != nil {
+		t.Fatalf("unexpected error getting bundle: %v", err)
+	}
+	if _, err := verify.Bundle(bundle, pub); err != nil {
+		t.Errorf("bundle did not verify: %v", err)
+	}
+
+	if _, ok := byIndex.Entry.PublicKeyObject().(pki.KeyIdentities); !ok {
+		t.Errorf("public key of the entry was not parsed")
+	}
+
+	fake.tamper = true
+	if _, err := c.GetEntry(ctx, added.UUID); err == nil {
+		t.Errorf("expected an error verifying a corrupted inclusion proof")
+	}
+	fake.tamper = false
+
+	fake.tamperContent = true
+	if _, err := c.GetEntryByIndex(ctx, 1); !IsVerificationError(err) {
+		t.Errorf("expected a verification error for an entry that does not match its UUID, got %v", err)
+	}
+	fake.tamperContent = false
+
+	if _, err := c.GetEntryByIndex(ctx, 0); err == nil {
+		t.Errorf("expected an error getting an entry without content")
+	}
+
+	if _, err := c.GetEntry(ctx, strings.Repeat("0", 64)); err == nil {
+		t.Errorf("expected an error getting an unknown entry")
+	}
+}
+
+func TestClientEntriesRange(t *testing.T) {
+	fake, server := newFakeServer(t)
+	ctx := context.Background()
+
+	c, err := New(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var uuids []string
+	for i := 0; i < 5; i++ {
+		entry := testEntry(t)
+		entry.SHA = fmt.Sprintf("%064x", i)
+		added, err := c.Add(ctx, entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		uuids = append(uuids, added.UUID)
+	}
+
+	entries, _, err := c.GetEntriesRange(ctx, 1, 3)
+	if err != nil {
+		t.Fatalf("unexpected error getting range of entries: %v", err)
+	}
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, entry := range entries {
+		if entry.UUID != uuids[i+1] || entry.LogIndex != int64(i+1) {
+			t.Errorf("unexpected entry %d: %+v", i, entry)
+		}
+		if _, ok := entry.Entry.PublicKeyObject().(pki.KeyIdentities); !ok {
+			t.Errorf("public key of entry %d was not parsed", i)
+		}
+	}
+
+	fake.tamper = true
+	if _, _, err := c.GetEntriesRange(ctx, 0, 5); !IsVerificationError(err) {
+		t.Errorf("expected a verification error for entries that do not match their UUIDs, got %v", err)
+	}
+	fake.tamper = false
+}
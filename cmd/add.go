@@ -0,0 +1,113 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/projectrekor/rekor-server/client"
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/spf13/cobra"
+)
+
+// addCmd represents the add command
+var addCmd = &cobra.Command{
+	Use:          "add",
+	Short:        "add an entry to the log",
+	Long:         `Builds an entry from an artifact, its detached signature and the public key, and submits it to the log`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entry, err := proposedEntry(cmd)
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := clientContext()
+		defer cancel()
+
+		resp, err := c.Add(ctx, entry)
+		var apiErr *client.Error
+		if client.IsDuplicate(err) && errors.As(err, &apiErr) && apiErr.Existing != nil {
+			existing := apiErr.Existing
+			return printResult(cmd, existing, func(w io.Writer) {
+				fmt.Fprintf(w, "Entry already exists\nUUID: %s\n", existing.UUID)
+				if existing.LogIndex != nil {
+					fmt.Fprintf(w, "Log index: %d\n", *existing.LogIndex)
+				}
+			})
+		}
+		if err != nil {
+			return err
+		}
+		keyPath, _ := cmd.Flags().GetString("log-public-key")
+		if err := verifyEntryTimestamp(ctx, c, resp, keyPath); err != nil {
+			return err
+		}
+
+		return printResult(cmd, resp, func(w io.Writer) {
+			fmt.Fprintf(w, "Created entry\nUUID: %s\n", resp.UUID)
+			if set := resp.SignedEntryTimestamp; set != nil {
+				fmt.Fprintf(w, "Queued time: %s\n", time.Unix(set.Payload.QueuedTime, 0).UTC().Format(time.RFC3339))
+			}
+		})
+	},
+}
+
+// verifyEntryTimestamp checks that the signed entry timestamp returned for a new entry was signed by the
+// log and covers that entry. The key is read from keyPath if set, and fetched from the log otherwise.
+func verifyEntryTimestamp(ctx context.Context, c *client.Client, resp *models.AddResponse, keyPath string) error {
+	set := resp.SignedEntryTimestamp
+	if set == nil {
+		return errors.New("log did not return a signed entry timestamp for the entry")
+	}
+
+	var pub crypto.PublicKey
+	var err error
+	if keyPath != "" {
+		pub, err = readPublicKey(keyPath)
+	} else {
+		logging.Logger.Warn("no --log-public-key given, trusting the key served by the log")
+		pub, err = c.PublicKey(ctx)
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := set.Verify(pub); err != nil {
+		return err
+	}
+	if set.Payload.LeafHash != resp.UUID {
+		return fmt.Errorf("signed entry timestamp is for leaf %v, not the entry %v", set.Payload.LeafHash, resp.UUID)
+	}
+	return nil
+}
+
+func init() {
+	addEntryFlags(addCmd)
+	addCmd.Flags().String("log-public-key", "", "Path of the PEM encoded public key the log signs entry timestamps with")
+	addOutputFlag(addCmd)
+	rootCmd.AddCommand(addCmd)
+}
@@ -0,0 +1,121 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// addServer accepts every entry with a timestamp for leafHash signed by signer, and serves logKey as the
+// log's public key
+func addServer(t *testing.T, signer crypto.Signer, logKey crypto.PublicKey, uuid, leafHash string) *httptest.Server {
+	t.Helper()
+
+	logID, err := types.LogID(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := types.NewSignedEntryTimestamp(types.EntryTimestamp{LogID: logID, LeafHash: leafHash, QueuedTime: 1606149600}, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := publicKeyPEM(t, logKey)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/add":
+			_ = json.NewEncoder(w).Encode(models.AddResponse{Status: models.StatusCode{Code: "OK"}, UUID: uuid, SignedEntryTimestamp: set})
+		case "/api/v1/log/publicKey":
+			w.Header().Set("Content-Type", "application/x-pem-file")
+			_, _ = w.Write(keyPEM)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func publicKeyPEM(t *testing.T, pub crypto.PublicKey) []byte {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestAddVerifiesEntryTimestamp(t *testing.T) {
+	logKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	uuid := strings.Repeat("ab", 32)
+
+	pinned := filepath.Join(t.TempDir(), "log.pem")
+	if err := ioutil.WriteFile(pinned, publicKeyPEM(t, logKey.Public()), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	type TestCase struct {
+		caseDesc   string
+		server     *httptest.Server
+		keyPath    string
+		errorFound bool
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Timestamp signed by the served key", server: addServer(t, logKey, logKey.Public(), uuid, uuid), errorFound: false},
+		{caseDesc: "Timestamp signed by the pinned key", server: addServer(t, logKey, otherKey.Public(), uuid, uuid), keyPath: pinned, errorFound: false},
+		{caseDesc: "Timestamp signed by another key", server: addServer(t, otherKey, otherKey.Public(), uuid, uuid), keyPath: pinned, errorFound: true},
+		{caseDesc: "Timestamp for another entry", server: addServer(t, logKey, logKey.Public(), uuid, strings.Repeat("cd", 32)), errorFound: true},
+	}
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	defer rootCmd.SetArgs(nil)
+	defer rootCmd.SetOut(nil)
+	for _, tc := range testCases {
+		out.Reset()
+		rootCmd.SetArgs([]string{"add", "--client.url", tc.server.URL, "--log-public-key", tc.keyPath,
+			"--artifact", "../pki/testdata/hello_world.txt",
+			"--signature", "../pki/testdata/hello_world.txt.asc.sig",
+			"--public-key", "../pki/testdata/valid_armored_public.pgp"})
+		err := rootCmd.Execute()
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result adding entry: %v", tc.caseDesc, err)
+		}
+		if err == nil && !strings.Contains(out.String(), uuid) {
+			t.Errorf("%v: entry was not printed: %s", tc.caseDesc, out.String())
+		}
+	}
+}
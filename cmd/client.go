@@ -0,0 +1,130 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/projectrekor/rekor-server/client"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// clientURL returns client.url, or the address the server binds to if that is unset
+func clientURL() string {
+	if url := viper.GetString("client.url"); url != "" {
+		return url
+	}
+	return fmt.Sprintf("http://%s:%d", viper.GetString("rekor_server.address"), viper.GetUint("rekor_server.port"))
+}
+
+func newClient() (*client.Client, error) {
+	return client.New(clientURL())
+}
+
+func clientContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.Background(), viper.GetDuration("client.timeout"))
+}
+
+// addEntryFlags adds the flags used to build an entry from files on disk
+func addEntryFlags(cmd *cobra.Command) {
+	cmd.Flags().String("artifact", "", "Path of the signed artifact")
+	cmd.Flags().String("signature", "", "Path of the detached signature of the artifact")
+	cmd.Flags().String("public-key", "", "Path of the public key that verifies the signature")
+	cmd.Flags().String("pki-format", "pgp", "Format of the signature and public key (pgp, x509, minisign, ssh)")
+	for _, name := range []string{"artifact", "signature", "public-key"} {
+		_ = cmd.MarkFlagRequired(name)
+	}
+}
+
+// proposedEntry builds the entry described by the flags added by addEntryFlags
+func proposedEntry(cmd *cobra.Command) (*models.ProposedEntry, error) {
+	read := func(flag string) ([]byte, error) {
+		path, _ := cmd.Flags().GetString(flag)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %w", flag, err)
+		}
+		return b, nil
+	}
+
+	data, err := read("artifact")
+	if err != nil {
+		return nil, err
+	}
+	sig, err := read("signature")
+	if err != nil {
+		return nil, err
+	}
+	key, err := read("public-key")
+	if err != nil {
+		return nil, err
+	}
+	format, _ := cmd.Flags().GetString("pki-format")
+
+	sum := sha256.Sum256(data)
+	return &models.ProposedEntry{
+		Format:    format,
+		SHA:       hex.EncodeToString(sum[:]),
+		Data:      data,
+		Signature: sig,
+		PublicKey: key,
+	}, nil
+}
+
+// readPublicKey reads a PEM encoded PKIX public key
+func readPublicKey(path string) (crypto.PublicKey, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return nil, fmt.Errorf("%v does not contain a PEM encoded public key", path)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+func addOutputFlag(cmd *cobra.Command) {
+	cmd.Flags().StringP("output", "o", "text", "Output format (text, json)")
+}
+
+// printResult writes v as JSON if requested with the output flag, and with printText otherwise
+func printResult(cmd *cobra.Command, v interface{}, printText func(w io.Writer)) error {
+	output, _ := cmd.Flags().GetString("output")
+	switch output {
+	case "json":
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case "text":
+		printText(cmd.OutOrStdout())
+		return nil
+	}
+	return errors.New("output must be one of text or json")
+}
@@ -0,0 +1,94 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/spf13/cobra"
+)
+
+// getCmd represents the get command
+var getCmd = &cobra.Command{
+	Use:          "get",
+	Short:        "get an entry from the log",
+	Long:         `Fetches an entry by UUID or log index, checking its inclusion proof`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uuid, _ := cmd.Flags().GetString("uuid")
+		logIndex, _ := cmd.Flags().GetInt64("log-index")
+		bundle, _ := cmd.Flags().GetBool("bundle")
+		if (uuid == "") == (logIndex < 0) {
+			return errors.New("exactly one of --uuid or --log-index must be provided")
+		}
+
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := clientContext()
+		defer cancel()
+
+		var entry *models.LogEntryResponse
+		if uuid != "" {
+			entry, err = c.GetEntry(ctx, uuid)
+		} else {
+			entry, err = c.GetEntryByIndex(ctx, logIndex)
+		}
+		if err != nil {
+			return err
+		}
+
+		if bundle {
+			b, err := c.GetBundle(ctx, entry.UUID)
+			if err != nil {
+				return err
+			}
+			return printResult(cmd, b, func(w io.Writer) {
+				fmt.Fprintf(w, "UUID: %s\nLog index: %d\nTree size: %d\nRoot hash: %x\n\n%s",
+					b.UUID, b.LogIndex, b.InclusionProof.TreeSize, b.InclusionProof.RootHash, b.SignedCheckpoint)
+			})
+		}
+
+		return printResult(cmd, entry, func(w io.Writer) {
+			fmt.Fprintf(w, "UUID: %s\nLog index: %d\n", entry.UUID, entry.LogIndex)
+			if entry.IntegratedTime != 0 {
+				fmt.Fprintf(w, "Integrated time: %s\n", time.Unix(entry.IntegratedTime, 0).UTC().Format(time.RFC3339))
+			}
+			if e := entry.Entry; e != nil {
+				format := e.Format
+				if format == "" {
+					format = "pgp"
+				}
+				fmt.Fprintf(w, "Format: %s\nSHA: %s\n", format, e.SHA)
+			}
+			fmt.Fprintf(w, "Tree size: %d\nRoot hash: %x\n", entry.InclusionProof.TreeSize, entry.InclusionProof.RootHash)
+		})
+	},
+}
+
+func init() {
+	getCmd.Flags().String("uuid", "", "UUID of the entry")
+	getCmd.Flags().Int64("log-index", -1, "Index of the entry in the log")
+	getCmd.Flags().Bool("bundle", false, "Print the offline verification bundle for the entry")
+	addOutputFlag(getCmd)
+	rootCmd.AddCommand(getCmd)
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian/merkle/rfc6962"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// entryServer serves leaf as the only entry of a log, with content in place of the leaf's own
+func entryServer(t *testing.T, leaf, content *types.RekorLeaf) *httptest.Server {
+	t.Helper()
+
+	leafValue, err := json.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafHash := rfc6962.DefaultHasher.HashLeaf(leafValue)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/log/entries" || r.URL.Query().Get("logIndex") != "0" {
+			http.NotFound(w, r)
+			return
+		}
+		// a tree of one leaf has the leaf hash as its root and an empty inclusion proof
+		_ = json.NewEncoder(w).Encode(models.LogEntryResponse{
+			LogEntry: models.LogEntry{
+				UUID:  hex.EncodeToString(leafHash),
+				Entry: content,
+			},
+			InclusionProof: models.InclusionProof{TreeSize: 1, RootHash: leafHash},
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func testLeaf(t *testing.T) *types.RekorLeaf {
+	t.Helper()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile("../pki/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	entry, err := json.Marshal(models.ProposedEntry{
+		SHA:       strings.Repeat("ab", 32),
+		Signature: read("hello_world.txt.asc.sig"),
+		PublicKey: read("valid_armored_public.pgp"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := types.ParseRekorLeaf(bytes.NewReader(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf
+}
+
+func TestGetJSONOutput(t *testing.T) {
+	leaf := testLeaf(t)
+	server := entryServer(t, leaf, leaf)
+
+	var out bytes.Buffer
+	rootCmd.SetOut(&out)
+	rootCmd.SetArgs([]string{"get", "--client.url", server.URL, "--log-index", "0", "-o", "json"})
+	defer rootCmd.SetArgs(nil)
+	defer rootCmd.SetOut(nil)
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var printed models.LogEntryResponse
+	if err := json.Unmarshal(out.Bytes(), &printed); err != nil {
+		t.Fatalf("output is not a JSON entry: %v\n%s", err, out.String())
+	}
+	if printed.Entry == nil || printed.Entry.SHA != leaf.SHA {
+		t.Errorf("entry content was not printed: %s", out.String())
+	}
+
+	tampered := testLeaf(t)
+	tampered.SHA = strings.Repeat("cd", 32)
+	forged := entryServer(t, leaf, tampered)
+
+	out.Reset()
+	rootCmd.SetArgs([]string{"get", "--client.url", forged.URL, "--log-index", "0", "-o", "json"})
+	if err := rootCmd.Execute(); err == nil {
+		t.Errorf("expected an error for an entry whose content does not match its UUID, got %s", out.String())
+	}
+}
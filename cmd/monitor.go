@@ -0,0 +1,101 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"context"
+	"crypto"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/monitor"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// monitorCmd represents the monitor command
+var monitorCmd = &cobra.Command{
+	Use:   "monitor",
+	Short: "continuously audit that the log is append-only",
+	Long: `Polls the latest signed root of the log and verifies that it is signed by the log key and consistent
+with the last root verified, which is kept in a state file between runs. On a failed audit the alert
+is logged, posted to the webhook if one is configured, and the command exits with status 2.
+
+If a watch list is configured, each new entry is also checked for the listed public key fingerprints,
+email addresses and artifact digests, and matching entries are logged and posted to the webhook. On
+the first run the whole log is scanned.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		var pub crypto.PublicKey
+		if keyPath := viper.GetString("monitor.log_public_key"); keyPath != "" {
+			var err error
+			if pub, err = readPublicKey(keyPath); err != nil {
+				return err
+			}
+		}
+
+		m, err := monitor.New(monitor.Config{
+			ServerURL: clientURL(),
+			StatePath: viper.GetString("monitor.state_file"),
+			PublicKey: pub,
+			Watch: monitor.WatchList{
+				Fingerprints: viper.GetStringSlice("monitor.watch.fingerprints"),
+				Emails:       viper.GetStringSlice("monitor.watch.emails"),
+				Hashes:       viper.GetStringSlice("monitor.watch.hashes"),
+			},
+			WebhookURL: viper.GetString("monitor.webhook_url"),
+			// a check may page through the whole log, so only each request it makes is bounded
+			HTTPClient: &http.Client{Timeout: viper.GetDuration("client.timeout")},
+		})
+		if err != nil {
+			return err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		go func() {
+			<-interrupt
+			cancel()
+		}()
+
+		if once, _ := cmd.Flags().GetBool("once"); once {
+			_, _, err := m.Check(ctx)
+			return err
+		}
+		return m.Run(ctx, viper.GetDuration("monitor.interval"))
+	},
+}
+
+func init() {
+	monitorCmd.Flags().Duration("monitor.interval", time.Minute, "How often to check the log")
+	monitorCmd.Flags().String("monitor.state_file", "rekor-monitor.json", "Path of the file holding the last verified log root")
+	monitorCmd.Flags().String("monitor.log_public_key", "", "Path of the PEM encoded key the log's tree roots are signed with (default pins the key served by the log on first use)")
+	monitorCmd.Flags().String("monitor.webhook_url", "", "URL to POST alerts and watch list matches to as JSON")
+	monitorCmd.Flags().StringSlice("monitor.watch.fingerprints", nil, "Public key fingerprints or key IDs to report entries for")
+	monitorCmd.Flags().StringSlice("monitor.watch.emails", nil, "Email addresses bound to public keys to report entries for")
+	monitorCmd.Flags().StringSlice("monitor.watch.hashes", nil, "SHA-256 digests of artifacts to report entries for")
+	monitorCmd.Flags().Bool("once", false, "Check the log once and exit")
+	if err := viper.BindPFlags(monitorCmd.Flags()); err != nil {
+		logging.Logger.Fatal(err)
+	}
+	rootCmd.AddCommand(monitorCmd)
+}
@@ -0,0 +1,63 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/spf13/cobra"
+)
+
+// proofCmd represents the proof command
+var proofCmd = &cobra.Command{
+	Use:          "proof",
+	Short:        "get and verify the inclusion proof of an entry",
+	Long:         `Fetches the proof that an entry is included in the log and verifies it against the signed log root`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entry, err := proposedEntry(cmd)
+		if err != nil {
+			return err
+		}
+		c, err := newClient()
+		if err != nil {
+			return err
+		}
+		ctx, cancel := clientContext()
+		defer cancel()
+
+		proof, err := c.GetProof(ctx, entry)
+		if err != nil {
+			return err
+		}
+
+		return printResult(cmd, proof, func(w io.Writer) {
+			fmt.Fprintf(w, "Verified inclusion proof\nUUID: %x\nLog index: %d\nTree size: %d\nRoot hash: %x\n",
+				proof.LeafHash, proof.Proof.LeafIndex, proof.Root.TreeSize, proof.Root.RootHash)
+			for i, hash := range proof.Proof.Hashes {
+				fmt.Fprintf(w, "Hash %d: %x\n", i, hash)
+			}
+		})
+	},
+}
+
+func init() {
+	addEntryFlags(proofCmd)
+	addOutputFlag(proofCmd)
+	rootCmd.AddCommand(proofCmd)
+}
@@ -17,10 +17,13 @@ limitations under the License.
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/monitor"
 	"github.com/spf13/cobra"
 
 	homedir "github.com/mitchellh/go-homedir"
@@ -49,6 +52,11 @@ to quickly create a Cobra application.`,
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
 		logging.Logger.Error(err)
+		// a failed audit is distinguished from errors running the command
+		var alert *monitor.Alert
+		if errors.As(err, &alert) {
+			os.Exit(2)
+		}
 		os.Exit(1)
 	}
 }
@@ -63,11 +71,52 @@ func init() {
 	rootCmd.PersistentFlags().String("rekor_server.address", "127.0.0.1", "Address to bind to")
 	rootCmd.PersistentFlags().Uint16("rekor_server.port", 3000, "Port to bind to")
 
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "rekor-server"
+	}
+	rootCmd.PersistentFlags().String("rekor_server.hostname", hostname, "Name of this log instance, used in checkpoints")
+	rootCmd.PersistentFlags().String("rekor_server.signing_key", "", "PEM private key used to sign checkpoints, signed entry timestamps and bundles (required)")
+	rootCmd.PersistentFlags().Bool("rekor_server.ephemeral_signing_key", false, "Generate a signing key at startup when no signing key is configured; for testing only, as nothing it signs can be verified after a restart")
+
+	rootCmd.PersistentFlags().Int64("rekor_server.max_upload_size", 32<<20, "Maximum size of a request body in bytes")
+	rootCmd.PersistentFlags().Int64("rekor_server.max_page_size", 100, "Maximum number of entries returned by a single range request")
+	rootCmd.PersistentFlags().Duration("rekor_server.stream_poll_interval", time.Second, "How often the log is polled for entries to push to streaming clients")
+	rootCmd.PersistentFlags().Duration("rekor_server.shutdown_timeout", 30*time.Second, "How long the server waits for requests in progress to complete when it stops")
+	rootCmd.PersistentFlags().String("rekor_server.root_history_path", "rekor-roots.db", "Path of the database holding the signed log roots consistency proofs are checked against")
+
+	rootCmd.PersistentFlags().Duration("fetch.connect_timeout", 10*time.Second, "Timeout for connecting to servers when fetching entry content by URL")
+	rootCmd.PersistentFlags().Duration("fetch.timeout", 60*time.Second, "Timeout for fetching entry content by URL, including reading it")
+	rootCmd.PersistentFlags().Int64("fetch.max_size", 32<<20, "Maximum size in bytes of content fetched by URL")
+	rootCmd.PersistentFlags().StringSlice("fetch.allowed_schemes", []string{"https", "http"}, "URL schemes that entry content may be fetched with")
+	rootCmd.PersistentFlags().StringSlice("fetch.allowed_hosts", nil, "Hosts that entry content may be fetched from, exactly or as *.domain (default any host)")
+	rootCmd.PersistentFlags().Bool("fetch.allow_private_addresses", false, "Allow fetching entry content from loopback, private and link-local addresses")
+	rootCmd.PersistentFlags().Int("fetch.max_redirects", 3, "Maximum number of redirects followed when fetching entry content")
+
+	rootCmd.PersistentFlags().StringSlice("pki.ssh_namespaces", []string{"file", "git"}, "Namespaces that SSH signatures of entries may be created in")
+
+	rootCmd.PersistentFlags().Int64("decompress.max_size", 1<<30, "Maximum size in bytes of entry content after decompression")
+	rootCmd.PersistentFlags().Int64("decompress.max_ratio", 100, "Maximum ratio of decompressed to compressed size of entry content")
+	rootCmd.PersistentFlags().Int64("decompress.max_xz_dictionary", 64<<20, "Maximum dictionary size in bytes an xz compressed entry may declare")
+
+	rootCmd.PersistentFlags().String("index.backend", "memory", "Search index backend (memory, bolt)")
+	rootCmd.PersistentFlags().String("index.path", "rekor-index.db", "Path of the search index database for the bolt backend")
+
+	rootCmd.PersistentFlags().StringSlice("webhook.urls", nil, "URLs to POST signed entry events to")
+	rootCmd.PersistentFlags().String("webhook.secret_file", "", "Path of the file holding the secret used to sign webhook events")
+	rootCmd.PersistentFlags().String("webhook.outbox_path", "rekor-webhooks.db", "Path of the database holding undelivered webhook events")
+	rootCmd.PersistentFlags().Duration("webhook.poll_interval", time.Second, "How often queued entries are checked for integration into the log")
+	rootCmd.PersistentFlags().Duration("webhook.timeout", 10*time.Second, "Timeout for each attempt to deliver a webhook event")
+	rootCmd.PersistentFlags().Int("webhook.max_outbox", 10000, "Maximum number of undelivered webhook events kept, counting one per URL; the oldest are dropped when it is reached")
+	rootCmd.PersistentFlags().Int("webhook.max_pending", 10000, "Maximum number of queued entries awaited for integration events; the oldest are dropped when it is reached")
+	rootCmd.PersistentFlags().Duration("webhook.max_pending_age", 24*time.Hour, "How long a queued entry is awaited for its integration event before it is dropped")
+
+	rootCmd.PersistentFlags().String("client.url", "", "URL of the rekor server used by client commands (default http://<rekor_server.address>:<rekor_server.port>)")
+	rootCmd.PersistentFlags().Duration("client.timeout", 30*time.Second, "Timeout for client commands, and for each request the monitor makes")
+
 	if err := viper.BindPFlags(rootCmd.PersistentFlags()); err != nil {
 		logging.Logger.Fatal(err)
 	}
-
-	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -0,0 +1,139 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cmd
+
+import (
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/projectrekor/rekor-server/logging"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/verify"
+	"github.com/spf13/cobra"
+)
+
+type verifyResult struct {
+	UUID             string
+	LogIndex         int64
+	TreeSize         int64
+	RootHash         []byte
+	ArtifactVerified bool
+}
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify",
+	Short: "verify that an entry is included in the log",
+	Long: `Verifies the inclusion of an entry in the log against a checkpoint signed by the log, either from a
+bundle saved with "get --bundle -o json" without contacting the log, or by fetching the bundle for a UUID.
+If an artifact is given, it is also checked against the signature in the entry.`,
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		uuid, _ := cmd.Flags().GetString("uuid")
+		bundlePath, _ := cmd.Flags().GetString("bundle")
+		keyPath, _ := cmd.Flags().GetString("log-public-key")
+		artifactPath, _ := cmd.Flags().GetString("artifact")
+		if (uuid == "") == (bundlePath == "") {
+			return errors.New("exactly one of --uuid or --bundle must be provided")
+		}
+
+		var pub crypto.PublicKey
+		if keyPath != "" {
+			var err error
+			if pub, err = readPublicKey(keyPath); err != nil {
+				return err
+			}
+		}
+
+		var bundle models.Bundle
+		if bundlePath != "" {
+			if pub == nil {
+				return errors.New("--log-public-key is required to verify a bundle offline")
+			}
+			b, err := ioutil.ReadFile(bundlePath)
+			if err != nil {
+				return err
+			}
+			if err := json.Unmarshal(b, &bundle); err != nil {
+				return fmt.Errorf("parsing bundle: %w", err)
+			}
+		} else {
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			ctx, cancel := clientContext()
+			defer cancel()
+
+			if pub == nil {
+				logging.Logger.Warn("no --log-public-key given, trusting the key served by the log")
+				if pub, err = c.PublicKey(ctx); err != nil {
+					return err
+				}
+			}
+			b, err := c.GetBundle(ctx, uuid)
+			if err != nil {
+				return err
+			}
+			bundle = *b
+		}
+
+		leaf, err := verify.Bundle(&bundle, pub)
+		if err != nil {
+			return err
+		}
+
+		result := verifyResult{
+			UUID:     bundle.UUID,
+			LogIndex: bundle.LogIndex,
+			TreeSize: bundle.InclusionProof.TreeSize,
+			RootHash: bundle.InclusionProof.RootHash,
+		}
+		if artifactPath != "" {
+			artifact, err := os.Open(artifactPath)
+			if err != nil {
+				return err
+			}
+			defer artifact.Close()
+			if err := verify.Artifact(leaf, artifact); err != nil {
+				return err
+			}
+			result.ArtifactVerified = true
+		}
+
+		return printResult(cmd, result, func(w io.Writer) {
+			fmt.Fprintf(w, "Verified entry %s at log index %d in tree of size %d\n", result.UUID, result.LogIndex, result.TreeSize)
+			if result.ArtifactVerified {
+				fmt.Fprintf(w, "Verified signature of %s\n", artifactPath)
+			}
+		})
+	},
+}
+
+func init() {
+	verifyCmd.Flags().String("uuid", "", "UUID of the entry to fetch and verify")
+	verifyCmd.Flags().String("bundle", "", "Path of a bundle to verify offline")
+	verifyCmd.Flags().String("log-public-key", "", "Path of the PEM encoded public key of the log")
+	verifyCmd.Flags().String("artifact", "", "Path of the artifact to check against the entry")
+	addOutputFlag(verifyCmd)
+	rootCmd.AddCommand(verifyCmd)
+}
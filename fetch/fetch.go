@@ -0,0 +1,353 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package fetch retrieves remote content named in submitted entries. Requests are bounded in time and
+// size, restricted to configured schemes and hosts, and kept from reaching private network addresses
+// unless allowed, so that submitters cannot use the server to probe internal services.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultConnectTimeout = 10 * time.Second
+	defaultTimeout        = 60 * time.Second
+	defaultMaxSize        = 32 << 20
+	defaultMaxRedirects   = 3
+)
+
+// ErrTooLarge is returned when reading content larger than the configured maximum size
+var ErrTooLarge = errors.New("fetched content exceeds the maximum size")
+
+// ErrNotAllowed is wrapped by the errors returned for requests the configuration does not allow
+var ErrNotAllowed = errors.New("not allowed")
+
+// Error reports that the remote server failed to provide content: it could not be reached, did not
+// respond in time, or responded with an error status
+type Error struct {
+	URL string
+	// StatusCode is the status of the response, or zero if there was none
+	StatusCode int
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("fetching %v: %v", e.URL, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Timeout reports whether the server did not respond in time
+func (e *Error) Timeout() bool {
+	var netErr net.Error
+	return errors.Is(e.Err, context.DeadlineExceeded) || (errors.As(e.Err, &netErr) && netErr.Timeout())
+}
+
+// Config restricts the requests made by a Fetcher
+type Config struct {
+	// ConnectTimeout bounds establishing each connection, including the TLS handshake
+	ConnectTimeout time.Duration
+	// Timeout bounds the whole request, including redirects and reading the body
+	Timeout time.Duration
+	// MaxSize is the largest body that may be read, in bytes
+	MaxSize int64
+	// AllowedSchemes lists the URL schemes that may be fetched
+	AllowedSchemes []string
+	// AllowedHosts lists the hosts that may be fetched, either exactly or, with a leading "*.", any
+	// subdomain of a domain; if empty, any host may be fetched
+	AllowedHosts []string
+	// AllowPrivateAddresses permits connections to loopback, private, link-local and other non-public
+	// addresses, which are refused otherwise whatever the host name resolves to
+	AllowPrivateAddresses bool
+	// MaxRedirects is the number of redirects followed
+	MaxRedirects int
+}
+
+// ConfigFromViper returns the configuration under fetch, using defaults for unset values. Private
+// addresses are blocked unless fetch.allow_private_addresses is set.
+func ConfigFromViper() Config {
+	cfg := Config{
+		ConnectTimeout:        viper.GetDuration("fetch.connect_timeout"),
+		Timeout:               viper.GetDuration("fetch.timeout"),
+		MaxSize:               viper.GetInt64("fetch.max_size"),
+		AllowedSchemes:        viper.GetStringSlice("fetch.allowed_schemes"),
+		AllowedHosts:          viper.GetStringSlice("fetch.allowed_hosts"),
+		AllowPrivateAddresses: viper.GetBool("fetch.allow_private_addresses"),
+		MaxRedirects:          defaultMaxRedirects,
+	}
+	if viper.IsSet("fetch.max_redirects") {
+		cfg.MaxRedirects = viper.GetInt("fetch.max_redirects")
+	}
+	return cfg
+}
+
+// Fetcher makes GET requests within the limits of its Config
+type Fetcher struct {
+	cfg    Config
+	client *http.Client
+}
+
+// New returns a Fetcher enforcing cfg, using defaults for zero values
+func New(cfg Config) *Fetcher {
+	if cfg.ConnectTimeout <= 0 {
+		cfg.ConnectTimeout = defaultConnectTimeout
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultMaxSize
+	}
+	if len(cfg.AllowedSchemes) == 0 {
+		cfg.AllowedSchemes = []string{"https", "http"}
+	}
+	if cfg.MaxRedirects < 0 {
+		cfg.MaxRedirects = 0
+	}
+
+	f := &Fetcher{cfg: cfg}
+	dialer := &net.Dialer{Timeout: cfg.ConnectTimeout}
+	if !cfg.AllowPrivateAddresses {
+		// checking the address being connected to, rather than the result of resolving the host name
+		// beforehand, also covers redirects and names that resolve differently on each lookup
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || !isPublic(ip) {
+				return fmt.Errorf("connecting to non-public address %v: %w", host, ErrNotAllowed)
+			}
+			return nil
+		}
+	}
+
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   cfg.ConnectTimeout,
+		ResponseHeaderTimeout: cfg.Timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	}
+	if cfg.AllowPrivateAddresses {
+		// a proxy would make the connection on our behalf, bypassing the address check
+		transport.Proxy = http.ProxyFromEnvironment
+	}
+
+	f.client = &http.Client{
+		Transport: transport,
+		Timeout:   cfg.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > cfg.MaxRedirects {
+				return fmt.Errorf("following more than %d redirects: %w", cfg.MaxRedirects, ErrNotAllowed)
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+	return f
+}
+
+var (
+	sharedMu  sync.Mutex
+	shared    *Fetcher
+	sharedCfg Config
+)
+
+// Get fetches rawURL with the configuration from viper; see Fetcher.Get
+func Get(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	return fromViper().Get(ctx, rawURL)
+}
+
+// fromViper returns the Fetcher shared by calls to Get, so that they reuse its connections. It is
+// only replaced when the configuration from viper changes.
+func fromViper() *Fetcher {
+	cfg := ConfigFromViper()
+
+	sharedMu.Lock()
+	defer sharedMu.Unlock()
+	if shared == nil || !reflect.DeepEqual(cfg, sharedCfg) {
+		if shared != nil {
+			shared.client.CloseIdleConnections()
+		}
+		shared, sharedCfg = New(cfg), cfg
+	}
+	return shared
+}
+
+// Get fetches rawURL, returning the body of a successful response. Reading more than the maximum size
+// from the body returns ErrTooLarge. Requests the configuration does not allow fail with an error
+// wrapping ErrNotAllowed, and failures of the remote server with an *Error.
+func (f *Fetcher) Get(ctx context.Context, rawURL string) (io.ReadCloser, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := f.checkURL(u); err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrNotAllowed) {
+			return nil, err
+		}
+		// the URL is already part of Error
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, &Error{URL: u.Redacted(), Err: err}
+	}
+	if resp.StatusCode/100 != 2 {
+		resp.Body.Close()
+		return nil, &Error{URL: u.Redacted(), StatusCode: resp.StatusCode, Err: fmt.Errorf("server returned %v", resp.Status)}
+	}
+	if resp.ContentLength > f.cfg.MaxSize {
+		resp.Body.Close()
+		return nil, ErrTooLarge
+	}
+	return &limitedBody{ReadCloser: resp.Body, url: u.Redacted(), remaining: f.cfg.MaxSize}, nil
+}
+
+// checkURL checks u against the allowed schemes and hosts
+func (f *Fetcher) checkURL(u *url.URL) error {
+	if !contains(f.cfg.AllowedSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("fetching %v URLs: %w", u.Scheme, ErrNotAllowed)
+	}
+	if u.Hostname() == "" {
+		return fmt.Errorf("URL %v has no host", u.Redacted())
+	}
+	if len(f.cfg.AllowedHosts) == 0 {
+		return nil
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	for _, allowed := range f.cfg.AllowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || (strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:])) {
+			return nil
+		}
+	}
+	return fmt.Errorf("fetching from host %v: %w", u.Hostname(), ErrNotAllowed)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if strings.ToLower(v) == s {
+			return true
+		}
+	}
+	return false
+}
+
+// nonPublicNetworks are the ranges that are not reachable on the public internet
+var nonPublicNetworks = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8",          // "this" network
+		"10.0.0.0/8",         // private
+		"100.64.0.0/10",      // carrier-grade NAT
+		"127.0.0.0/8",        // loopback
+		"169.254.0.0/16",     // link-local, including cloud metadata services
+		"172.16.0.0/12",      // private
+		"192.0.0.0/24",       // IETF protocol assignments
+		"192.168.0.0/16",     // private
+		"198.18.0.0/15",      // benchmarking
+		"224.0.0.0/4",        // multicast
+		"240.0.0.0/4",        // reserved, including broadcast
+		"::/128",             // unspecified
+		"::1/128",            // loopback
+		"64:ff9b::/96",       // IPv4/IPv6 translation, which can reach any IPv4 address
+		"fc00::/7",           // unique local
+		"fe80::/10",          // link-local
+		"ff00::/8",           // multicast
+		"2001:db8::/32",      // documentation
+		"2002::/16",          // 6to4, which can embed any IPv4 address
+		"2001::/32",          // Teredo, which can embed any IPv4 address
+		"100::/64",           // discard
+		"192.88.99.0/24",     // 6to4 relay anycast
+		"198.51.100.0/24",    // documentation
+		"203.0.113.0/24",     // documentation
+		"192.0.2.0/24",       // documentation
+		"255.255.255.255/32", // broadcast
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets
+}()
+
+// isPublic reports whether ip is a globally routable unicast address
+func isPublic(ip net.IP) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	for _, n := range nonPublicNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// limitedBody returns ErrTooLarge once more than remaining bytes have been read, and reports failures
+// to read the rest of the response as an *Error
+type limitedBody struct {
+	io.ReadCloser
+	url       string
+	remaining int64
+}
+
+func (l *limitedBody) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.ReadCloser.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n + int(l.remaining), ErrTooLarge
+	}
+	if err != nil && err != io.EOF {
+		err = &Error{URL: l.url, Err: err}
+	}
+	return n, err
+}
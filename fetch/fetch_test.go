@@ -0,0 +1,203 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fetch
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/small":
+			_, _ = w.Write([]byte("hello"))
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+		case "/chunked":
+			// no Content-Length, so the size is only known while reading
+			for i := 0; i < 10; i++ {
+				_, _ = w.Write([]byte(strings.Repeat("a", 10)))
+				w.(http.Flusher).Flush()
+			}
+		case "/slow":
+			time.Sleep(500 * time.Millisecond)
+			_, _ = w.Write([]byte("hello"))
+		case "/missing":
+			http.NotFound(w, r)
+		case "/redirect/1":
+			http.Redirect(w, r, "/small", http.StatusFound)
+		case "/redirect/2":
+			http.Redirect(w, r, "/redirect/1", http.StatusFound)
+		case "/redirect/away":
+			http.Redirect(w, r, "ftp://example.com/small", http.StatusFound)
+		}
+	}))
+	defer server.Close()
+
+	// the test server is on a loopback address, which is only reachable when allowed
+	base := Config{MaxSize: 50, MaxRedirects: 1, Timeout: 5 * time.Second, AllowPrivateAddresses: true}
+
+	type TestCase struct {
+		caseDesc   string
+		config     func(cfg *Config)
+		path       string
+		errorFound bool
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Small content", config: func(cfg *Config) {}, path: "/small", errorFound: false},
+		{caseDesc: "Content-Length over the maximum size", config: func(cfg *Config) {}, path: "/large", errorFound: true},
+		{caseDesc: "Streamed content over the maximum size", config: func(cfg *Config) {}, path: "/chunked", errorFound: true},
+		{caseDesc: "Content at the maximum size", config: func(cfg *Config) { cfg.MaxSize = 100 }, path: "/chunked", errorFound: false},
+		{caseDesc: "Error status", config: func(cfg *Config) {}, path: "/missing", errorFound: true},
+		{caseDesc: "Request timeout", config: func(cfg *Config) { cfg.Timeout = 100 * time.Millisecond }, path: "/slow", errorFound: true},
+		{caseDesc: "Redirect within the limit", config: func(cfg *Config) {}, path: "/redirect/1", errorFound: false},
+		{caseDesc: "Too many redirects", config: func(cfg *Config) {}, path: "/redirect/2", errorFound: true},
+		{caseDesc: "Redirect to a disallowed scheme", config: func(cfg *Config) {}, path: "/redirect/away", errorFound: true},
+		{caseDesc: "Scheme not allowed", config: func(cfg *Config) { cfg.AllowedSchemes = []string{"https"} }, path: "/small", errorFound: true},
+		{caseDesc: "Host allowed", config: func(cfg *Config) { cfg.AllowedHosts = []string{"127.0.0.1"} }, path: "/small", errorFound: false},
+		{caseDesc: "Host not allowed", config: func(cfg *Config) { cfg.AllowedHosts = []string{"example.com", "*.example.com"} }, path: "/small", errorFound: true},
+		{caseDesc: "Loopback address blocked", config: func(cfg *Config) { cfg.AllowPrivateAddresses = false }, path: "/small", errorFound: true},
+	}
+
+	for _, tc := range testCases {
+		cfg := base
+		tc.config(&cfg)
+		body, err := New(cfg).Get(context.Background(), server.URL+tc.path)
+		if err == nil {
+			_, err = ioutil.ReadAll(body)
+			body.Close()
+		}
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result fetching %v: %v", tc.caseDesc, tc.path, err)
+		}
+	}
+
+	body, err := New(base).Get(context.Background(), server.URL+"/chunked")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer body.Close()
+	if _, err := ioutil.ReadAll(body); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("expected ErrTooLarge reading content over the maximum size, got %v", err)
+	}
+
+	// requests that are not allowed are told apart from failures of the remote server
+	if _, err := New(Config{}).Get(context.Background(), server.URL+"/small"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed fetching from a loopback address, got %v", err)
+	}
+	if _, err := Get(context.Background(), server.URL+"/small"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed fetching from a loopback address without configuration, got %v", err)
+	}
+	if _, err := New(Config{AllowedSchemes: []string{"https"}}).Get(context.Background(), server.URL+"/small"); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("expected ErrNotAllowed fetching a disallowed scheme, got %v", err)
+	}
+	var fetchErr *Error
+	if _, err := New(base).Get(context.Background(), server.URL+"/missing"); !errors.As(err, &fetchErr) || fetchErr.StatusCode != http.StatusNotFound || fetchErr.Timeout() {
+		t.Errorf("expected an error with the status of the response, got %v", err)
+	}
+	if _, err := New(Config{Timeout: 100 * time.Millisecond, AllowPrivateAddresses: true}).Get(context.Background(), server.URL+"/slow"); !errors.As(err, &fetchErr) || !fetchErr.Timeout() {
+		t.Errorf("expected a timeout error, got %v", err)
+	}
+}
+
+func TestSharedFetcher(t *testing.T) {
+	defer viper.Set("fetch.max_size", nil)
+
+	viper.Set("fetch.max_size", 1024)
+	f := fromViper()
+	if fromViper() != f {
+		t.Errorf("fetcher should be reused while the configuration is unchanged")
+	}
+
+	viper.Set("fetch.max_size", 2048)
+	changed := fromViper()
+	if changed == f || changed.cfg.MaxSize != 2048 {
+		t.Errorf("fetcher should be replaced when the configuration changes")
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	f := New(Config{AllowedHosts: []string{"example.com", "*.example.org"}})
+	for rawURL, allowed := range map[string]bool{
+		"https://example.com/a":          true,
+		"https://EXAMPLE.com./a":         true,
+		"http://example.com:8080/a":      true,
+		"https://sub.example.com/a":      false,
+		"https://a.b.example.org/a":      true,
+		"https://example.org/a":          false,
+		"https://evilexample.org/a":      false,
+		"https://example.com.evil.net/a": false,
+		"file:///etc/passwd":             false,
+		"gopher://example.com/a":         false,
+	} {
+		if err := f.checkURL(mustParse(t, rawURL)); (err == nil) != allowed {
+			t.Errorf("%v: expected allowed %v, got %v", rawURL, allowed, err)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"8.8.8.8":                true,
+		"1.1.1.1":                true,
+		"2606:4700::1111":        true,
+		"::ffff:8.8.8.8":         true,
+		"127.0.0.1":              false,
+		"10.1.2.3":               false,
+		"172.16.0.1":             false,
+		"172.32.0.1":             true,
+		"192.168.1.1":            false,
+		"169.254.169.254":        false,
+		"100.64.0.1":             false,
+		"0.0.0.0":                false,
+		"224.0.0.1":              false,
+		"255.255.255.255":        false,
+		"::1":                    false,
+		"::":                     false,
+		"::ffff:127.0.0.1":       false,
+		"::ffff:169.254.169.254": false,
+		"fe80::1":                false,
+		"fd00::1":                false,
+		"64:ff9b::a00:1":         false,
+		"2002:a00:1::":           false,
+	} {
+		if got := isPublic(net.ParseIP(addr)); got != public {
+			t.Errorf("%v: expected public %v, got %v", addr, public, got)
+		}
+	}
+}
+
+func mustParse(t *testing.T, rawURL string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
@@ -7,9 +7,12 @@ require (
 	github.com/golang/protobuf v1.4.2
 	github.com/google/trillian v1.3.10
 	github.com/in-toto/in-toto-golang v0.0.0-20200909170033-41ca13528b69 // indirect
+	github.com/klauspost/compress v1.11.13
 	github.com/mitchellh/go-homedir v1.1.0
 	github.com/spf13/cobra v1.0.0
 	github.com/spf13/viper v1.7.1
+	github.com/ulikunitz/xz v0.5.8
+	go.etcd.io/bbolt v1.3.5
 	go.uber.org/zap v1.16.0
 	golang.org/x/crypto v0.0.0-20200311171314-f7b00557c8c4
 	golang.org/x/sync v0.0.0-20200317015054-43a5402ce75a
@@ -0,0 +1,100 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltIndex is an Index persisted to a local bbolt database file. Each index key is a bucket whose
+// keys are the UUIDs of matching entries, and whose values are the sequence numbers used to keep
+// lookups in insertion order.
+type BoltIndex struct {
+	db *bolt.DB
+}
+
+// NewBoltIndex opens or creates the index stored at path
+func NewBoltIndex(path string) (*BoltIndex, error) {
+	if path == "" {
+		return nil, fmt.Errorf("a path is required for the bolt index backend")
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening index at %v: %w", path, err)
+	}
+	return &BoltIndex{db: db}, nil
+}
+
+// Insert implements the Index interface
+func (b *BoltIndex) Insert(uuid string, keys []string) error {
+	return b.db.Update(func(tx *bolt.Tx) error {
+		for _, key := range keys {
+			bucket, err := tx.CreateBucketIfNotExists([]byte(key))
+			if err != nil {
+				return err
+			}
+			if bucket.Get([]byte(uuid)) != nil {
+				continue
+			}
+			seq, err := bucket.NextSequence()
+			if err != nil {
+				return err
+			}
+			if err := bucket.Put([]byte(uuid), []byte(fmt.Sprintf("%020d", seq))); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Lookup implements the Index interface
+func (b *BoltIndex) Lookup(key string) ([]string, error) {
+	bySeq := map[string]string{}
+	var seqs []string
+
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(key))
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(uuid, seq []byte) error {
+			bySeq[string(seq)] = string(uuid)
+			seqs = append(seqs, string(seq))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(seqs)
+	uuids := make([]string, 0, len(seqs))
+	for _, seq := range seqs {
+		uuids = append(uuids, bySeq[seq])
+	}
+	return uuids, nil
+}
+
+// Close implements the Index interface
+func (b *BoltIndex) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,87 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/projectrekor/rekor-server/pki"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// Index maps attributes of log entries to the UUIDs of the entries that have them
+type Index interface {
+	// Insert associates the entry uuid with each of keys
+	Insert(uuid string, keys []string) error
+	// Lookup returns the UUIDs of the entries associated with key, in insertion order
+	Lookup(key string) ([]string, error)
+	Close() error
+}
+
+// New creates an Index using the named backend; path is only used by backends that persist to disk
+func New(backend, path string) (Index, error) {
+	switch backend {
+	case "", "memory":
+		return NewMemoryIndex(), nil
+	case "bolt":
+		return NewBoltIndex(path)
+	default:
+		return nil, fmt.Errorf("unknown index backend '%v'", backend)
+	}
+}
+
+// HashKey is the index key for an artifact's SHA-256 digest
+func HashKey(sha string) string {
+	return "sha256:" + strings.ToLower(sha)
+}
+
+// FingerprintKey is the index key for a public key fingerprint or key ID
+func FingerprintKey(fingerprint string) string {
+	fingerprint = strings.ToLower(strings.ReplaceAll(fingerprint, " ", ""))
+	return "key:" + strings.TrimPrefix(fingerprint, "0x")
+}
+
+// EmailKey is the index key for an email address bound to a public key
+func EmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// UserIDKey is the index key for a user ID bound to a public key, in full or by its name alone
+func UserIDKey(id string) string {
+	return "uid:" + strings.ToLower(strings.TrimSpace(id))
+}
+
+// KeysForLeaf returns the index keys under which an entry should be found
+func KeysForLeaf(leaf *types.RekorLeaf) []string {
+	keys := []string{HashKey(leaf.SHA)}
+
+	if ids, ok := leaf.PublicKeyObject().(pki.KeyIdentities); ok {
+		for _, fp := range ids.Fingerprints() {
+			keys = append(keys, FingerprintKey(fp))
+		}
+		for _, email := range ids.EmailAddresses() {
+			keys = append(keys, EmailKey(email))
+		}
+	}
+	if ids, ok := leaf.PublicKeyObject().(pki.KeyUserIDs); ok {
+		for _, id := range ids.UserIDs() {
+			keys = append(keys, UserIDKey(id))
+		}
+	}
+	return keys
+}
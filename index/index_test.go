@@ -0,0 +1,84 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestIndexBackends(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "index.db")
+
+	backends := map[string]func() (Index, error){
+		"memory": func() (Index, error) { return New("memory", "") },
+		"bolt":   func() (Index, error) { return New("bolt", dbPath) },
+	}
+
+	for name, open := range backends {
+		idx, err := open()
+		if err != nil {
+			t.Fatalf("%v: error creating index: %v", name, err)
+		}
+
+		if err := idx.Insert("uuid1", []string{HashKey("ABCD"), EmailKey("Test@Rekor.dev")}); err != nil {
+			t.Errorf("%v: error inserting: %v", name, err)
+		}
+		if err := idx.Insert("uuid2", []string{HashKey("abcd"), FingerprintKey("0x86F5 7552")}); err != nil {
+			t.Errorf("%v: error inserting: %v", name, err)
+		}
+		// inserting the same association twice must not duplicate it
+		if err := idx.Insert("uuid1", []string{HashKey("abcd")}); err != nil {
+			t.Errorf("%v: error inserting: %v", name, err)
+		}
+
+		lookups := map[string][]string{
+			HashKey("abcd"):             {"uuid1", "uuid2"},
+			EmailKey("test@rekor.dev"):  {"uuid1"},
+			FingerprintKey("86f57552"):  {"uuid2"},
+			EmailKey("other@rekor.dev"): {},
+		}
+		for key, expected := range lookups {
+			got, err := idx.Lookup(key)
+			if err != nil {
+				t.Errorf("%v: error looking up %v: %v", name, key, err)
+			}
+			if !reflect.DeepEqual(got, expected) {
+				t.Errorf("%v: lookup of %v returned %v, expected %v", name, key, got, expected)
+			}
+		}
+
+		if err := idx.Close(); err != nil {
+			t.Errorf("%v: error closing index: %v", name, err)
+		}
+	}
+
+	// the bolt index must survive being reopened
+	idx, err := NewBoltIndex(dbPath)
+	if err != nil {
+		t.Fatalf("error reopening bolt index: %v", err)
+	}
+	defer idx.Close()
+	if got, _ := idx.Lookup(HashKey("abcd")); !reflect.DeepEqual(got, []string{"uuid1", "uuid2"}) {
+		t.Errorf("reopened bolt index returned %v", got)
+	}
+
+	if _, err := New("bogus", ""); err == nil {
+		t.Errorf("unexpected success creating unknown backend")
+	}
+}
@@ -0,0 +1,67 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package index
+
+import (
+	"sync"
+)
+
+// MemoryIndex is an Index held in memory; its contents are lost when the process exits
+type MemoryIndex struct {
+	mu      sync.RWMutex
+	entries map[string][]string
+}
+
+// NewMemoryIndex creates an empty in-memory index
+func NewMemoryIndex() *MemoryIndex {
+	return &MemoryIndex{entries: map[string][]string{}}
+}
+
+// Insert implements the Index interface
+func (m *MemoryIndex) Insert(uuid string, keys []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, key := range keys {
+		if !contains(m.entries[key], uuid) {
+			m.entries[key] = append(m.entries[key], uuid)
+		}
+	}
+	return nil
+}
+
+// Lookup implements the Index interface
+func (m *MemoryIndex) Lookup(key string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]string{}, m.entries[key]...), nil
+}
+
+// Close implements the Index interface
+func (m *MemoryIndex) Close() error {
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,268 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package models holds the request and response bodies of the rekor API. Each type corresponds to a
+// schema of the same name in the OpenAPI document, and the two are kept in step by the package tests.
+package models
+
+import (
+	"encoding/json"
+
+	"github.com/google/trillian"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// StatusCode carries the name of the gRPC status returned by the log server
+type StatusCode struct {
+	Code string `json:"code"`
+}
+
+// MarshalJSON also writes the code under file_recieved, the deprecated name existing v1 clients read it from
+func (s StatusCode) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Code       string `json:"code"`
+		LegacyCode string `json:"file_recieved"`
+	}{s.Code, s.Code})
+}
+
+// UnmarshalJSON also accepts the names the code was sent under by older servers
+func (s *StatusCode) UnmarshalJSON(b []byte) error {
+	var v struct {
+		Code         *string `json:"code"`
+		ReceivedCode *string `json:"file_received"`
+		LegacyCode   *string `json:"file_recieved"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	s.Code = firstString(v.Code, v.ReceivedCode, v.LegacyCode)
+	return nil
+}
+
+// UploadedFile echoes the name of the file submitted in a multipart request
+type UploadedFile struct {
+	File string `json:"file_received"`
+}
+
+// MarshalJSON also writes the name under file_recieved, the deprecated name existing v1 clients read it from
+func (u UploadedFile) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		File       string `json:"file_received"`
+		LegacyFile string `json:"file_recieved"`
+	}{u.File, u.File})
+}
+
+// UnmarshalJSON also accepts the misspelt field name sent by older servers
+func (u *UploadedFile) UnmarshalJSON(b []byte) error {
+	var v struct {
+		File       *string `json:"file_received"`
+		LegacyFile *string `json:"file_recieved"`
+	}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	u.File = firstString(v.File, v.LegacyFile)
+	return nil
+}
+
+// firstString returns the first of the values of a field under its current and older names that is set
+func firstString(values ...*string) string {
+	for _, v := range values {
+		if v != nil {
+			return *v
+		}
+	}
+	return ""
+}
+
+// ErrorResponse is the body returned for every failed request
+type ErrorResponse struct {
+	Code      int         `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"requestID,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+}
+
+// ProposedEntry is an entry submitted to the add endpoint; get and getproof read only the leaf fields
+// (Format, SHA, Signature and PublicKey)
+type ProposedEntry struct {
+	Format       string `json:",omitempty"`
+	SHA          string `json:",omitempty"`
+	Signature    []byte `json:",omitempty"`
+	PublicKey    []byte `json:",omitempty"`
+	Data         []byte `json:",omitempty"`
+	URL          string `json:",omitempty"`
+	SignatureURL string `json:",omitempty"`
+	PublicKeyURL string `json:",omitempty"`
+	Decompress   bool   `json:",omitempty"`
+}
+
+// ExistingEntry identifies the entry in the log that an add request duplicated
+type ExistingEntry struct {
+	UUID     string
+	LogIndex *int64 `json:",omitempty"`
+}
+
+type AddResponse struct {
+	Status               StatusCode
+	UUID                 string                      `json:",omitempty"`
+	SignedEntryTimestamp *types.SignedEntryTimestamp `json:",omitempty"`
+}
+
+type GetResponse struct {
+	Status       StatusCode
+	FileReceived UploadedFile
+	Leaves       []*trillian.LogLeaf
+}
+
+// MarshalJSON also writes FileReceived as FileRecieved, the deprecated name existing v1 clients read it from
+func (r GetResponse) MarshalJSON() ([]byte, error) {
+	type plain GetResponse
+	return json.Marshal(struct {
+		plain
+		FileRecieved UploadedFile
+	}{plain(r), r.FileReceived})
+}
+
+// UnmarshalJSON also accepts the misspelt FileRecieved field sent by older servers
+func (r *GetResponse) UnmarshalJSON(b []byte) error {
+	type plain GetResponse
+	v := struct {
+		*plain
+		FileRecieved *UploadedFile
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.FileRecieved != nil && r.FileReceived == (UploadedFile{}) {
+		r.FileReceived = *v.FileRecieved
+	}
+	return nil
+}
+
+type GetLatestResponse struct {
+	Status StatusCode
+	Proof  *trillian.GetLatestSignedLogRootResponse
+	Key    []byte
+}
+
+type GetProofResponse struct {
+	Status       string
+	FileReceived UploadedFile
+	Proof        *trillian.GetInclusionProofByHashResponse
+	Key          []byte
+}
+
+// MarshalJSON also writes FileReceived as FileRecieved, the deprecated name existing v1 clients read it from
+func (r GetProofResponse) MarshalJSON() ([]byte, error) {
+	type plain GetProofResponse
+	return json.Marshal(struct {
+		plain
+		FileRecieved UploadedFile
+	}{plain(r), r.FileReceived})
+}
+
+// UnmarshalJSON also accepts the misspelt FileRecieved field sent by older servers
+func (r *GetProofResponse) UnmarshalJSON(b []byte) error {
+	type plain GetProofResponse
+	v := struct {
+		*plain
+		FileRecieved *UploadedFile
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	if v.FileRecieved != nil && r.FileReceived == (UploadedFile{}) {
+		r.FileReceived = *v.FileRecieved
+	}
+	return nil
+}
+
+type GetLeafResponse struct {
+	Status StatusCode
+	Leaf   *trillian.GetLeavesByIndexResponse
+	Key    []byte
+}
+
+type ConsistencyProofResponse struct {
+	Status        StatusCode
+	FirstSize     int64
+	LastSize      int64
+	FirstRootHash []byte
+	LastRootHash  []byte
+	Proof         *trillian.GetConsistencyProofResponse
+	Key           []byte
+}
+
+type InclusionProof struct {
+	TreeSize int64
+	RootHash []byte
+	Hashes   [][]byte
+}
+
+// LogEntry is an entry in the log, addressed by its UUID (the hex encoded Merkle leaf hash)
+type LogEntry struct {
+	UUID           string
+	LogIndex       int64
+	IntegratedTime int64
+	Entry          *types.RekorLeaf
+}
+
+// LogEntryResponse is a LogEntry together with the proof of its inclusion in the log
+type LogEntryResponse struct {
+	LogEntry
+	InclusionProof InclusionProof
+}
+
+// Bundle holds everything needed to verify, with no access to the log, that an entry is included in it
+type Bundle struct {
+	// UUID is the hex encoded Merkle leaf hash of LeafValue
+	UUID           string
+	LogIndex       int64
+	LeafValue      []byte
+	InclusionProof InclusionProof
+	// SignedCheckpoint is the signed note committing to the tree the inclusion proof is for
+	SignedCheckpoint string
+	// PublicKey is the PEM encoded key of the log that signed the checkpoint
+	PublicKey []byte
+}
+
+type EntriesRangeResponse struct {
+	Entries []LogEntry
+	// Errors lists the leaves in the range that could not be decoded, which are missing from Entries
+	Errors        []EntryError `json:",omitempty"`
+	NextPageToken string       `json:",omitempty"`
+}
+
+// EntryError reports a leaf that is in the log but could not be decoded as an entry
+type EntryError struct {
+	UUID     string
+	LogIndex int64
+	Error    string
+}
+
+// SearchIndexRequest finds the UUIDs of entries matching all of the non-empty fields
+type SearchIndexRequest struct {
+	Hash                 string
+	PublicKeyFingerprint string
+	Email                string
+	// UserID matches a user ID of the public key in full, such as "Name (comment) <email>", or its name
+	UserID string
+}
+
+type SearchIndexResponse struct {
+	UUIDs []string
+}
@@ -0,0 +1,299 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/google/trillian"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+type schema struct {
+	Ref        string             `json:"$ref"`
+	Properties map[string]*schema `json:"properties"`
+	AllOf      []*schema          `json:"allOf"`
+	Deprecated bool               `json:"deprecated"`
+}
+
+type document struct {
+	Info struct {
+		Version string
+	}
+	Components struct {
+		Schemas map[string]*schema
+	}
+}
+
+func loadDocument(t *testing.T) document {
+	t.Helper()
+
+	var doc document
+	if err := json.Unmarshal([]byte(OpenAPI), &doc); err != nil {
+		t.Fatalf("OpenAPI document is not valid JSON: %v", err)
+	}
+	return doc
+}
+
+// properties returns the names of the properties of the named schema, following allOf references. Deprecated
+// properties are left out, as models only write them from MarshalJSON
+func (d document) properties(name string) []string {
+	var names []string
+	var collect func(s *schema)
+	collect = func(s *schema) {
+		if s.Ref != "" {
+			collect(d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")])
+			return
+		}
+		for p, prop := range s.Properties {
+			if !prop.Deprecated {
+				names = append(names, p)
+			}
+		}
+		for _, sub := range s.AllOf {
+			collect(sub)
+		}
+	}
+	if s, ok := d.Components.Schemas[name]; ok {
+		collect(s)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonFields returns the names that encoding/json uses for the fields of t
+func jsonFields(t reflect.Type) []string {
+	var names []string
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			names = append(names, jsonFields(f.Type)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if tag == "" {
+			tag = f.Name
+		}
+		names = append(names, tag)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestModelsMatchOpenAPI(t *testing.T) {
+	doc := loadDocument(t)
+
+	models := map[string][]reflect.Type{
+		"StatusCode":                      {reflect.TypeOf(StatusCode{})},
+		"UploadedFile":                    {reflect.TypeOf(UploadedFile{})},
+		"ErrorResponse":                   {reflect.TypeOf(ErrorResponse{})},
+		"ExistingEntry":                   {reflect.TypeOf(ExistingEntry{})},
+		"AddResponse":                     {reflect.TypeOf(AddResponse{})},
+		"GetResponse":                     {reflect.TypeOf(GetResponse{})},
+		"GetLatestResponse":               {reflect.TypeOf(GetLatestResponse{})},
+		"GetProofResponse":                {reflect.TypeOf(GetProofResponse{})},
+		"GetLeafResponse":                 {reflect.TypeOf(GetLeafResponse{})},
+		"ConsistencyProofResponse":        {reflect.TypeOf(ConsistencyProofResponse{})},
+		"InclusionProof":                  {reflect.TypeOf(InclusionProof{})},
+		"LogEntry":                        {reflect.TypeOf(LogEntry{})},
+		"LogEntryResponse":                {reflect.TypeOf(LogEntryResponse{})},
+		"EntriesRangeResponse":            {reflect.TypeOf(EntriesRangeResponse{})},
+		"EntryError":                      {reflect.TypeOf(EntryError{})},
+		"Bundle":                          {reflect.TypeOf(Bundle{})},
+		"SearchIndexRequest":              {reflect.TypeOf(SearchIndexRequest{})},
+		"SearchIndexResponse":             {reflect.TypeOf(SearchIndexResponse{})},
+		"RekorLeaf":                       {reflect.TypeOf(types.RekorLeaf{})},
+		"ProposedEntry":                   {reflect.TypeOf(ProposedEntry{})},
+		"EntryTimestamp":                  {reflect.TypeOf(types.EntryTimestamp{})},
+		"SignedEntryTimestamp":            {reflect.TypeOf(types.SignedEntryTimestamp{})},
+		"Timestamp":                       {reflect.TypeOf(timestamp.Timestamp{})},
+		"LogLeaf":                         {reflect.TypeOf(trillian.LogLeaf{})},
+		"SignedLogRoot":                   {reflect.TypeOf(trillian.SignedLogRoot{})},
+		"Proof":                           {reflect.TypeOf(trillian.Proof{})},
+		"GetLatestSignedLogRootResponse":  {reflect.TypeOf(trillian.GetLatestSignedLogRootResponse{})},
+		"GetInclusionProofByHashResponse": {reflect.TypeOf(trillian.GetInclusionProofByHashResponse{})},
+		"GetConsistencyProofResponse":     {reflect.TypeOf(trillian.GetConsistencyProofResponse{})},
+		"GetLeavesByIndexResponse":        {reflect.TypeOf(trillian.GetLeavesByIndexResponse{})},
+	}
+
+	// the server parses a ProposedEntry as a RekorEntry and its RekorLeaf
+	parsed := append(jsonFields(reflect.TypeOf(types.RekorEntry{})), jsonFields(reflect.TypeOf(types.RekorLeaf{}))...)
+	sort.Strings(parsed)
+	if proposed := jsonFields(reflect.TypeOf(ProposedEntry{})); !reflect.DeepEqual(proposed, parsed) {
+		t.Errorf("ProposedEntry encodes %v, but the server parses %v", proposed, parsed)
+	}
+
+	for name := range doc.Components.Schemas {
+		if _, ok := models[name]; !ok {
+			t.Errorf("schema %v has no corresponding model", name)
+		}
+	}
+
+	for name, goTypes := range models {
+		var fields []string
+		for _, goType := range goTypes {
+			fields = append(fields, jsonFields(goType)...)
+		}
+		sort.Strings(fields)
+
+		if props := doc.properties(name); !reflect.DeepEqual(props, fields) {
+			t.Errorf("schema %v has properties %v, but the model encodes %v", name, props, fields)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	doc := loadDocument(t)
+
+	if doc.Info.Version == "" {
+		t.Errorf("OpenAPI document has no version")
+	}
+
+	// every reference must resolve to a defined schema or response
+	var refs []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, sub := range v {
+				if ref, ok := sub.(string); ok && k == "$ref" {
+					refs = append(refs, ref)
+				}
+				walk(sub)
+			}
+		case []interface{}:
+			for _, sub := range v {
+				walk(sub)
+			}
+		}
+	}
+	var raw interface{}
+	if err := json.Unmarshal([]byte(OpenAPI), &raw); err != nil {
+		t.Fatal(err)
+	}
+	walk(raw)
+
+	components := raw.(map[string]interface{})["components"].(map[string]interface{})
+	for _, ref := range refs {
+		parts := strings.Split(strings.TrimPrefix(ref, "#/components/"), "/")
+		if len(parts) != 2 {
+			t.Errorf("unexpected reference %v", ref)
+			continue
+		}
+		section, ok := components[parts[0]].(map[string]interface{})
+		if !ok {
+			t.Errorf("reference %v is to an unknown section", ref)
+			continue
+		}
+		if _, ok := section[parts[1]]; !ok {
+			t.Errorf("reference %v does not resolve", ref)
+		}
+	}
+}
+
+func TestLegacyFieldNames(t *testing.T) {
+	type TestCase struct {
+		caseDesc string
+		body     string
+		expected GetResponse
+	}
+
+	testCases := []TestCase{
+		{
+			caseDesc: "current field names",
+			body:     `{"Status": {"code": "OK"}, "FileReceived": {"file_received": "a.json"}}`,
+			expected: GetResponse{Status: StatusCode{Code: "OK"}, FileReceived: UploadedFile{File: "a.json"}},
+		},
+		{
+			caseDesc: "field names from 1.7.0 servers",
+			body:     `{"Status": {"file_received": "OK"}, "FileReceived": {"file_received": "a.json"}}`,
+			expected: GetResponse{Status: StatusCode{Code: "OK"}, FileReceived: UploadedFile{File: "a.json"}},
+		},
+		{
+			caseDesc: "misspelt field names from older servers",
+			body:     `{"Status": {"file_recieved": "OK"}, "FileRecieved": {"file_recieved": "a.json"}}`,
+			expected: GetResponse{Status: StatusCode{Code: "OK"}, FileReceived: UploadedFile{File: "a.json"}},
+		},
+		{
+			caseDesc: "current field names take precedence",
+			body:     `{"Status": {"code": "OK", "file_recieved": "NOT_FOUND"}, "FileReceived": {"file_received": "a.json"}, "FileRecieved": {"file_received": "b.json"}}`,
+			expected: GetResponse{Status: StatusCode{Code: "OK"}, FileReceived: UploadedFile{File: "a.json"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		var resp GetResponse
+		if err := json.Unmarshal([]byte(tc.body), &resp); err != nil {
+			t.Errorf("%v: unexpected error: %v", tc.caseDesc, err)
+			continue
+		}
+		if !reflect.DeepEqual(resp, tc.expected) {
+			t.Errorf("%v: got %+v, expected %+v", tc.caseDesc, resp, tc.expected)
+		}
+	}
+
+	var proof GetProofResponse
+	if err := json.Unmarshal([]byte(`{"Status": "OK", "FileRecieved": {"file_recieved": "a.json"}}`), &proof); err != nil {
+		t.Fatal(err)
+	}
+	if proof.Status != "OK" || proof.FileReceived.File != "a.json" {
+		t.Errorf("misspelt fields of GetProofResponse were not read: %+v", proof)
+	}
+
+	// existing clients still find every value under the misspelt names
+	b, err := json.Marshal(GetResponse{Status: StatusCode{Code: "OK"}, FileReceived: UploadedFile{File: "a.json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy struct {
+		Status struct {
+			Code string `json:"file_recieved"`
+		}
+		FileRecieved struct {
+			File string `json:"file_recieved"`
+		}
+	}
+	if err := json.Unmarshal(b, &legacy); err != nil {
+		t.Fatal(err)
+	}
+	if legacy.Status.Code != "OK" || legacy.FileRecieved.File != "a.json" {
+		t.Errorf("misspelt fields were not written: %s", b)
+	}
+	b, err = json.Marshal(GetProofResponse{Status: "OK", FileReceived: UploadedFile{File: "a.json"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacyProof struct {
+		FileRecieved struct {
+			File string `json:"file_recieved"`
+		}
+	}
+	if err := json.Unmarshal(b, &legacyProof); err != nil || legacyProof.FileRecieved.File != "a.json" {
+		t.Errorf("misspelt fields of GetProofResponse were not written: %s", b)
+	}
+}
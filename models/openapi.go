@@ -0,0 +1,1448 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package models
+
+// OpenAPI is the OpenAPI 3 description of the v1 API, served at /api/v1/openapi.json. Bump
+// info.version whenever the contract changes.
+const OpenAPI = `{
+  "openapi": "3.0.3",
+  "info": {
+    "title": "Rekor",
+    "description": "Rekor is a transparency log for signed software artifacts.",
+    "version": "1.10.0",
+    "license": {
+      "name": "Apache 2.0",
+      "url": "http://www.apache.org/licenses/LICENSE-2.0"
+    }
+  },
+  "servers": [
+    {
+      "url": "/api/v1"
+    }
+  ],
+  "paths": {
+    "/add": {
+      "post": {
+        "operationId": "addEntry",
+        "summary": "Add an entry to the log",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/ProposedEntry"
+              }
+            },
+            "multipart/form-data": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "fileupload": {
+                    "type": "string",
+                    "format": "binary",
+                    "description": "a JSON encoded ProposedEntry"
+                  }
+                },
+                "required": [
+                  "fileupload"
+                ]
+              },
+              "encoding": {
+                "fileupload": {
+                  "contentType": "application/json"
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The entry was queued for inclusion",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/AddResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "409": {
+            "description": "An identical entry is already in the log; details is an ExistingEntry",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "413": {
+            "$ref": "#/components/responses/TooLarge"
+          },
+          "502": {
+            "$ref": "#/components/responses/BadGateway"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "504": {
+            "$ref": "#/components/responses/GatewayTimeout"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/get": {
+      "post": {
+        "operationId": "getLeaves",
+        "summary": "Find the leaves matching an entry",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/ProposedEntry"
+              }
+            },
+            "multipart/form-data": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "fileupload": {
+                    "type": "string",
+                    "format": "binary",
+                    "description": "a JSON encoded ProposedEntry"
+                  }
+                },
+                "required": [
+                  "fileupload"
+                ]
+              },
+              "encoding": {
+                "fileupload": {
+                  "contentType": "application/json"
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "Matching leaves",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/GetResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "413": {
+            "$ref": "#/components/responses/TooLarge"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/getproof": {
+      "post": {
+        "operationId": "getProof",
+        "summary": "Get an inclusion proof for an entry",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/ProposedEntry"
+              }
+            },
+            "multipart/form-data": {
+              "schema": {
+                "type": "object",
+                "properties": {
+                  "fileupload": {
+                    "type": "string",
+                    "format": "binary",
+                    "description": "a JSON encoded ProposedEntry"
+                  }
+                },
+                "required": [
+                  "fileupload"
+                ]
+              },
+              "encoding": {
+                "fileupload": {
+                  "contentType": "application/json"
+                }
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "The inclusion proof",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/GetProofResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "413": {
+            "$ref": "#/components/responses/TooLarge"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/latest": {
+      "post": {
+        "operationId": "getLatest",
+        "summary": "Get the latest signed log root",
+        "parameters": [
+          {
+            "name": "lastSize",
+            "in": "query",
+            "description": "tree size of a previously seen root to prove consistency with",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The latest signed log root",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/GetLatestResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/getleaf": {
+      "get": {
+        "operationId": "getLeafByIndex",
+        "summary": "Get a leaf by its index",
+        "parameters": [
+          {
+            "name": "leafindex",
+            "in": "query",
+            "description": "index of the leaf",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The leaf",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/GetLeafResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/checkpoint": {
+      "get": {
+        "operationId": "getCheckpoint",
+        "summary": "Get the latest signed checkpoint",
+        "responses": {
+          "200": {
+            "description": "A signed note committing to the current tree size and root hash",
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/publicKey": {
+      "get": {
+        "operationId": "getPublicKey",
+        "summary": "Get the public key of the log",
+        "responses": {
+          "200": {
+            "description": "The PEM encoded public key",
+            "content": {
+              "application/x-pem-file": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/proof/consistency": {
+      "get": {
+        "operationId": "getConsistencyProof",
+        "summary": "Get a proof that the log at one size is a prefix of the log at another",
+        "parameters": [
+          {
+            "name": "first",
+            "in": "query",
+            "description": "the smaller tree size",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 1
+            }
+          },
+          {
+            "name": "last",
+            "in": "query",
+            "description": "the larger tree size; defaults to the current size",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64"
+            }
+          },
+          {
+            "name": "firstRootHash",
+            "in": "query",
+            "description": "hex encoded root hash of the log at the first tree size, from the caller's checkpoint; the proof is checked against it if the server has not seen a signed log root for that size",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "pattern": "^[0-9a-fA-F]{64}$"
+            }
+          },
+          {
+            "name": "lastRootHash",
+            "in": "query",
+            "description": "hex encoded root hash of the log at the last tree size, from the caller's checkpoint; the proof is checked against it if the server has not seen a signed log root for that size",
+            "required": false,
+            "schema": {
+              "type": "string",
+              "pattern": "^[0-9a-fA-F]{64}$"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The consistency proof, checked against the root hashes in the response when both are set",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ConsistencyProofResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "409": {
+            "description": "A given root hash is not consistent with the log, so the caller's checkpoint and the log have forked",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/ErrorResponse"
+                }
+              }
+            }
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/entries": {
+      "get": {
+        "operationId": "getLogEntryByIndex",
+        "summary": "Get an entry and its inclusion proof by log index",
+        "parameters": [
+          {
+            "name": "logIndex",
+            "in": "query",
+            "description": "index of the entry in the log",
+            "required": true,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The entry",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/LogEntryResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/entries/range": {
+      "get": {
+        "operationId": "getLogEntries",
+        "summary": "Page through consecutive entries",
+        "parameters": [
+          {
+            "name": "start",
+            "in": "query",
+            "description": "index of the first entry",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0,
+              "default": 0
+            }
+          },
+          {
+            "name": "pageSize",
+            "in": "query",
+            "description": "maximum number of entries to return",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 1
+            }
+          },
+          {
+            "name": "pageToken",
+            "in": "query",
+            "description": "NextPageToken from a previous page; overrides start",
+            "required": false,
+            "schema": {
+              "type": "string"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "A page of entries",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/EntriesRangeResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/entries/stream": {
+      "get": {
+        "operationId": "streamLogEntries",
+        "summary": "Stream entries as they are integrated into the log",
+        "description": "Sends each newly integrated entry as a server-sent event if the client accepts text/event-stream, and as newline delimited JSON otherwise. Event IDs are log indexes. A leaf that cannot be decoded is sent as an EntryError, in an event of type error or as a JSON object with an Error field, so that every index is accounted for. A client that falls behind is sent the entries it missed from the log, and a client that disconnects can resume from the last entry it received.",
+        "parameters": [
+          {
+            "name": "start",
+            "in": "query",
+            "description": "index of the first entry to send, which may already be in the log; by default only entries integrated after the request are sent",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            }
+          },
+          {
+            "name": "Last-Event-ID",
+            "in": "header",
+            "description": "index of the last entry received, to resume a stream of server-sent events",
+            "required": false,
+            "schema": {
+              "type": "integer",
+              "format": "int64",
+              "minimum": 0
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "A stream of entries",
+            "content": {
+              "text/event-stream": {
+                "schema": {
+                  "type": "string",
+                  "description": "events of type entry, each holding a LogEntry as JSON, or of type error, holding an EntryError as JSON"
+                }
+              },
+              "application/x-ndjson": {
+                "schema": {
+                  "oneOf": [
+                    {
+                      "$ref": "#/components/schemas/LogEntry"
+                    },
+                    {
+                      "$ref": "#/components/schemas/EntryError"
+                    }
+                  ]
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/entries/{uuid}": {
+      "get": {
+        "operationId": "getLogEntryByUUID",
+        "summary": "Get an entry and its inclusion proof by UUID",
+        "parameters": [
+          {
+            "name": "uuid",
+            "in": "path",
+            "required": true,
+            "description": "hex encoded Merkle leaf hash",
+            "schema": {
+              "type": "string",
+              "pattern": "^[0-9a-fA-F]{64}$"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The entry",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/LogEntryResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/log/entries/{uuid}/bundle": {
+      "get": {
+        "operationId": "getLogEntryBundle",
+        "summary": "Get an offline verification bundle for an entry by UUID",
+        "parameters": [
+          {
+            "name": "uuid",
+            "in": "path",
+            "required": true,
+            "description": "hex encoded Merkle leaf hash",
+            "schema": {
+              "type": "string",
+              "pattern": "^[0-9a-fA-F]{64}$"
+            }
+          }
+        ],
+        "responses": {
+          "200": {
+            "description": "The bundle",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/Bundle"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "404": {
+            "$ref": "#/components/responses/NotFound"
+          },
+          "503": {
+            "$ref": "#/components/responses/Unavailable"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/index/retrieve": {
+      "post": {
+        "operationId": "searchIndex",
+        "summary": "Find entries by artifact hash, public key fingerprint, email address or user ID",
+        "requestBody": {
+          "required": true,
+          "content": {
+            "application/json": {
+              "schema": {
+                "$ref": "#/components/schemas/SearchIndexRequest"
+              }
+            }
+          }
+        },
+        "responses": {
+          "200": {
+            "description": "UUIDs of matching entries",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "$ref": "#/components/schemas/SearchIndexResponse"
+                }
+              }
+            }
+          },
+          "400": {
+            "$ref": "#/components/responses/BadRequest"
+          },
+          "500": {
+            "$ref": "#/components/responses/InternalError"
+          }
+        }
+      }
+    },
+    "/openapi.json": {
+      "get": {
+        "operationId": "getOpenAPI",
+        "summary": "Get this document",
+        "responses": {
+          "200": {
+            "description": "The OpenAPI document",
+            "content": {
+              "application/json": {
+                "schema": {
+                  "type": "object"
+                }
+              }
+            }
+          }
+        }
+      }
+    },
+    "/ping": {
+      "get": {
+        "operationId": "ping",
+        "summary": "Check that the server is running",
+        "responses": {
+          "200": {
+            "description": "The server is running",
+            "content": {
+              "text/plain": {
+                "schema": {
+                  "type": "string"
+                }
+              }
+            }
+          }
+        }
+      }
+    }
+  },
+  "components": {
+    "schemas": {
+      "StatusCode": {
+        "type": "object",
+        "properties": {
+          "code": {
+            "type": "string",
+            "description": "name of the gRPC status code returned by the log server, e.g. OK"
+          },
+          "file_recieved": {
+            "type": "string",
+            "deprecated": true,
+            "description": "the same value as code, under the name clients of earlier versions of this API read it from"
+          }
+        },
+        "description": "Status of the request to the log server; servers before version 1.10.0 of this API send the code only under a field named file_recieved or, from 1.7.0, file_received"
+      },
+      "UploadedFile": {
+        "type": "object",
+        "properties": {
+          "file_received": {
+            "type": "string",
+            "description": "name of the uploaded file"
+          },
+          "file_recieved": {
+            "type": "string",
+            "deprecated": true,
+            "description": "the same value as file_received, under the name clients of earlier versions of this API read it from"
+          }
+        }
+      },
+      "ErrorResponse": {
+        "type": "object",
+        "properties": {
+          "code": {
+            "type": "integer",
+            "description": "HTTP status code"
+          },
+          "message": {
+            "type": "string"
+          },
+          "requestID": {
+            "type": "string"
+          },
+          "details": {
+            "description": "additional information about the error; an ExistingEntry for 409 responses"
+          }
+        },
+        "required": [
+          "code",
+          "message"
+        ]
+      },
+      "ExistingEntry": {
+        "type": "object",
+        "properties": {
+          "UUID": {
+            "type": "string"
+          },
+          "LogIndex": {
+            "type": "integer",
+            "format": "int64",
+            "description": "absent while the entry is queued for integration"
+          }
+        },
+        "description": "The entry already in the log that a submission duplicated",
+        "required": [
+          "UUID"
+        ]
+      },
+      "ProposedEntry": {
+        "type": "object",
+        "properties": {
+          "Format": {
+            "type": "string",
+            "description": "format of Signature and PublicKey",
+            "enum": [
+              "pgp",
+              "x509",
+              "minisign",
+              "ssh"
+            ],
+            "default": "pgp"
+          },
+          "SHA": {
+            "type": "string",
+            "description": "hex encoded SHA-256 of the content as submitted, which is the compressed content if Decompress is set; required with URL",
+            "pattern": "^[0-9a-fA-F]{64}$"
+          },
+          "Signature": {
+            "type": "string",
+            "format": "byte",
+            "description": "the signature of the content; either Signature or SignatureURL is required"
+          },
+          "PublicKey": {
+            "type": "string",
+            "format": "byte",
+            "description": "the public key that verifies Signature; either PublicKey or PublicKeyURL is required"
+          },
+          "Data": {
+            "type": "string",
+            "format": "byte",
+            "description": "the signed content; either Data or URL is required"
+          },
+          "URL": {
+            "type": "string",
+            "format": "uri",
+            "description": "location of the signed content"
+          },
+          "SignatureURL": {
+            "type": "string",
+            "format": "uri",
+            "description": "location of the signature, fetched when the entry is added"
+          },
+          "PublicKeyURL": {
+            "type": "string",
+            "format": "uri",
+            "description": "location of the public key, fetched when the entry is added; PGP keys can also be looked up by fingerprint or email with hkp://host/<search> or hkps://host/<search>, or in a Web Key Directory with wkd:<email>"
+          },
+          "Decompress": {
+            "type": "boolean",
+            "default": false,
+            "description": "whether the signature covers the decompressed content rather than the bytes as submitted; the content must then be compressed with gzip, bzip2, xz or zstd; it is recorded in the log entry"
+          }
+        },
+        "description": "An entry submitted for inclusion in the log"
+      },
+      "RekorLeaf": {
+        "type": "object",
+        "properties": {
+          "Format": {
+            "type": "string",
+            "description": "omitted for pgp entries"
+          },
+          "SHA": {
+            "type": "string",
+            "description": "hex encoded SHA-256 of the content as submitted, which is the compressed content if Decompress is set"
+          },
+          "Signature": {
+            "type": "string",
+            "format": "byte",
+            "description": "canonical encoding of the signature"
+          },
+          "PublicKey": {
+            "type": "string",
+            "format": "byte",
+            "description": "canonical encoding of the public key"
+          },
+          "Decompress": {
+            "type": "boolean",
+            "description": "whether the signature covers the decompressed artifact rather than the compressed bytes submitted; omitted when false"
+          }
+        },
+        "description": "The value stored in the log for an entry"
+      },
+      "EntryTimestamp": {
+        "type": "object",
+        "properties": {
+          "LogID": {
+            "type": "string",
+            "description": "hex encoded SHA-256 of the DER encoded log public key"
+          },
+          "LeafHash": {
+            "type": "string",
+            "description": "hex encoded Merkle leaf hash"
+          },
+          "QueuedTime": {
+            "type": "integer",
+            "format": "int64",
+            "description": "seconds since the Unix epoch at which the log queued the entry, before it is integrated into the tree"
+          }
+        }
+      },
+      "SignedEntryTimestamp": {
+        "type": "object",
+        "properties": {
+          "Payload": {
+            "$ref": "#/components/schemas/EntryTimestamp"
+          },
+          "Signature": {
+            "type": "string",
+            "format": "byte",
+            "description": "signature by the log key over the JSON encoded Payload"
+          }
+        },
+        "description": "A promise by the log to integrate an entry"
+      },
+      "AddResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "$ref": "#/components/schemas/StatusCode"
+          },
+          "UUID": {
+            "type": "string"
+          },
+          "SignedEntryTimestamp": {
+            "$ref": "#/components/schemas/SignedEntryTimestamp"
+          }
+        }
+      },
+      "GetResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "$ref": "#/components/schemas/StatusCode"
+          },
+          "FileReceived": {
+            "$ref": "#/components/schemas/UploadedFile"
+          },
+          "FileRecieved": {
+            "allOf": [
+              {
+                "$ref": "#/components/schemas/UploadedFile"
+              }
+            ],
+            "deprecated": true,
+            "description": "the same value as FileReceived, under the name clients of earlier versions of this API read it from"
+          },
+          "Leaves": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/LogLeaf"
+            }
+          }
+        }
+      },
+      "GetLatestResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "$ref": "#/components/schemas/StatusCode"
+          },
+          "Proof": {
+            "$ref": "#/components/schemas/GetLatestSignedLogRootResponse"
+          },
+          "Key": {
+            "type": "string",
+            "format": "byte",
+            "description": "DER encoded log public key"
+          }
+        }
+      },
+      "GetProofResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "type": "string"
+          },
+          "FileReceived": {
+            "$ref": "#/components/schemas/UploadedFile"
+          },
+          "FileRecieved": {
+            "allOf": [
+              {
+                "$ref": "#/components/schemas/UploadedFile"
+              }
+            ],
+            "deprecated": true,
+            "description": "the same value as FileReceived, under the name clients of earlier versions of this API read it from"
+          },
+          "Proof": {
+            "$ref": "#/components/schemas/GetInclusionProofByHashResponse"
+          },
+          "Key": {
+            "type": "string",
+            "format": "byte",
+            "description": "DER encoded log public key"
+          }
+        }
+      },
+      "GetLeafResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "$ref": "#/components/schemas/StatusCode"
+          },
+          "Leaf": {
+            "$ref": "#/components/schemas/GetLeavesByIndexResponse"
+          },
+          "Key": {
+            "type": "string",
+            "format": "byte",
+            "description": "DER encoded log public key"
+          }
+        }
+      },
+      "ConsistencyProofResponse": {
+        "type": "object",
+        "properties": {
+          "Status": {
+            "$ref": "#/components/schemas/StatusCode"
+          },
+          "FirstSize": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "LastSize": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "FirstRootHash": {
+            "type": "string",
+            "format": "byte",
+            "description": "Root hash of the log at FirstSize, from a signed log root this server has seen or else from firstRootHash; omitted if neither is known, and the caller checks the proof against its own checkpoint"
+          },
+          "LastRootHash": {
+            "type": "string",
+            "format": "byte",
+            "description": "Root hash of the log at LastSize, from a signed log root this server has seen or else from lastRootHash; omitted if neither is known, and the caller checks the proof against its own checkpoint"
+          },
+          "Proof": {
+            "$ref": "#/components/schemas/GetConsistencyProofResponse"
+          },
+          "Key": {
+            "type": "string",
+            "format": "byte",
+            "description": "DER encoded log public key"
+          }
+        }
+      },
+      "InclusionProof": {
+        "type": "object",
+        "properties": {
+          "TreeSize": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "RootHash": {
+            "type": "string",
+            "format": "byte"
+          },
+          "Hashes": {
+            "type": "array",
+            "items": {
+              "type": "string",
+              "format": "byte"
+            }
+          }
+        }
+      },
+      "LogEntry": {
+        "type": "object",
+        "properties": {
+          "UUID": {
+            "type": "string",
+            "description": "hex encoded Merkle leaf hash"
+          },
+          "LogIndex": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "IntegratedTime": {
+            "type": "integer",
+            "format": "int64",
+            "description": "seconds since the Unix epoch"
+          },
+          "Entry": {
+            "$ref": "#/components/schemas/RekorLeaf"
+          }
+        }
+      },
+      "LogEntryResponse": {
+        "allOf": [
+          {
+            "$ref": "#/components/schemas/LogEntry"
+          },
+          {
+            "type": "object",
+            "properties": {
+              "InclusionProof": {
+                "$ref": "#/components/schemas/InclusionProof"
+              }
+            }
+          }
+        ]
+      },
+      "Bundle": {
+        "type": "object",
+        "description": "Everything needed to verify the inclusion of an entry in the log without contacting it",
+        "properties": {
+          "UUID": {
+            "type": "string",
+            "description": "hex encoded Merkle leaf hash of LeafValue"
+          },
+          "LogIndex": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "LeafValue": {
+            "type": "string",
+            "format": "byte",
+            "description": "the JSON encoded RekorLeaf stored in the log"
+          },
+          "InclusionProof": {
+            "$ref": "#/components/schemas/InclusionProof"
+          },
+          "SignedCheckpoint": {
+            "type": "string",
+            "description": "signed note committing to the tree size and root hash of the inclusion proof"
+          },
+          "PublicKey": {
+            "type": "string",
+            "format": "byte",
+            "description": "PEM encoded public key of the log"
+          }
+        }
+      },
+      "EntriesRangeResponse": {
+        "type": "object",
+        "properties": {
+          "Entries": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/LogEntry"
+            }
+          },
+          "Errors": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/EntryError"
+            },
+            "description": "leaves in the range that could not be decoded, which are missing from Entries; absent when there are none"
+          },
+          "NextPageToken": {
+            "type": "string",
+            "description": "pass as pageToken to fetch the next page; absent on the last page"
+          }
+        }
+      },
+      "EntryError": {
+        "type": "object",
+        "properties": {
+          "UUID": {
+            "type": "string",
+            "description": "hex encoded Merkle leaf hash"
+          },
+          "LogIndex": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "Error": {
+            "type": "string"
+          }
+        }
+      },
+      "SearchIndexRequest": {
+        "type": "object",
+        "properties": {
+          "Hash": {
+            "type": "string",
+            "description": "hex encoded SHA-256 of the signed content"
+          },
+          "PublicKeyFingerprint": {
+            "type": "string"
+          },
+          "Email": {
+            "type": "string"
+          },
+          "UserID": {
+            "type": "string",
+            "description": "a user ID of the public key in full, such as \"Name (comment) <email>\", or its name alone"
+          }
+        },
+        "description": "Criteria that matching entries must all satisfy; at least one is required"
+      },
+      "SearchIndexResponse": {
+        "type": "object",
+        "properties": {
+          "UUIDs": {
+            "type": "array",
+            "items": {
+              "type": "string"
+            }
+          }
+        }
+      },
+      "Timestamp": {
+        "type": "object",
+        "properties": {
+          "seconds": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "nanos": {
+            "type": "integer",
+            "format": "int32"
+          }
+        }
+      },
+      "LogLeaf": {
+        "type": "object",
+        "properties": {
+          "merkle_leaf_hash": {
+            "type": "string",
+            "format": "byte"
+          },
+          "leaf_value": {
+            "type": "string",
+            "format": "byte",
+            "description": "a JSON encoded RekorLeaf"
+          },
+          "extra_data": {
+            "type": "string",
+            "format": "byte"
+          },
+          "leaf_index": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "leaf_identity_hash": {
+            "type": "string",
+            "format": "byte"
+          },
+          "queue_timestamp": {
+            "$ref": "#/components/schemas/Timestamp"
+          },
+          "integrate_timestamp": {
+            "$ref": "#/components/schemas/Timestamp"
+          }
+        },
+        "description": "A Trillian log leaf"
+      },
+      "SignedLogRoot": {
+        "type": "object",
+        "properties": {
+          "key_hint": {
+            "type": "string",
+            "format": "byte"
+          },
+          "log_root": {
+            "type": "string",
+            "format": "byte",
+            "description": "a TLS encoded Trillian LogRootV1"
+          },
+          "log_root_signature": {
+            "type": "string",
+            "format": "byte"
+          }
+        }
+      },
+      "Proof": {
+        "type": "object",
+        "properties": {
+          "leaf_index": {
+            "type": "integer",
+            "format": "int64"
+          },
+          "hashes": {
+            "type": "array",
+            "items": {
+              "type": "string",
+              "format": "byte"
+            }
+          }
+        }
+      },
+      "GetLatestSignedLogRootResponse": {
+        "type": "object",
+        "properties": {
+          "signed_log_root": {
+            "$ref": "#/components/schemas/SignedLogRoot"
+          },
+          "proof": {
+            "$ref": "#/components/schemas/Proof"
+          }
+        }
+      },
+      "GetInclusionProofByHashResponse": {
+        "type": "object",
+        "properties": {
+          "proof": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/Proof"
+            }
+          },
+          "signed_log_root": {
+            "$ref": "#/components/schemas/SignedLogRoot"
+          }
+        }
+      },
+      "GetConsistencyProofResponse": {
+        "type": "object",
+        "properties": {
+          "proof": {
+            "$ref": "#/components/schemas/Proof"
+          },
+          "signed_log_root": {
+            "$ref": "#/components/schemas/SignedLogRoot"
+          }
+        }
+      },
+      "GetLeavesByIndexResponse": {
+        "type": "object",
+        "properties": {
+          "leaves": {
+            "type": "array",
+            "items": {
+              "$ref": "#/components/schemas/LogLeaf"
+            }
+          },
+          "signed_log_root": {
+            "$ref": "#/components/schemas/SignedLogRoot"
+          }
+        }
+      }
+    },
+    "responses": {
+      "BadRequest": {
+        "description": "The request is invalid",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "NotFound": {
+        "description": "The entry does not exist",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "TooLarge": {
+        "description": "The request body exceeds the maximum upload size",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "Unavailable": {
+        "description": "The log server is unavailable; retry later",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "BadGateway": {
+        "description": "Content referenced by the entry could not be fetched from its server",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "GatewayTimeout": {
+        "description": "The server holding content referenced by the entry did not respond in time",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      },
+      "InternalError": {
+        "description": "An unexpected error occurred",
+        "content": {
+          "application/json": {
+            "schema": {
+              "$ref": "#/components/schemas/ErrorResponse"
+            }
+          }
+        }
+      }
+    }
+  }
+}`
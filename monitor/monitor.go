@@ -0,0 +1,311 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package monitor audits a log by checking that each new signed root is consistent with the last one
+// it verified
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/client"
+	"github.com/projectrekor/rekor-server/logging"
+)
+
+// State is the last log root verified by the monitor, persisted between runs
+type State struct {
+	TreeSize       uint64
+	RootHash       []byte
+	TimestampNanos uint64
+	// PublicKey is the DER encoded key the log's tree roots are signed with, pinned on the first run if no
+	// key was configured
+	PublicKey []byte
+	// ScannedSize is the number of leaves checked against the watch list
+	ScannedSize uint64 `json:",omitempty"`
+	// ScannedRange holds the roots of the perfect subtrees covering the scanned leaves
+	ScannedRange [][]byte `json:",omitempty"`
+}
+
+// LoadState reads the state saved at path, returning an empty state if there is none yet
+func LoadState(path string) (*State, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &State{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var s State
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("parsing monitor state %v: %w", path, err)
+	}
+	return &s, nil
+}
+
+// Save atomically replaces the state saved at path
+func (s *State) Save(path string) error {
+	b, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (s *State) root() *ttypes.LogRootV1 {
+	return &ttypes.LogRootV1{TreeSize: s.TreeSize, RootHash: s.RootHash, TimestampNanos: s.TimestampNanos}
+}
+
+// Alert reports that the log failed an audit: a root was not signed by the log key, or was not
+// consistent with the last verified root
+type Alert struct {
+	Server   string
+	TreeSize uint64
+	RootHash []byte
+	Reason   string
+	Time     time.Time
+}
+
+func (a *Alert) Error() string {
+	return fmt.Sprintf("log %v failed audit after verified tree size %d: %v", a.Server, a.TreeSize, a.Reason)
+}
+
+// Config configures a Monitor
+type Config struct {
+	ServerURL string
+	StatePath string
+	// PublicKey is the trusted key the log's tree roots are signed with, as returned by client.TreeKey. If
+	// nil, the key pinned in the state is used, or else the key served by the log is trusted and pinned on
+	// first use.
+	PublicKey crypto.PublicKey
+	// Watch lists the identities and artifacts to report in new entries. If it is empty, entries are
+	// not scanned.
+	Watch WatchList
+	// WebhookURL, if set, receives each Alert and Match as a JSON POST, with the kind of event in the
+	// X-Rekor-Monitor-Event header
+	WebhookURL string
+	HTTPClient *http.Client
+}
+
+// Monitor periodically verifies the latest root of a log
+type Monitor struct {
+	cfg     Config
+	state   *State
+	client  *client.Client
+	watched map[string]bool
+}
+
+// New returns a monitor resuming from the state saved at cfg.StatePath
+func New(cfg Config) (*Monitor, error) {
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	state, err := LoadState(cfg.StatePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.PublicKey != nil {
+		der, err := x509.MarshalPKIXPublicKey(cfg.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		if len(state.PublicKey) != 0 && !bytes.Equal(state.PublicKey, der) {
+			return nil, fmt.Errorf("log public key does not match the key pinned in %v", cfg.StatePath)
+		}
+		state.PublicKey = der
+	}
+
+	m := &Monitor{cfg: cfg, state: state, watched: cfg.Watch.keys()}
+	if len(state.PublicKey) != 0 {
+		if err := m.pin(state.PublicKey); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// State returns the last verified state
+func (m *Monitor) State() State {
+	return *m.state
+}
+
+func (m *Monitor) pin(der []byte) error {
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return fmt.Errorf("parsing log public key: %w", err)
+	}
+	m.client, err = client.New(m.cfg.ServerURL, client.WithHTTPClient(m.cfg.HTTPClient), client.WithPublicKey(pub))
+	return err
+}
+
+// Check fetches the latest root of the log and verifies it against the last verified root, then scans
+// any new entries for items on the watch list. The root is saved as the new state if it passes. A
+// failed audit is returned as an *Alert; alerts and matches are logged and sent to the webhook before
+// Check returns. Other errors are transient.
+func (m *Monitor) Check(ctx context.Context) (*ttypes.LogRootV1, []Match, error) {
+	if m.client == nil {
+		if err := m.trustOnFirstUse(ctx); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var trusted *ttypes.LogRootV1
+	if m.state.TreeSize > 0 {
+		trusted = m.state.root()
+	}
+	root, err := m.client.Latest(ctx, trusted)
+	if client.IsVerificationError(err) {
+		return nil, nil, m.raise(ctx, &Alert{Reason: err.Error()})
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	var matches []Match
+	if len(m.watched) > 0 && root.TreeSize > m.state.ScannedSize {
+		var alert *Alert
+		matches, err = m.scan(ctx, root)
+		if errors.As(err, &alert) {
+			return nil, nil, m.raise(ctx, alert)
+		} else if client.IsVerificationError(err) {
+			return nil, nil, m.raise(ctx, &Alert{Reason: err.Error()})
+		} else if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	m.state.TreeSize = root.TreeSize
+	m.state.RootHash = root.RootHash
+	m.state.TimestampNanos = root.TimestampNanos
+	if err := m.state.Save(m.cfg.StatePath); err != nil {
+		return nil, nil, fmt.Errorf("saving monitor state: %w", err)
+	}
+
+	for _, match := range matches {
+		logging.Logger.Warnf("entry %v at log index %d matches watched %v", match.UUID, match.LogIndex, strings.Join(match.Matched, ", "))
+		if err := m.notify(ctx, "match", match); err != nil {
+			logging.Logger.Errorf("sending match to webhook: %v", err)
+		}
+	}
+	return root, matches, nil
+}
+
+// raise completes alert with the last verified state and sends it to the webhook
+func (m *Monitor) raise(ctx context.Context, alert *Alert) *Alert {
+	alert.Server = m.cfg.ServerURL
+	alert.TreeSize = m.state.TreeSize
+	alert.RootHash = m.state.RootHash
+	alert.Time = time.Now().UTC()
+	if err := m.notify(ctx, "alert", alert); err != nil {
+		logging.Logger.Errorf("sending alert to webhook: %v", err)
+	}
+	return alert
+}
+
+// Run checks the log every interval until ctx is done or the log fails an audit, which is returned
+// as an *Alert. Transient errors are logged and retried at the next interval.
+func (m *Monitor) Run(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		root, _, err := m.Check(ctx)
+		var alert *Alert
+		switch {
+		case errors.As(err, &alert):
+			return err
+		case err != nil:
+			logging.Logger.Warnf("checking log %v: %v", m.cfg.ServerURL, err)
+		default:
+			logging.Logger.Infof("verified log %v at tree size %d, root hash %x", m.cfg.ServerURL, root.TreeSize, root.RootHash)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) trustOnFirstUse(ctx context.Context) error {
+	c, err := client.New(m.cfg.ServerURL, client.WithHTTPClient(m.cfg.HTTPClient))
+	if err != nil {
+		return err
+	}
+	// log roots are signed with the tree key, not the key the log signs checkpoints with
+	pub, err := c.TreeKey(ctx)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	logging.Logger.Warnf("no log public key configured, pinning the key served by %v", m.cfg.ServerURL)
+	if err := m.pin(der); err != nil {
+		return err
+	}
+	m.state.PublicKey = der
+	return nil
+}
+
+func (m *Monitor) notify(ctx context.Context, event string, v interface{}) error {
+	if m.cfg.WebhookURL == "" {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, m.cfg.WebhookURL, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Rekor-Monitor-Event", event)
+	resp, err := m.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
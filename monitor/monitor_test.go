@@ -0,0 +1,415 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/trillian"
+	tcrypto "github.com/google/trillian/crypto"
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/pki"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// fakeLog serves signed roots, consistency proofs and entries for an in-memory tree
+type fakeLog struct {
+	t *testing.T
+
+	mu          sync.Mutex
+	signer      *ecdsa.PrivateKey // the tree key, which signs log roots
+	checkpoint  *ecdsa.PrivateKey // the different key served as the log's public key, as it signs checkpoints
+	tree        *merkle.InMemoryMerkleTree
+	leaves      [][]byte
+	seed        int  // varies the artifact hashes of new leaves, so that forks hold different leaves
+	swap        bool // serve a leaf that is not in the tree at index 1
+	undecodable bool // report the leaf at index 1 as one the log cannot decode
+}
+
+func newFakeLog(t *testing.T, size int) (*fakeLog, *httptest.Server) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	checkpoint, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	f := &fakeLog{t: t, signer: signer, checkpoint: checkpoint}
+	f.reset(size)
+	server := httptest.NewServer(f)
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func readTestData(t *testing.T, name string) []byte {
+	t.Helper()
+	b, err := ioutil.ReadFile("../pki/testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// testLeaf returns the leaf value of an entry for the artifact with the given digest, signed with the
+// PGP test key if pgp is set and with the x509 test key otherwise
+func testLeaf(t *testing.T, sha string, pgp bool) []byte {
+	entry := map[string]interface{}{
+		"SHA":       sha,
+		"Signature": readTestData(t, "hello_world.txt.asc.sig"),
+		"PublicKey": readTestData(t, "valid_armored_complex_public.pgp"),
+	}
+	if !pgp {
+		entry["Format"] = "x509"
+		entry["Signature"] = readTestData(t, "hello_world.txt.ec.sig")
+		entry["PublicKey"] = readTestData(t, "x509_ec_public.pem")
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := types.ParseRekorLeaf(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafValue, err := json.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leafValue
+}
+
+// grow appends n entries, alternately signed with the PGP and x509 test keys
+func (f *fakeLog) grow(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := 0; i < n; i++ {
+		index := len(f.leaves)
+		leafValue := testLeaf(f.t, fmt.Sprintf("%032x%032x", f.seed, index), index%2 == 0)
+		f.tree.AddLeaf(leafValue)
+		f.leaves = append(f.leaves, leafValue)
+	}
+}
+
+// reset replaces the tree with one of size leaves that differ from any served before
+func (f *fakeLog) reset(size int) {
+	f.mu.Lock()
+	f.seed++
+	f.tree = merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher)
+	f.leaves = nil
+	f.mu.Unlock()
+	f.grow(size)
+}
+
+// fork replaces the tree with one of the same size holding different leaves
+func (f *fakeLog) fork() {
+	f.reset(len(f.leaves))
+}
+
+func (f *fakeLog) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	der, err := x509.MarshalPKIXPublicKey(f.signer.Public())
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	writeJSON := func(v interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(v)
+	}
+
+	switch r.URL.Path {
+	case "/api/v1/log/publicKey":
+		checkpointDER, err := x509.MarshalPKIXPublicKey(f.checkpoint.Public())
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		_ = pem.Encode(w, &pem.Block{Type: "PUBLIC KEY", Bytes: checkpointDER})
+	case "/api/v1/latest":
+		size := f.tree.LeafCount()
+		slr, err := tcrypto.NewSigner(0, f.signer, crypto.SHA256).SignLogRoot(&ttypes.LogRootV1{
+			TreeSize:       uint64(size),
+			RootHash:       f.tree.CurrentRoot().Hash(),
+			TimestampNanos: uint64(time.Now().UnixNano()),
+		})
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		resp := &trillian.GetLatestSignedLogRootResponse{SignedLogRoot: slr, Proof: &trillian.Proof{}}
+		if lastSize, err := strconv.ParseInt(r.URL.Query().Get("lastSize"), 10, 64); err == nil && lastSize <= size {
+			for _, node := range f.tree.SnapshotConsistency(lastSize, size) {
+				resp.Proof.Hashes = append(resp.Proof.Hashes, node.Value.Hash())
+			}
+		}
+		writeJSON(models.GetLatestResponse{Status: models.StatusCode{Code: "OK"}, Proof: resp, Key: der})
+	case "/api/v1/log/entries/range":
+		start, _ := strconv.Atoi(r.URL.Query().Get("start"))
+		pageSize, _ := strconv.Atoi(r.URL.Query().Get("pageSize"))
+		resp := models.EntriesRangeResponse{Entries: []models.LogEntry{}}
+		for i := start; i < len(f.leaves) && i < start+pageSize; i++ {
+			leafValue := f.leaves[i]
+			if f.swap && i == 1 {
+				leafValue = testLeaf(f.t, strings.Repeat("f", 64), false)
+			}
+			uuid := hex.EncodeToString(rfc6962.DefaultHasher.HashLeaf(leafValue))
+			if f.undecodable && i == 1 {
+				resp.Errors = append(resp.Errors, models.EntryError{UUID: uuid, LogIndex: int64(i), Error: "invalid entry"})
+				continue
+			}
+			leaf, err := types.ParseRekorLeaf(bytes.NewReader(leafValue))
+			if err != nil {
+				f.t.Fatal(err)
+			}
+			resp.Entries = append(resp.Entries, models.LogEntry{
+				UUID:     uuid,
+				LogIndex: int64(i),
+				Entry:    leaf,
+			})
+		}
+		writeJSON(resp)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	ctx := context.Background()
+
+	type TestCase struct {
+		caseDesc   string
+		tamper     func(f *fakeLog)
+		errorFound bool
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Log grows", tamper: func(f *fakeLog) { f.grow(3) }, errorFound: false},
+		{caseDesc: "Log unchanged", tamper: func(f *fakeLog) {}, errorFound: false},
+		{caseDesc: "Log forked", tamper: func(f *fakeLog) { f.fork() }, errorFound: true},
+		{caseDesc: "Log forked and grown", tamper: func(f *fakeLog) { f.fork(); f.grow(2) }, errorFound: true},
+		{caseDesc: "Log shrank", tamper: func(f *fakeLog) { f.reset(2) }, errorFound: true},
+		{caseDesc: "Log key changed", tamper: func(f *fakeLog) {
+			f.signer, _ = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		}, errorFound: true},
+	}
+
+	for _, tc := range testCases {
+		fake, server := newFakeLog(t, 5)
+		var alerts []Alert
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var alert Alert
+			if err := json.NewDecoder(r.Body).Decode(&alert); err != nil {
+				t.Error(err)
+			}
+			alerts = append(alerts, alert)
+		}))
+		defer webhook.Close()
+
+		statePath := filepath.Join(t.TempDir(), "state.json")
+		cfg := Config{ServerURL: server.URL, StatePath: statePath, WebhookURL: webhook.URL}
+		m, err := New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := m.Check(ctx); err != nil {
+			t.Fatalf("%v: unexpected error on first check: %v", tc.caseDesc, err)
+		}
+
+		tc.tamper(fake)
+
+		// resume from the saved state, as a restarted monitor would
+		m, err = New(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _, err := m.Check(ctx)
+		var alert *Alert
+		if errors.As(err, &alert) != tc.errorFound {
+			t.Errorf("%v: unexpected result checking log: %v", tc.caseDesc, err)
+		}
+		if tc.errorFound != (len(alerts) == 1) {
+			t.Errorf("%v: expected webhook to be called %v, got %d alerts", tc.caseDesc, tc.errorFound, len(alerts))
+		}
+
+		state, err := LoadState(statePath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.errorFound && state.TreeSize != 5 {
+			t.Errorf("%v: state was updated after a failed audit to size %d", tc.caseDesc, state.TreeSize)
+		}
+		if !tc.errorFound && state.TreeSize != root.TreeSize {
+			t.Errorf("%v: saved state has size %d, expected %d", tc.caseDesc, state.TreeSize, root.TreeSize)
+		}
+	}
+}
+
+func TestMonitorPublicKey(t *testing.T) {
+	fake, server := newFakeLog(t, 1)
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	m, err := New(Config{ServerURL: server.URL, StatePath: statePath, PublicKey: otherKey.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alert *Alert
+	if _, _, err := m.Check(context.Background()); !errors.As(err, &alert) {
+		t.Errorf("expected an alert for a root not signed with the configured key, got %v", err)
+	}
+
+	m, err = New(Config{ServerURL: server.URL, StatePath: statePath, PublicKey: fake.signer.Public()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error checking log: %v", err)
+	}
+	if _, err := New(Config{ServerURL: server.URL, StatePath: statePath, PublicKey: otherKey.Public()}); err == nil {
+		t.Errorf("expected an error configuring a key that differs from the pinned key")
+	}
+}
+
+func TestMonitorWatchList(t *testing.T) {
+	ctx := context.Background()
+
+	key, err := pki.NewPGPPublicKey(bytes.NewReader(readTestData(t, "valid_armored_complex_public.pgp")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := strings.ToUpper(key.Fingerprints()[0])
+	email := key.EmailAddresses()[0]
+
+	type TestCase struct {
+		caseDesc string
+		watch    WatchList
+		// indexes of the entries expected to match, out of 5 entries followed by 4 more
+		matches []int64
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Fingerprint", watch: WatchList{Fingerprints: []string{fingerprint}}, matches: []int64{0, 2, 4, 6, 8}},
+		{caseDesc: "Email", watch: WatchList{Emails: []string{strings.ToUpper(email)}}, matches: []int64{0, 2, 4, 6, 8}},
+		{caseDesc: "Artifact hash", watch: WatchList{Hashes: []string{fmt.Sprintf("%032x%032x", 1, 7)}}, matches: []int64{7}},
+		{caseDesc: "Unknown identity", watch: WatchList{Emails: []string{"nobody@example.com"}}, matches: nil},
+	}
+
+	for _, tc := range testCases {
+		fake, server := newFakeLog(t, 5)
+		var webhookMatches int
+		webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("X-Rekor-Monitor-Event") == "match" {
+				webhookMatches++
+			}
+		}))
+		defer webhook.Close()
+
+		statePath := filepath.Join(t.TempDir(), "state.json")
+		cfg := Config{ServerURL: server.URL, StatePath: statePath, Watch: tc.watch, WebhookURL: webhook.URL}
+		var found []int64
+		for i := 0; i < 2; i++ {
+			m, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, matches, err := m.Check(ctx)
+			if err != nil {
+				t.Fatalf("%v: unexpected error checking log: %v", tc.caseDesc, err)
+			}
+			for _, match := range matches {
+				found = append(found, match.LogIndex)
+			}
+			fake.grow(4)
+		}
+
+		if fmt.Sprint(found) != fmt.Sprint(tc.matches) {
+			t.Errorf("%v: expected matches at %v, got %v", tc.caseDesc, tc.matches, found)
+		}
+		if webhookMatches != len(tc.matches) {
+			t.Errorf("%v: expected %d matches sent to webhook, got %d", tc.caseDesc, len(tc.matches), webhookMatches)
+		}
+	}
+}
+
+func TestMonitorScanVerification(t *testing.T) {
+	fake, server := newFakeLog(t, 5)
+	fake.swap = true
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	m, err := New(Config{ServerURL: server.URL, StatePath: statePath, Watch: WatchList{Emails: []string{"nobody@example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alert *Alert
+	if _, _, err := m.Check(context.Background()); !errors.As(err, &alert) {
+		t.Errorf("expected an alert for entries that are not in the verified tree, got %v", err)
+	}
+}
+
+func TestMonitorScanUndecodableEntry(t *testing.T) {
+	fake, server := newFakeLog(t, 5)
+	fake.undecodable = true
+	statePath := filepath.Join(t.TempDir(), "state.json")
+
+	m, err := New(Config{ServerURL: server.URL, StatePath: statePath, Watch: WatchList{Emails: []string{"nobody@example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := m.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error scanning past an undecodable entry: %v", err)
+	}
+	if state := m.State(); state.ScannedSize != 5 {
+		t.Errorf("expected 5 scanned entries, got %d", state.ScannedSize)
+	}
+
+	fake.grow(3)
+	if _, _, err := m.Check(context.Background()); err != nil {
+		t.Fatalf("unexpected error scanning new entries: %v", err)
+	}
+	if state := m.State(); state.ScannedSize != 8 {
+		t.Errorf("expected 8 scanned entries, got %d", state.ScannedSize)
+	}
+
+	// the hash reported for an undecodable leaf is still checked against the verified root
+	fake.reset(5)
+	fake.swap = true
+	m, err = New(Config{ServerURL: server.URL, StatePath: filepath.Join(t.TempDir(), "state.json"), Watch: WatchList{Emails: []string{"nobody@example.com"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var alert *Alert
+	if _, _, err := m.Check(context.Background()); !errors.As(err, &alert) {
+		t.Errorf("expected an alert for an undecodable entry that is not in the verified tree, got %v", err)
+	}
+}
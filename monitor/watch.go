@@ -0,0 +1,157 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package monitor
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/trillian/merkle/compact"
+	"github.com/google/trillian/merkle/rfc6962"
+	ttypes "github.com/google/trillian/types"
+	"github.com/projectrekor/rekor-server/index"
+	"github.com/projectrekor/rekor-server/logging"
+)
+
+// scanPageSize is the number of entries requested at a time while scanning
+const scanPageSize = 100
+
+var rangeFactory = &compact.RangeFactory{Hash: rfc6962.DefaultHasher.HashChildren}
+
+// WatchList holds the identities and artifacts to report when they appear in new entries
+type WatchList struct {
+	// Fingerprints are PGP fingerprints or key IDs, or the fingerprints of keys in other formats
+	Fingerprints []string
+	// Emails are the email addresses bound to the public key of an entry
+	Emails []string
+	// Hashes are SHA-256 digests of artifacts
+	Hashes []string
+}
+
+// keys returns the watched items as index keys, which are normalized the same way as the keys of an
+// entry returned by index.KeysForLeaf
+func (w WatchList) keys() map[string]bool {
+	keys := map[string]bool{}
+	for _, fp := range w.Fingerprints {
+		keys[index.FingerprintKey(fp)] = true
+	}
+	for _, email := range w.Emails {
+		keys[index.EmailKey(email)] = true
+	}
+	for _, hash := range w.Hashes {
+		keys[index.HashKey(hash)] = true
+	}
+	return keys
+}
+
+// Match reports an entry with an item on the watch list
+type Match struct {
+	Server         string
+	UUID           string
+	LogIndex       int64
+	IntegratedTime int64
+	// Matched lists the watched items found in the entry, as index keys such as "email:user@example.com"
+	Matched []string
+}
+
+// scan checks the entries added since the last scan up to the verified root against the watch list.
+// The leaves are accumulated in a compact range so that their root can be compared with the verified
+// root, which proves the log served the leaves it committed to.
+func (m *Monitor) scan(ctx context.Context, root *ttypes.LogRootV1) ([]Match, error) {
+	r, err := rangeFactory.NewRange(0, m.state.ScannedSize, m.state.ScannedRange)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scanned range in monitor state: %w", err)
+	}
+
+	var matches []Match
+	for r.End() < root.TreeSize {
+		pageSize := root.TreeSize - r.End()
+		if pageSize > scanPageSize {
+			pageSize = scanPageSize
+		}
+		entries, errored, err := m.client.GetEntriesRange(ctx, int64(r.End()), int64(pageSize))
+		if err != nil {
+			return nil, err
+		}
+
+		start, end := r.End(), r.End()+pageSize
+		for r.End() < end {
+			logIndex := int64(r.End())
+			// a leaf the log cannot decode is still committed to by the root, so its hash is appended as the
+			// log reports it and checked with the rest of the range
+			if len(errored) > 0 && errored[0].LogIndex == logIndex {
+				leafHash, err := hex.DecodeString(errored[0].UUID)
+				if err != nil {
+					return nil, err
+				}
+				if err := r.Append(leafHash, nil); err != nil {
+					return nil, err
+				}
+				logging.Logger.Warnf("entry %v at log index %d could not be decoded by the log and was not checked against the watch list: %v", errored[0].UUID, logIndex, errored[0].Error)
+				errored = errored[1:]
+				continue
+			}
+			if len(entries) == 0 || entries[0].LogIndex != logIndex {
+				break
+			}
+			entry := entries[0]
+			entries = entries[1:]
+
+			// the client checked that the UUID is the leaf hash of the entry
+			leafHash, err := hex.DecodeString(entry.UUID)
+			if err != nil {
+				return nil, err
+			}
+			if err := r.Append(leafHash, nil); err != nil {
+				return nil, err
+			}
+
+			var matched []string
+			for _, key := range index.KeysForLeaf(entry.Entry) {
+				if m.watched[key] {
+					matched = append(matched, key)
+				}
+			}
+			if len(matched) > 0 {
+				matches = append(matches, Match{
+					Server:         m.cfg.ServerURL,
+					UUID:           entry.UUID,
+					LogIndex:       entry.LogIndex,
+					IntegratedTime: entry.IntegratedTime,
+					Matched:        matched,
+				})
+			}
+		}
+		if r.End() == start {
+			return nil, &Alert{Reason: fmt.Sprintf("log returned no entry at index %d of verified tree size %d", start, root.TreeSize)}
+		}
+	}
+
+	rootHash, err := r.GetRootHash(nil)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(rootHash, root.RootHash) {
+		return nil, &Alert{Reason: fmt.Sprintf("entries served by the log hash to root %x, not the verified root %x of tree size %d", rootHash, root.RootHash, root.TreeSize)}
+	}
+
+	m.state.ScannedSize = r.End()
+	m.state.ScannedRange = r.Hashes()
+	return matches, nil
+}
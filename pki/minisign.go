@@ -0,0 +1,243 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+const (
+	minisignUntrustedPrefix = "untrusted comment: "
+	minisignTrustedPrefix   = "trusted comment: "
+
+	// minisignLegacyAlg signs the data itself, minisignHashedAlg signs its BLAKE2b-512 digest
+	minisignLegacyAlg = "Ed"
+	minisignHashedAlg = "ED"
+
+	// the untrusted comment is not covered by any signature, so it is replaced in canonical values
+	minisignCanonicalComment = "signature from minisign secret key"
+
+	minisignKeyIDLen = 8
+	minisignKeyLen   = 2 + minisignKeyIDLen + ed25519.PublicKeySize
+	minisignSigLen   = 2 + minisignKeyIDLen + ed25519.SignatureSize
+)
+
+func init() {
+	RegisterFormat("minisign",
+		func(r io.Reader) (Signature, error) {
+			s, err := NewMinisignSignature(r)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		func(r io.Reader) (PublicKey, error) {
+			k, err := NewMinisignPublicKey(r)
+			if err != nil {
+				return nil, err
+			}
+			return k, nil
+		})
+}
+
+// readMinisignLines returns the non-empty lines of a minisign file with line endings removed
+func readMinisignLines(r io.Reader) ([]string, error) {
+	var lines []string
+	scan := bufio.NewScanner(r)
+	for scan.Scan() {
+		line := strings.TrimRight(scan.Text(), "\r")
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := scan.Err(); err != nil {
+		return nil, err
+	}
+	return lines, nil
+}
+
+// MinisignSignature Signature that follows the minisign format; supports both legacy and prehashed Ed25519 signatures
+type MinisignSignature struct {
+	algorithm       string
+	keyID           []byte
+	signature       []byte
+	trustedComment  string
+	globalSignature []byte
+}
+
+// NewMinisignSignature creates and validates a minisign signature object
+func NewMinisignSignature(r io.Reader) (*MinisignSignature, error) {
+	lines, err := readMinisignLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read minisign signature: %w", err)
+	}
+	if len(lines) != 4 {
+		return nil, fmt.Errorf("Invalid minisign signature provided")
+	}
+	if !strings.HasPrefix(lines[0], minisignUntrustedPrefix) || !strings.HasPrefix(lines[2], minisignTrustedPrefix) {
+		return nil, fmt.Errorf("Invalid minisign signature comments")
+	}
+
+	sigBytes, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(sigBytes) != minisignSigLen {
+		return nil, fmt.Errorf("Invalid minisign signature encoding")
+	}
+	alg := string(sigBytes[:2])
+	if alg != minisignLegacyAlg && alg != minisignHashedAlg {
+		return nil, fmt.Errorf("Unsupported minisign signature algorithm '%v'", alg)
+	}
+
+	globalSig, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return nil, fmt.Errorf("Invalid minisign global signature encoding")
+	}
+
+	return &MinisignSignature{
+		algorithm:       alg,
+		keyID:           sigBytes[2 : 2+minisignKeyIDLen],
+		signature:       sigBytes[2+minisignKeyIDLen:],
+		trustedComment:  strings.TrimPrefix(lines[2], minisignTrustedPrefix),
+		globalSignature: globalSig,
+	}, nil
+}
+
+// CanonicalValue implements the pki.Signature interface
+func (s MinisignSignature) CanonicalValue() ([]byte, error) {
+	if len(s.signature) == 0 {
+		return nil, fmt.Errorf("minisign signature has not been initialized")
+	}
+
+	sigBytes := append([]byte(s.algorithm), s.keyID...)
+	sigBytes = append(sigBytes, s.signature...)
+
+	var canonicalBuffer bytes.Buffer
+	fmt.Fprintf(&canonicalBuffer, "%s%s\n", minisignUntrustedPrefix, minisignCanonicalComment)
+	fmt.Fprintf(&canonicalBuffer, "%s\n", base64.StdEncoding.EncodeToString(sigBytes))
+	fmt.Fprintf(&canonicalBuffer, "%s%s\n", minisignTrustedPrefix, s.trustedComment)
+	fmt.Fprintf(&canonicalBuffer, "%s\n", base64.StdEncoding.EncodeToString(s.globalSignature))
+
+	return canonicalBuffer.Bytes(), nil
+}
+
+// Verify implements the pki.Signature interface
+func (s MinisignSignature) Verify(r io.Reader, k interface{}) error {
+	if len(s.signature) == 0 {
+		return fmt.Errorf("minisign signature has not been initialized")
+	}
+
+	key, ok := k.(*MinisignPublicKey)
+	if !ok {
+		return fmt.Errorf("Cannot use Verify with a non-minisign signature")
+	}
+	if key.key == nil {
+		return fmt.Errorf("minisign public key has not been initialized")
+	}
+	if !bytes.Equal(s.keyID, key.keyID) {
+		return fmt.Errorf("minisign signature was not created by the provided key")
+	}
+
+	var message []byte
+	if s.algorithm == minisignHashedAlg {
+		hasher, err := blake2b.New512(nil)
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(hasher, r); err != nil {
+			return fmt.Errorf("Error reading data to verify: %w", err)
+		}
+		message = hasher.Sum(nil)
+	} else {
+		// legacy signatures are over the message itself, so it has to be held in memory
+		var err error
+		if message, err = ioutil.ReadAll(io.LimitReader(r, maxEd25519MessageSize+1)); err != nil {
+			return fmt.Errorf("Error reading data to verify: %w", err)
+		}
+		if len(message) > maxEd25519MessageSize {
+			return fmt.Errorf("Data larger than %d bytes cannot be verified with a legacy minisign signature", maxEd25519MessageSize)
+		}
+	}
+
+	if !ed25519.Verify(key.key, message, s.signature) {
+		return fmt.Errorf("Unable to verify minisign signature")
+	}
+
+	// the trusted comment is bound to the signature by a second signature over both
+	globalMessage := append(append([]byte{}, s.signature...), s.trustedComment...)
+	if !ed25519.Verify(key.key, globalMessage, s.globalSignature) {
+		return fmt.Errorf("Unable to verify minisign trusted comment")
+	}
+
+	return nil
+}
+
+// MinisignPublicKey Public Key that follows the minisign format; accepts either a full key file or the bare base64 key
+type MinisignPublicKey struct {
+	keyID []byte
+	key   ed25519.PublicKey
+}
+
+// NewMinisignPublicKey implements the pki.PublicKey interface
+func NewMinisignPublicKey(r io.Reader) (*MinisignPublicKey, error) {
+	lines, err := readMinisignLines(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read minisign public key: %w", err)
+	}
+
+	var encodedKey string
+	switch {
+	case len(lines) == 1:
+		encodedKey = lines[0]
+	case len(lines) == 2 && strings.HasPrefix(lines[0], minisignUntrustedPrefix):
+		encodedKey = lines[1]
+	default:
+		return nil, fmt.Errorf("Invalid minisign public key provided")
+	}
+
+	keyBytes, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil || len(keyBytes) != minisignKeyLen {
+		return nil, fmt.Errorf("Invalid minisign public key encoding")
+	}
+	if string(keyBytes[:2]) != minisignLegacyAlg {
+		return nil, fmt.Errorf("Unsupported minisign public key algorithm '%v'", string(keyBytes[:2]))
+	}
+
+	return &MinisignPublicKey{
+		keyID: keyBytes[2 : 2+minisignKeyIDLen],
+		key:   ed25519.PublicKey(keyBytes[2+minisignKeyIDLen:]),
+	}, nil
+}
+
+// CanonicalValue implements the pki.PublicKey interface
+func (k MinisignPublicKey) CanonicalValue() ([]byte, error) {
+	if k.key == nil {
+		return nil, fmt.Errorf("minisign public key has not been initialized")
+	}
+
+	keyBytes := append([]byte(minisignLegacyAlg), k.keyID...)
+	keyBytes = append(keyBytes, k.key...)
+
+	return []byte(base64.StdEncoding.EncodeToString(keyBytes) + "\n"), nil
+}
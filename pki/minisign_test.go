@@ -0,0 +1,206 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestReadMinisignPublicKey(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		inputFile  string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Not a valid public key file", inputFile: "testdata/bogus_armored.pgp", errorFound: true},
+		{caseDesc: "PGP public key (should fail)", inputFile: "testdata/valid_armored_public.pgp", errorFound: true},
+		{caseDesc: "Minisign signature (should fail)", inputFile: "testdata/hello_world.txt.minisig", errorFound: true},
+		{caseDesc: "Valid public key file", inputFile: "testdata/minisign_public.pub", errorFound: false},
+		{caseDesc: "Valid bare base64 public key", inputFile: "testdata/minisign_public.b64", errorFound: false},
+	}
+
+	for _, tc := range tests {
+		file, err := os.Open(tc.inputFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.inputFile)
+		}
+
+		if got, err := NewMinisignPublicKey(file); ((got != nil) == tc.errorFound) || ((err != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result testing %v: %v", tc.caseDesc, tc.inputFile, err)
+		}
+	}
+}
+
+func TestReadMinisignSignature(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		inputFile  string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Not a valid signature file", inputFile: "testdata/bogus_armored.pgp", errorFound: true},
+		{caseDesc: "Minisign public key (should fail)", inputFile: "testdata/minisign_public.pub", errorFound: true},
+		{caseDesc: "Valid legacy signature", inputFile: "testdata/hello_world.txt.minisig", errorFound: false},
+		{caseDesc: "Valid prehashed signature", inputFile: "testdata/hello_world.txt.prehashed.minisig", errorFound: false},
+	}
+
+	for _, tc := range tests {
+		file, err := os.Open(tc.inputFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.inputFile)
+		}
+
+		if got, err := NewMinisignSignature(file); ((got != nil) == tc.errorFound) || ((err != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result testing %v: %v", tc.caseDesc, tc.inputFile, err)
+		}
+	}
+}
+
+func TestCanonicalValueMinisign(t *testing.T) {
+	var k MinisignPublicKey
+	if _, err := k.CanonicalValue(); err == nil {
+		t.Errorf("CanonicalValue did not error out for uninitialized key")
+	}
+	var s MinisignSignature
+	if _, err := s.CanonicalValue(); err == nil {
+		t.Errorf("CanonicalValue did not error out for uninitialized signature")
+	}
+
+	fullFile, _ := os.Open("testdata/minisign_public.pub")
+	fullKey, err := NewMinisignPublicKey(fullFile)
+	if err != nil {
+		t.Fatalf("error reading public key: %v", err)
+	}
+	bareFile, _ := os.Open("testdata/minisign_public.b64")
+	bareKey, err := NewMinisignPublicKey(bareFile)
+	if err != nil {
+		t.Fatalf("error reading public key: %v", err)
+	}
+
+	cvFull, err := fullKey.CanonicalValue()
+	if err != nil {
+		t.Fatalf("error canonicalizing public key: %v", err)
+	}
+	cvBare, err := bareKey.CanonicalValue()
+	if err != nil {
+		t.Fatalf("error canonicalizing public key: %v", err)
+	}
+	if !bytes.Equal(cvFull, cvBare) {
+		t.Errorf("canonical values of key file and bare key differ")
+	}
+
+	// the canonical signature must parse & verify just like the original
+	sigFile, _ := os.Open("testdata/hello_world.txt.prehashed.minisig")
+	sig, err := NewMinisignSignature(sigFile)
+	if err != nil {
+		t.Fatalf("error reading signature: %v", err)
+	}
+	cvSig, err := sig.CanonicalValue()
+	if err != nil {
+		t.Fatalf("error canonicalizing signature: %v", err)
+	}
+	roundTrip, err := NewMinisignSignature(bytes.NewReader(cvSig))
+	if err != nil {
+		t.Fatalf("error reading canonical signature: %v", err)
+	}
+	dataFile, _ := os.Open("testdata/hello_world.txt")
+	if err := roundTrip.Verify(dataFile, fullKey); err != nil {
+		t.Errorf("canonical signature did not verify: %v", err)
+	}
+}
+
+func TestVerifyMinisignSignature(t *testing.T) {
+	type test struct {
+		caseDesc string
+		dataFile string
+		sigFile  string
+		keyFile  string
+		verified bool
+	}
+
+	tests := []test{
+		{caseDesc: "Valid legacy Signature", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.minisig", keyFile: "testdata/minisign_public.pub", verified: true},
+		{caseDesc: "Valid prehashed Signature", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.prehashed.minisig", keyFile: "testdata/minisign_public.b64", verified: true},
+		{caseDesc: "Tampered trusted comment", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.badcomment.minisig", keyFile: "testdata/minisign_public.pub", verified: false},
+		{caseDesc: "Valid Signature, Incorrect Key", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.minisig", keyFile: "testdata/minisign_other_public.pub", verified: false},
+		{caseDesc: "Data does not match Signature", dataFile: "testdata/bogus_binary.pgp", sigFile: "testdata/hello_world.txt.prehashed.minisig", keyFile: "testdata/minisign_public.pub", verified: false},
+	}
+
+	for _, tc := range tests {
+		keyFile, err := os.Open(tc.keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+		k, err := NewMinisignPublicKey(keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+
+		sigFile, err := os.Open(tc.sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+		s, err := NewMinisignSignature(sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+
+		dataFile, err := os.Open(tc.dataFile)
+		if err != nil {
+			t.Errorf("%v: error reading datafile '%v': %v", tc.caseDesc, tc.dataFile, err)
+		}
+
+		if err := s.Verify(dataFile, k); (err == nil) != tc.verified {
+			t.Errorf("%v: unexpected result in verifying sigature: %v", tc.caseDesc, err)
+		}
+	}
+}
+
+func TestVerifyMinisignOversizedMessage(t *testing.T) {
+	keyFile, _ := os.Open("testdata/minisign_public.pub")
+	k, err := NewMinisignPublicKey(keyFile)
+	if err != nil {
+		t.Fatalf("error reading keyfile: %v", err)
+	}
+	sigFile, _ := os.Open("testdata/hello_world.txt.minisig")
+	s, err := NewMinisignSignature(sigFile)
+	if err != nil {
+		t.Fatalf("error reading sigfile: %v", err)
+	}
+
+	data := io.LimitReader(zeroReader{}, maxEd25519MessageSize+1)
+	if err := s.Verify(data, k); err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("expected oversized message to be rejected, got %v", err)
+	}
+}
+
+// zeroReader is an endless stream of zero bytes
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
@@ -20,16 +20,36 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/hex"
 	"fmt"
 	"io"
-	"net/http"
+	"strings"
 
+	"github.com/projectrekor/rekor-server/fetch"
 	"golang.org/x/crypto/openpgp/armor"
 	"golang.org/x/crypto/openpgp/packet"
 
 	"golang.org/x/crypto/openpgp"
 )
 
+func init() {
+	RegisterFormat("pgp",
+		func(r io.Reader) (Signature, error) {
+			s, err := NewPGPSignature(r)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		func(r io.Reader) (PublicKey, error) {
+			k, err := NewPGPPublicKey(r)
+			if err != nil {
+				return nil, err
+			}
+			return k, nil
+		})
+}
+
 // PGPSignature Signature that follows the PGP standard; supports both armored & binary detached signatures
 type PGPSignature struct {
 	isArmored bool
@@ -81,18 +101,13 @@ func NewPGPSignature(r io.Reader) (*PGPSignature, error) {
 
 // Fetch implements pki.Signature interface
 func FetchPGPSignature(ctx context.Context, url string) (*PGPSignature, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error initializing fetch for PGP signature: %w", err)
-	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	body, err := fetch.Get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("Error fetching PGP signature: %w", err)
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	sig, err := NewPGPSignature(resp.Body)
+	sig, err := NewPGPSignature(body)
 	if err != nil {
 		return nil, err
 	}
@@ -213,21 +228,21 @@ func NewPGPPublicKey(r io.Reader) (*PGPPublicKey, error) {
 	return &k, nil
 }
 
-// FetchPGPPublicKey implements pki.PublicKey interface
+// FetchPGPPublicKey implements pki.PublicKey interface. Besides http and https URLs, keys can be looked up
+// on a keyserver with hkp://host/<fingerprint or email> or hkps://host/<fingerprint or email>, and in the
+// Web Key Directory of a domain with wkd:<email>.
 func FetchPGPPublicKey(ctx context.Context, url string) (*PGPPublicKey, error) {
-	//TODO: detect if url is hkp and adjust accordingly
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		return nil, fmt.Errorf("Error fetching PGP public key: %w", err)
+	if key, ok, err := lookupPGPPublicKey(ctx, url); ok {
+		return key, err
 	}
-	client := &http.Client{}
-	resp, err := client.Do(req)
+
+	body, err := fetch.Get(ctx, url)
 	if err != nil {
 		return nil, fmt.Errorf("Error fetching PGP public key: %w", err)
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	key, err := NewPGPPublicKey(resp.Body)
+	key, err := NewPGPPublicKey(body)
 	if err != nil {
 		return nil, err
 	}
@@ -259,3 +274,49 @@ func (k PGPPublicKey) CanonicalValue() ([]byte, error) {
 
 	return canonicalBuffer.Bytes(), nil
 }
+
+// Fingerprints implements the pki.KeyIdentities interface; both full fingerprints and 64-bit key IDs are returned
+// for primary keys and subkeys
+func (k PGPPublicKey) Fingerprints() []string {
+	var fps []string
+	for _, entity := range k.key {
+		keys := []*packet.PublicKey{entity.PrimaryKey}
+		for _, subkey := range entity.Subkeys {
+			keys = append(keys, subkey.PublicKey)
+		}
+		for _, key := range keys {
+			if key == nil {
+				continue
+			}
+			fps = append(fps, hex.EncodeToString(key.Fingerprint[:]), strings.ToLower(key.KeyIdString()))
+		}
+	}
+	return uniqueSorted(fps)
+}
+
+// EmailAddresses implements the pki.KeyIdentities interface
+func (k PGPPublicKey) EmailAddresses() []string {
+	var emails []string
+	for _, entity := range k.key {
+		for _, identity := range entity.Identities {
+			if identity.UserId != nil {
+				emails = append(emails, strings.ToLower(identity.UserId.Email))
+			}
+		}
+	}
+	return uniqueSorted(emails)
+}
+
+// UserIDs implements the pki.KeyUserIDs interface
+func (k PGPPublicKey) UserIDs() []string {
+	var ids []string
+	for _, entity := range k.key {
+		for _, identity := range entity.Identities {
+			ids = append(ids, identity.Name)
+			if identity.UserId != nil {
+				ids = append(ids, identity.UserId.Name)
+			}
+		}
+	}
+	return uniqueSorted(ids)
+}
@@ -0,0 +1,213 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"context"
+	"crypto/sha1" // #nosec G505 -- SHA-1 is mandated by the Web Key Directory hashed local part
+	"encoding/base32"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/projectrekor/rekor-server/fetch"
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// zbase32 is the z-base-32 encoding used for the hashed local part of Web Key Directory URLs
+var zbase32 = base32.NewEncoding("ybndrfg8ejkmcpqxot1uwisza345h769").WithPadding(base32.NoPadding)
+
+// hkpPort is the default port of the HKP protocol when used without TLS
+const hkpPort = "11371"
+
+// keySearch identifies a PGP key either by the fingerprint of its primary key or a subkey, or by an
+// email address bound to it
+type keySearch struct {
+	fingerprint string
+	email       string
+}
+
+// parseKeySearch accepts a full v4 fingerprint, optionally prefixed by 0x and containing spaces, or an
+// email address; short key IDs are refused because they are easily forged
+func parseKeySearch(search string) (keySearch, error) {
+	search = strings.TrimSpace(search)
+	if strings.Contains(search, "@") {
+		at := strings.LastIndex(search, "@")
+		if at == 0 || at == len(search)-1 {
+			return keySearch{}, fmt.Errorf("Invalid email address '%v'", search)
+		}
+		return keySearch{email: strings.ToLower(search)}, nil
+	}
+
+	fp := strings.ToLower(strings.ReplaceAll(search, " ", ""))
+	fp = strings.TrimPrefix(fp, "0x")
+	if _, err := hex.DecodeString(fp); err != nil || len(fp) != 40 {
+		return keySearch{}, fmt.Errorf("'%v' is neither a full PGP fingerprint nor an email address", search)
+	}
+	return keySearch{fingerprint: fp}, nil
+}
+
+func (s keySearch) String() string {
+	if s.email != "" {
+		return s.email
+	}
+	return "0x" + s.fingerprint
+}
+
+// matches reports whether entity is identified by the search
+func (s keySearch) matches(entity *openpgp.Entity) bool {
+	if s.email != "" {
+		for _, identity := range entity.Identities {
+			if identity.UserId != nil && strings.ToLower(identity.UserId.Email) == s.email {
+				return true
+			}
+		}
+		return false
+	}
+
+	keys := []*packet.PublicKey{entity.PrimaryKey}
+	for _, subkey := range entity.Subkeys {
+		keys = append(keys, subkey.PublicKey)
+	}
+	for _, key := range keys {
+		if key != nil && hex.EncodeToString(key.Fingerprint[:]) == s.fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// selectKeys returns the keys of k identified by the search, so that a server cannot have an entry
+// verified by keys other than the one that was asked for
+func (s keySearch) selectKeys(k *PGPPublicKey) (*PGPPublicKey, error) {
+	var selected openpgp.EntityList
+	for _, entity := range k.key {
+		if s.matches(entity) {
+			selected = append(selected, entity)
+		}
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("No PGP public key matching %v was returned", s)
+	}
+	return &PGPPublicKey{key: selected}, nil
+}
+
+// readKeys reads PGP public keys from r and keeps those identified by the search
+func (s keySearch) readKeys(r io.Reader) (*PGPPublicKey, error) {
+	key, err := NewPGPPublicKey(r)
+	if err != nil {
+		return nil, err
+	}
+	return s.selectKeys(key)
+}
+
+// LookupHKP retrieves the PGP public key identified by search, a fingerprint or an email address, from
+// the HKP keyserver at server (for example https://keys.openpgp.org)
+func LookupHKP(ctx context.Context, server, search string) (*PGPPublicKey, error) {
+	s, err := parseKeySearch(search)
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	query.Set("op", "get")
+	query.Set("options", "mr")
+	query.Set("search", s.String())
+
+	body, err := fetch.Get(ctx, strings.TrimSuffix(server, "/")+"/pks/lookup?"+query.Encode())
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching PGP public key from keyserver: %w", err)
+	}
+	defer body.Close()
+
+	return s.readKeys(body)
+}
+
+// wkdURLs returns the URLs of the Web Key Directory advanced and direct methods for email
+func wkdURLs(email string) (advanced, direct string, err error) {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 || at == len(email)-1 {
+		return "", "", fmt.Errorf("Invalid email address '%v'", email)
+	}
+	local, domain := email[:at], strings.ToLower(email[at+1:])
+
+	sum := sha1.Sum([]byte(strings.ToLower(local))) // #nosec G401
+	hu := zbase32.EncodeToString(sum[:]) + "?l=" + url.QueryEscape(local)
+
+	advanced = fmt.Sprintf("https://openpgpkey.%s/.well-known/openpgpkey/%s/hu/%s", domain, domain, hu)
+	direct = fmt.Sprintf("https://%s/.well-known/openpgpkey/hu/%s", domain, hu)
+	return advanced, direct, nil
+}
+
+// LookupWKD retrieves the PGP public key for email from the Web Key Directory of its domain, using the
+// advanced method and falling back to the direct method if that fails
+func LookupWKD(ctx context.Context, email string) (*PGPPublicKey, error) {
+	advanced, direct, err := wkdURLs(email)
+	if err != nil {
+		return nil, err
+	}
+	return lookupWKD(ctx, email, advanced, direct)
+}
+
+func lookupWKD(ctx context.Context, email, advanced, direct string) (*PGPPublicKey, error) {
+	s, err := parseKeySearch(email)
+	if err != nil {
+		return nil, err
+	}
+	if s.email == "" {
+		return nil, fmt.Errorf("Invalid email address '%v'", email)
+	}
+
+	body, err := fetch.Get(ctx, advanced)
+	if err != nil {
+		if body, err = fetch.Get(ctx, direct); err != nil {
+			return nil, fmt.Errorf("Error fetching PGP public key from Web Key Directory: %w", err)
+		}
+	}
+	defer body.Close()
+
+	return s.readKeys(body)
+}
+
+// lookupPGPPublicKey resolves the key lookup URLs accepted by FetchPGPPublicKey; ok is false if rawURL
+// is not one of them
+func lookupPGPPublicKey(ctx context.Context, rawURL string) (key *PGPPublicKey, ok bool, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, false, nil
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "hkp", "hkps":
+		server := url.URL{Scheme: "https", Host: u.Host}
+		if strings.EqualFold(u.Scheme, "hkp") {
+			server.Scheme = "http"
+			if u.Port() == "" {
+				server.Host = u.Host + ":" + hkpPort
+			}
+		}
+		key, err = LookupHKP(ctx, server.String(), strings.TrimPrefix(u.Path, "/"))
+		return key, true, err
+	case "wkd":
+		key, err = LookupWKD(ctx, u.Opaque)
+		return key, true, err
+	}
+	return nil, false, nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+const (
+	simpleKeyFingerprint  = "61bc29b1bfac433312be813a86f575529d0f9ff4"
+	complexKeyFingerprint = "2f528d36d67b69edf998d85778bd65473cb3bd13"
+	complexKeyEmail       = "linux-packages-keymaster@google.com"
+)
+
+// keyServer serves the test keys, both in the same response, to any request for path
+func keyServer(t *testing.T, path string) (*httptest.Server, *[]*http.Request) {
+	t.Helper()
+
+	var keys []byte
+	for _, name := range []string{"valid_armored_public.pgp", "valid_armored_complex_public.pgp"} {
+		b, err := ioutil.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, b...)
+	}
+
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r)
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write(keys)
+	}))
+	return server, &requests
+}
+
+func TestParseKeySearch(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		search     string
+		expected   keySearch
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Fingerprint", search: simpleKeyFingerprint, expected: keySearch{fingerprint: simpleKeyFingerprint}},
+		{caseDesc: "Fingerprint as printed by gpg", search: "0x61BC 29B1 BFAC 4333 12BE  813A 86F5 7552 9D0F 9FF4", expected: keySearch{fingerprint: simpleKeyFingerprint}},
+		{caseDesc: "Email address", search: "Joe.Doe@Example.ORG", expected: keySearch{email: "joe.doe@example.org"}},
+		{caseDesc: "Short key ID", search: "0x86f575529d0f9ff4", errorFound: true},
+		{caseDesc: "Not hex", search: strings.Repeat("z", 40), errorFound: true},
+		{caseDesc: "Missing domain", search: "joe@", errorFound: true},
+		{caseDesc: "Missing local part", search: "@example.org", errorFound: true},
+	}
+
+	for _, tc := range tests {
+		s, err := parseKeySearch(tc.search)
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result parsing %v: %v", tc.caseDesc, tc.search, err)
+		}
+		if err == nil && s != tc.expected {
+			t.Errorf("%v: expected %+v, got %+v", tc.caseDesc, tc.expected, s)
+		}
+	}
+}
+
+func TestWKDURLs(t *testing.T) {
+	// the example from the Web Key Directory specification
+	advanced, direct, err := wkdURLs("Joe.Doe@Example.ORG")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "https://openpgpkey.example.org/.well-known/openpgpkey/example.org/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe"; advanced != expected {
+		t.Errorf("expected advanced URL %v, got %v", expected, advanced)
+	}
+	if expected := "https://example.org/.well-known/openpgpkey/hu/iy9q119eutrkn8s1mk4r39qejnbu3n5q?l=Joe.Doe"; direct != expected {
+		t.Errorf("expected direct URL %v, got %v", expected, direct)
+	}
+
+	if _, _, err := wkdURLs("example.org"); err == nil {
+		t.Errorf("expected an error for an address without a local part")
+	}
+}
+
+func TestLookupHKP(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	server, requests := keyServer(t, "/pks/lookup")
+	defer server.Close()
+
+	type test struct {
+		caseDesc    string
+		url         string
+		fingerprint string
+		excluded    string
+		errorFound  bool
+	}
+
+	hkpURL := strings.Replace(server.URL, "http://", "hkp://", 1)
+	tests := []test{
+		{caseDesc: "By fingerprint", url: hkpURL + "/" + simpleKeyFingerprint, fingerprint: simpleKeyFingerprint, excluded: complexKeyFingerprint},
+		{caseDesc: "By email", url: hkpURL + "/" + complexKeyEmail, fingerprint: complexKeyFingerprint, excluded: simpleKeyFingerprint},
+		{caseDesc: "Key not returned by the server", url: hkpURL + "/" + strings.Repeat("0", 40), errorFound: true},
+		{caseDesc: "Short key ID", url: hkpURL + "/86f575529d0f9ff4", errorFound: true},
+	}
+
+	for _, tc := range tests {
+		key, err := FetchPGPPublicKey(context.TODO(), tc.url)
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result looking up %v: %v", tc.caseDesc, tc.url, err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		// only the key that was asked for is kept from the response
+		if fps := key.Fingerprints(); !containsString(fps, tc.fingerprint) || containsString(fps, tc.excluded) {
+			t.Errorf("%v: unexpected keys %v", tc.caseDesc, fps)
+		}
+	}
+
+	query := (*requests)[0].URL.Query()
+	if query.Get("op") != "get" || query.Get("search") != "0x"+simpleKeyFingerprint {
+		t.Errorf("unexpected keyserver query %v", query)
+	}
+}
+
+func TestLookupWKD(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	server, requests := keyServer(t, "/direct")
+	defer server.Close()
+
+	// the advanced method is tried first, and the direct method used when it fails
+	key, err := lookupWKD(context.TODO(), complexKeyEmail, server.URL+"/advanced", server.URL+"/direct")
+	if err != nil {
+		t.Fatalf("unexpected error looking up key: %v", err)
+	}
+	if len(*requests) != 2 || (*requests)[0].URL.Path != "/advanced" {
+		t.Errorf("expected the advanced method to be tried first")
+	}
+	if emails := key.EmailAddresses(); len(emails) != 1 || emails[0] != complexKeyEmail {
+		t.Errorf("unexpected key for %v: %v", complexKeyEmail, emails)
+	}
+
+	// a key for another address is refused rather than falling back
+	if _, err := lookupWKD(context.TODO(), "joe.doe@example.org", server.URL+"/direct", server.URL+"/advanced"); err == nil {
+		t.Errorf("expected an error when the directory returns a key for another address")
+	}
+
+	if _, err := lookupWKD(context.TODO(), complexKeyEmail, server.URL+"/advanced", server.URL+"/missing"); err == nil {
+		t.Errorf("expected an error when neither method finds a key")
+	}
+}
@@ -26,6 +26,8 @@ import (
 	"net/http/httptest"
 	"os"
 	"testing"
+
+	"github.com/spf13/viper"
 )
 
 func TestReadPublicKey(t *testing.T) {
@@ -58,6 +60,35 @@ func TestReadPublicKey(t *testing.T) {
 	}
 }
 
+func TestUserIDs(t *testing.T) {
+	file, err := os.Open("testdata/valid_armored_complex_public.pgp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	key, err := NewPGPPublicKey(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each user ID is returned in full and by its name
+	expected := []string{
+		"Google Inc. (Linux Packages Signing Authority) <linux-packages-keymaster@google.com>",
+		"Google Inc.",
+		"Google, Inc. Linux Package Signing Key <linux-packages-keymaster@google.com>",
+		"Google, Inc. Linux Package Signing Key",
+	}
+	ids := key.UserIDs()
+	if len(ids) != len(expected) {
+		t.Fatalf("expected %d user IDs, got %v", len(expected), ids)
+	}
+	for _, id := range expected {
+		if !containsString(ids, id) {
+			t.Errorf("expected user ID %q in %v", id, ids)
+		}
+	}
+}
+
 func TestReadSignature(t *testing.T) {
 	type test struct {
 		caseDesc   string
@@ -104,6 +135,10 @@ func TestReadErrorSignature(t *testing.T) {
 }
 
 func TestFetchPublicKey(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
 	type test struct {
 		caseDesc   string
 		inputFile  string
@@ -144,6 +179,10 @@ func TestFetchPublicKey(t *testing.T) {
 }
 
 func TestFetchSignature(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
 	type test struct {
 		caseDesc   string
 		inputFile  string
@@ -17,7 +17,14 @@ limitations under the License.
 package pki
 
 import (
+	"context"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/projectrekor/rekor-server/fetch"
 )
 
 // PublicKey Generic object representing a public key (regardless of format & algorithm)
@@ -30,3 +37,150 @@ type Signature interface {
 	CanonicalValue() ([]byte, error)
 	Verify(r io.Reader, k interface{}) error
 }
+
+// KeyIdentities is implemented by public keys that can describe the identities they are bound to
+type KeyIdentities interface {
+	// Fingerprints returns the lowercase hex identifiers of the key, including any short forms used by the format
+	Fingerprints() []string
+	// EmailAddresses returns the lowercase email addresses bound to the key
+	EmailAddresses() []string
+}
+
+// KeyUserIDs is implemented by public keys that are bound to free-form user IDs, such as PGP keys
+type KeyUserIDs interface {
+	// UserIDs returns the user IDs bound to the key in full, and the name of each user ID on its own
+	UserIDs() []string
+}
+
+// SignatureFactory creates and validates a Signature from its serialized form
+type SignatureFactory func(r io.Reader) (Signature, error)
+
+// PublicKeyFactory creates and validates a PublicKey from its serialized form
+type PublicKeyFactory func(r io.Reader) (PublicKey, error)
+
+// DefaultFormat is used when a caller does not declare the format of a signature & key pair
+const DefaultFormat = "pgp"
+
+type format struct {
+	newSignature SignatureFactory
+	newPublicKey PublicKeyFactory
+}
+
+var (
+	formatsMu sync.RWMutex
+	formats   = map[string]format{}
+)
+
+// RegisterFormat makes a signature & public key format available by name; it is
+// intended to be called from the init function of the file implementing the format
+func RegisterFormat(name string, sigFn SignatureFactory, keyFn PublicKeyFactory) {
+	if sigFn == nil || keyFn == nil {
+		panic("pki: RegisterFormat called with nil factory for " + name)
+	}
+	name = strings.ToLower(name)
+
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if _, dup := formats[name]; dup {
+		panic("pki: RegisterFormat called twice for " + name)
+	}
+	formats[name] = format{newSignature: sigFn, newPublicKey: keyFn}
+}
+
+// Formats returns the sorted names of all registered formats
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func lookupFormat(name string) (format, error) {
+	if name == "" {
+		name = DefaultFormat
+	}
+
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	f, ok := formats[strings.ToLower(name)]
+	if !ok {
+		return format{}, fmt.Errorf("Unsupported signature format '%v'", name)
+	}
+	return f, nil
+}
+
+// NewSignature creates and validates a signature object of the named format
+func NewSignature(name string, r io.Reader) (Signature, error) {
+	f, err := lookupFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.newSignature(r)
+}
+
+// NewPublicKey creates and validates a public key object of the named format
+func NewPublicKey(name string, r io.Reader) (PublicKey, error) {
+	f, err := lookupFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	return f.newPublicKey(r)
+}
+
+// FetchSignature retrieves a signature of the named format from url
+func FetchSignature(ctx context.Context, name, url string) (Signature, error) {
+	f, err := lookupFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	body, err := fetch.Get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching signature: %w", err)
+	}
+	defer body.Close()
+
+	return f.newSignature(body)
+}
+
+// FetchPublicKey retrieves a public key of the named format from url; PGP keys may also be looked up
+// as described by FetchPGPPublicKey
+func FetchPublicKey(ctx context.Context, name, url string) (PublicKey, error) {
+	f, err := lookupFormat(name)
+	if err != nil {
+		return nil, err
+	}
+	if name == "" || strings.EqualFold(name, "pgp") {
+		key, err := FetchPGPPublicKey(ctx, url)
+		if err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+
+	body, err := fetch.Get(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("Error fetching public key: %w", err)
+	}
+	defer body.Close()
+
+	return f.newPublicKey(body)
+}
+
+// uniqueSorted returns the distinct values of in, sorted
+func uniqueSorted(in []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, v := range in {
+		if v != "" && !seen[v] {
+			seen[v] = true
+			out = append(out, v)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
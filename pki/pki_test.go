@@ -0,0 +1,70 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"os"
+	"testing"
+)
+
+func TestFormatRegistry(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		format     string
+		sigFile    string
+		keyFile    string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Default format is PGP", format: "", sigFile: "testdata/hello_world.txt.sig", keyFile: "testdata/valid_armored_public.pgp", errorFound: false},
+		{caseDesc: "Explicit PGP format", format: "pgp", sigFile: "testdata/hello_world.txt.asc.sig", keyFile: "testdata/valid_binary_public.pgp", errorFound: false},
+		{caseDesc: "Format names are case insensitive", format: "PGP", sigFile: "testdata/hello_world.txt.sig", keyFile: "testdata/valid_armored_public.pgp", errorFound: false},
+		{caseDesc: "Unknown format", format: "bogus", sigFile: "testdata/hello_world.txt.sig", keyFile: "testdata/valid_armored_public.pgp", errorFound: true},
+		{caseDesc: "Invalid content for format", format: "pgp", sigFile: "testdata/bogus_armored.pgp", keyFile: "testdata/bogus_armored.pgp", errorFound: true},
+	}
+
+	for _, tc := range tests {
+		sigFile, err := os.Open(tc.sigFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.sigFile)
+		}
+		keyFile, err := os.Open(tc.keyFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.keyFile)
+		}
+
+		s, sigErr := NewSignature(tc.format, sigFile)
+		k, keyErr := NewPublicKey(tc.format, keyFile)
+		if ((s != nil) == tc.errorFound) || ((sigErr != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result creating signature from %v: %v", tc.caseDesc, tc.sigFile, sigErr)
+		}
+		if ((k != nil) == tc.errorFound) || ((keyErr != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result creating public key from %v: %v", tc.caseDesc, tc.keyFile, keyErr)
+		}
+	}
+
+	found := false
+	for _, name := range Formats() {
+		if name == DefaultFormat {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("default format %v is not registered", DefaultFormat)
+	}
+}
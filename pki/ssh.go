@@ -0,0 +1,249 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+)
+
+const (
+	sshsigMagic   = "SSHSIG"
+	sshsigVersion = 1
+	sshsigPEMType = "SSH SIGNATURE"
+)
+
+// defaultSSHNamespaces are accepted when pki.ssh_namespaces is not set; "file" is the namespace for signing
+// arbitrary files, and "git" the one used for signed commits and tags
+var defaultSSHNamespaces = []string{"file", "git"}
+
+// sshNamespaces returns the namespaces that SSH signatures may be created in
+func sshNamespaces() []string {
+	if namespaces := viper.GetStringSlice("pki.ssh_namespaces"); len(namespaces) > 0 {
+		return namespaces
+	}
+	return defaultSSHNamespaces
+}
+
+func init() {
+	RegisterFormat("ssh",
+		func(r io.Reader) (Signature, error) {
+			s, err := NewSSHSignature(r)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		func(r io.Reader) (PublicKey, error) {
+			k, err := NewSSHPublicKey(r)
+			if err != nil {
+				return nil, err
+			}
+			return k, nil
+		})
+}
+
+// sshsigWrapper is the wire format of the blob inside an armored SSHSIG signature
+type sshsigWrapper struct {
+	Magic         [6]byte
+	Version       uint32
+	PublicKey     []byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Signature     []byte
+}
+
+// sshsigSignedData is the structure that is actually signed by 'ssh-keygen -Y sign'
+type sshsigSignedData struct {
+	Magic         [6]byte
+	Namespace     string
+	Reserved      string
+	HashAlgorithm string
+	Hash          []byte
+}
+
+// SSHSignature Signature created by 'ssh-keygen -Y sign' in the armored SSHSIG format
+type SSHSignature struct {
+	raw       []byte
+	publicKey ssh.PublicKey
+	namespace string
+	hashAlg   string
+	signature *ssh.Signature
+}
+
+// NewSSHSignature creates and validates an SSHSIG signature object
+func NewSSHSignature(r io.Reader) (*SSHSignature, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SSH signature: %w", err)
+	}
+
+	block, _ := pem.Decode(input)
+	if block == nil || block.Type != sshsigPEMType {
+		return nil, fmt.Errorf("Invalid SSH signature provided")
+	}
+
+	var w sshsigWrapper
+	if err := ssh.Unmarshal(block.Bytes, &w); err != nil {
+		return nil, fmt.Errorf("Invalid SSH signature: %w", err)
+	}
+	if string(w.Magic[:]) != sshsigMagic {
+		return nil, fmt.Errorf("Invalid SSH signature magic")
+	}
+	if w.Version != sshsigVersion {
+		return nil, fmt.Errorf("Unsupported SSH signature version %d", w.Version)
+	}
+	if _, err := sshsigHasher(w.HashAlgorithm); err != nil {
+		return nil, err
+	}
+
+	pub, err := ssh.ParsePublicKey(w.PublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid public key in SSH signature: %w", err)
+	}
+
+	var sig ssh.Signature
+	if err := ssh.Unmarshal(w.Signature, &sig); err != nil {
+		return nil, fmt.Errorf("Invalid SSH signature: %w", err)
+	}
+	// the SSHSIG format requires RSA signatures to use SHA-2 rather than the SHA-1 based ssh-rsa algorithm
+	if sig.Format == ssh.SigAlgoRSA {
+		return nil, fmt.Errorf("SSH signatures using the ssh-rsa (SHA-1) algorithm are not accepted")
+	}
+
+	return &SSHSignature{
+		raw:       block.Bytes,
+		publicKey: pub,
+		namespace: w.Namespace,
+		hashAlg:   w.HashAlgorithm,
+		signature: &sig,
+	}, nil
+}
+
+func sshsigHasher(alg string) (hash.Hash, error) {
+	switch alg {
+	case "sha256":
+		return sha256.New(), nil
+	case "sha512":
+		return sha512.New(), nil
+	default:
+		return nil, fmt.Errorf("Unsupported SSH signature hash algorithm '%v'", alg)
+	}
+}
+
+// CanonicalValue implements the pki.Signature interface
+func (s SSHSignature) CanonicalValue() ([]byte, error) {
+	if len(s.raw) == 0 {
+		return nil, fmt.Errorf("SSH signature has not been initialized")
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: s.raw}), nil
+}
+
+// Verify implements the pki.Signature interface
+func (s SSHSignature) Verify(r io.Reader, k interface{}) error {
+	if s.signature == nil {
+		return fmt.Errorf("SSH signature has not been initialized")
+	}
+
+	key, ok := k.(*SSHPublicKey)
+	if !ok {
+		return fmt.Errorf("Cannot use Verify with a non-SSH signature")
+	}
+	if key.key == nil {
+		return fmt.Errorf("SSH public key has not been initialized")
+	}
+
+	if namespaces := sshNamespaces(); !containsString(namespaces, s.namespace) {
+		return fmt.Errorf("SSH signature namespace '%v' is not one of the accepted namespaces %v", s.namespace, namespaces)
+	}
+	if !bytes.Equal(s.publicKey.Marshal(), key.key.Marshal()) {
+		return fmt.Errorf("SSH signature was not created by the provided key")
+	}
+
+	hasher, err := sshsigHasher(s.hashAlg)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(hasher, r); err != nil {
+		return fmt.Errorf("Error reading data to verify: %w", err)
+	}
+
+	signedData := sshsigSignedData{
+		Namespace:     s.namespace,
+		HashAlgorithm: s.hashAlg,
+		Hash:          hasher.Sum(nil),
+	}
+	copy(signedData.Magic[:], sshsigMagic)
+
+	if err := key.key.Verify(ssh.Marshal(signedData), s.signature); err != nil {
+		return fmt.Errorf("Unable to verify SSH signature: %w", err)
+	}
+	return nil
+}
+
+// SSHPublicKey Public Key in the OpenSSH authorized_keys format
+type SSHPublicKey struct {
+	key ssh.PublicKey
+}
+
+// NewSSHPublicKey implements the pki.PublicKey interface
+func NewSSHPublicKey(r io.Reader) (*SSHPublicKey, error) {
+	input, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read SSH public key: %w", err)
+	}
+
+	key, _, _, rest, err := ssh.ParseAuthorizedKey(input)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid SSH public key: %w", err)
+	}
+	if len(bytes.TrimSpace(rest)) != 0 {
+		return nil, fmt.Errorf("Only one SSH public key may be provided")
+	}
+
+	return &SSHPublicKey{key: key}, nil
+}
+
+// CanonicalValue implements the pki.PublicKey interface
+func (k SSHPublicKey) CanonicalValue() ([]byte, error) {
+	if k.key == nil {
+		return nil, fmt.Errorf("SSH public key has not been initialized")
+	}
+
+	// options & comments are dropped, leaving "<type> <base64 key>\n"
+	return ssh.MarshalAuthorizedKey(k.key), nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
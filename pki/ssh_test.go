@@ -0,0 +1,220 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestReadSSHPublicKey(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		inputFile  string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Not a valid public key file", inputFile: "testdata/bogus_armored.pgp", errorFound: true},
+		{caseDesc: "PGP public key (should fail)", inputFile: "testdata/valid_armored_public.pgp", errorFound: true},
+		{caseDesc: "SSH signature (should fail)", inputFile: "testdata/hello_world.txt.ed25519.sshsig", errorFound: true},
+		{caseDesc: "Valid Ed25519 public key", inputFile: "testdata/ssh_ed25519_public.pub", errorFound: false},
+		{caseDesc: "Valid RSA public key", inputFile: "testdata/ssh_rsa_public.pub", errorFound: false},
+	}
+
+	for _, tc := range tests {
+		file, err := os.Open(tc.inputFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.inputFile)
+		}
+
+		if got, err := NewSSHPublicKey(file); ((got != nil) == tc.errorFound) || ((err != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result testing %v: %v", tc.caseDesc, tc.inputFile, err)
+		}
+	}
+}
+
+func TestReadSSHSignature(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		inputFile  string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Not a valid signature file", inputFile: "testdata/bogus_armored.pgp", errorFound: true},
+		{caseDesc: "SSH public key (should fail)", inputFile: "testdata/ssh_ed25519_public.pub", errorFound: true},
+		{caseDesc: "Valid Ed25519 signature", inputFile: "testdata/hello_world.txt.ed25519.sshsig", errorFound: false},
+		{caseDesc: "Valid RSA signature", inputFile: "testdata/hello_world.txt.rsa.sshsig", errorFound: false},
+	}
+
+	for _, tc := range tests {
+		file, err := os.Open(tc.inputFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.inputFile)
+		}
+
+		if got, err := NewSSHSignature(file); ((got != nil) == tc.errorFound) || ((err != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result testing %v: %v", tc.caseDesc, tc.inputFile, err)
+		}
+	}
+}
+
+func TestCanonicalValueSSHPublicKey(t *testing.T) {
+	var k SSHPublicKey
+	if _, err := k.CanonicalValue(); err == nil {
+		t.Errorf("CanonicalValue did not error out for uninitialized key")
+	}
+
+	raw, err := ioutil.ReadFile("testdata/ssh_ed25519_public.pub")
+	if err != nil {
+		t.Fatalf("cannot read public key: %v", err)
+	}
+	withOptions := append([]byte(`restrict,no-pty `), bytes.Replace(raw, []byte("test@rekor.dev"), []byte("other comment"), 1)...)
+
+	original, err := NewSSHPublicKey(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("error reading public key: %v", err)
+	}
+	decorated, err := NewSSHPublicKey(bytes.NewReader(withOptions))
+	if err != nil {
+		t.Fatalf("error reading public key with options: %v", err)
+	}
+
+	cvOriginal, _ := original.CanonicalValue()
+	cvDecorated, _ := decorated.CanonicalValue()
+	if !bytes.Equal(cvOriginal, cvDecorated) {
+		t.Errorf("canonical values differ when only options & comment differ")
+	}
+	if strings.Contains(string(cvOriginal), "test@rekor.dev") {
+		t.Errorf("canonical value should not contain the key comment")
+	}
+}
+
+func TestVerifySSHSignature(t *testing.T) {
+	type test struct {
+		caseDesc string
+		dataFile string
+		sigFile  string
+		keyFile  string
+		verified bool
+	}
+
+	tests := []test{
+		{caseDesc: "Valid Ed25519 Signature (sha512)", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ed25519.sshsig", keyFile: "testdata/ssh_ed25519_public.pub", verified: true},
+		{caseDesc: "Valid RSA Signature (sha256)", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.rsa.sshsig", keyFile: "testdata/ssh_rsa_public.pub", verified: true},
+		{caseDesc: "Valid Signature in the git namespace", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.git.sshsig", keyFile: "testdata/ssh_ed25519_public.pub", verified: true},
+		{caseDesc: "Valid Signature, Incorrect Key", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ed25519.sshsig", keyFile: "testdata/ssh_rsa_public.pub", verified: false},
+		{caseDesc: "Data does not match Signature", dataFile: "testdata/bogus_binary.pgp", sigFile: "testdata/hello_world.txt.rsa.sshsig", keyFile: "testdata/ssh_rsa_public.pub", verified: false},
+	}
+
+	for _, tc := range tests {
+		keyFile, err := os.Open(tc.keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+		k, err := NewSSHPublicKey(keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+
+		sigFile, err := os.Open(tc.sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+		s, err := NewSSHSignature(sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+
+		dataFile, err := os.Open(tc.dataFile)
+		if err != nil {
+			t.Errorf("%v: error reading datafile '%v': %v", tc.caseDesc, tc.dataFile, err)
+		}
+
+		if err := s.Verify(dataFile, k); (err == nil) != tc.verified {
+			t.Errorf("%v: unexpected result in verifying sigature: %v", tc.caseDesc, err)
+		}
+	}
+}
+
+func TestSSHSignatureNamespaces(t *testing.T) {
+	keyFile, _ := os.Open("testdata/ssh_ed25519_public.pub")
+	k, err := NewSSHPublicKey(keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sigFile, _ := os.Open("testdata/hello_world.txt.git.sshsig")
+	s, err := NewSSHSignature(sigFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadFile("testdata/hello_world.txt")
+
+	viper.Set("pki.ssh_namespaces", []string{"file"})
+	defer viper.Set("pki.ssh_namespaces", nil)
+	if err := s.Verify(bytes.NewReader(data), k); err == nil {
+		t.Errorf("signature in the git namespace unexpectedly verified when only file is accepted")
+	}
+
+	viper.Set("pki.ssh_namespaces", []string{"file", "git"})
+	if err := s.Verify(bytes.NewReader(data), k); err != nil {
+		t.Errorf("unexpected error verifying signature in the git namespace: %v", err)
+	}
+}
+
+func TestSSHSignatureRejectsSHA1(t *testing.T) {
+	priv, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the signer produces signatures with the SHA-1 based ssh-rsa algorithm
+	sig, err := signer.Sign(rand.Reader, []byte("signed data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sig.Format != ssh.SigAlgoRSA {
+		t.Fatalf("expected an ssh-rsa signature, got %v", sig.Format)
+	}
+
+	w := sshsigWrapper{
+		Version:       sshsigVersion,
+		PublicKey:     signer.PublicKey().Marshal(),
+		Namespace:     "file",
+		HashAlgorithm: "sha512",
+		Signature:     ssh.Marshal(sig),
+	}
+	copy(w.Magic[:], sshsigMagic)
+	armored := pem.EncodeToMemory(&pem.Block{Type: sshsigPEMType, Bytes: ssh.Marshal(w)})
+
+	if _, err := NewSSHSignature(bytes.NewReader(armored)); err == nil {
+		t.Errorf("ssh-rsa signature was unexpectedly accepted")
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	_ "crypto/sha512" // registers SHA-384 and SHA-512 for ECDSA keys on P-384 and P-521
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxEd25519MessageSize bounds the data read into memory to verify an Ed25519 signature
+const maxEd25519MessageSize = 32 << 20
+
+// oidEmailAddress is the PKCS #9 emailAddress attribute that some certificates carry in their subject
+var oidEmailAddress = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+
+func init() {
+	RegisterFormat("x509",
+		func(r io.Reader) (Signature, error) {
+			s, err := NewX509Signature(r)
+			if err != nil {
+				return nil, err
+			}
+			return s, nil
+		},
+		func(r io.Reader) (PublicKey, error) {
+			k, err := NewX509PublicKey(r)
+			if err != nil {
+				return nil, err
+			}
+			return k, nil
+		})
+}
+
+// X509Signature Detached signature produced with a key from an X.509 certificate or PKIX public key;
+// supports RSA (PKCS#1 v1.5 and PSS), ECDSA and Ed25519 signatures in raw or base64 encoded form. RSA signatures
+// are over the SHA-256 digest of the data, and ECDSA signatures over the digest matching the key's curve.
+type X509Signature struct {
+	signature []byte
+}
+
+// NewX509Signature creates and validates a detached X.509 signature object
+func NewX509Signature(r io.Reader) (*X509Signature, error) {
+	rawSig, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read X509 signature: %w", err)
+	}
+
+	// tools such as 'openssl base64' emit text; the binary form is what is verified and stored
+	trimmed := bytes.TrimSpace(rawSig)
+	if decoded, err := base64.StdEncoding.DecodeString(string(trimmed)); err == nil && len(decoded) > 0 {
+		rawSig = decoded
+	}
+
+	if len(rawSig) == 0 {
+		return nil, fmt.Errorf("Invalid X509 signature provided")
+	}
+
+	return &X509Signature{signature: rawSig}, nil
+}
+
+// CanonicalValue implements the pki.Signature interface
+func (s X509Signature) CanonicalValue() ([]byte, error) {
+	if len(s.signature) == 0 {
+		return nil, fmt.Errorf("X509 signature has not been initialized")
+	}
+	return s.signature, nil
+}
+
+// Verify implements the pki.Signature interface
+func (s X509Signature) Verify(r io.Reader, k interface{}) error {
+	if len(s.signature) == 0 {
+		return fmt.Errorf("X509 signature has not been initialized")
+	}
+
+	key, ok := k.(*X509PublicKey)
+	if !ok {
+		return fmt.Errorf("Cannot use Verify with a non-X509 signature")
+	}
+	if key.key == nil {
+		return fmt.Errorf("X509 public key has not been initialized")
+	}
+
+	// Ed25519 signs the message itself rather than a digest of it, so the message must be held in memory
+	if pub, ok := key.key.(ed25519.PublicKey); ok {
+		message, err := ioutil.ReadAll(io.LimitReader(r, maxEd25519MessageSize+1))
+		if err != nil {
+			return fmt.Errorf("Error reading data to verify: %w", err)
+		}
+		if len(message) > maxEd25519MessageSize {
+			return fmt.Errorf("Data larger than %d bytes cannot be verified with an Ed25519 key", maxEd25519MessageSize)
+		}
+		if !ed25519.Verify(pub, message, s.signature) {
+			return fmt.Errorf("Unable to verify Ed25519 signature")
+		}
+		return nil
+	}
+
+	// the digest algorithm is not carried in a detached signature, so it is determined by the key
+	hashAlg, err := x509DigestAlgorithm(key.key)
+	if err != nil {
+		return err
+	}
+	h := hashAlg.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return fmt.Errorf("Error reading data to verify: %w", err)
+	}
+	digest := h.Sum(nil)
+
+	switch pub := key.key.(type) {
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(pub, hashAlg, digest, s.signature); err == nil {
+			return nil
+		}
+		pssOpts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthAuto, Hash: hashAlg}
+		if err := rsa.VerifyPSS(pub, hashAlg, digest, s.signature, pssOpts); err == nil {
+			return nil
+		}
+	case *ecdsa.PublicKey:
+		if ecdsa.VerifyASN1(pub, digest, s.signature) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Unable to verify X509 signature")
+}
+
+// x509DigestAlgorithm returns the digest signed with key: SHA-256 for RSA keys, and the digest matching
+// the size of the curve for ECDSA keys
+func x509DigestAlgorithm(key crypto.PublicKey) (crypto.Hash, error) {
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		return crypto.SHA256, nil
+	case *ecdsa.PublicKey:
+		switch pub.Curve {
+		case elliptic.P256():
+			return crypto.SHA256, nil
+		case elliptic.P384():
+			return crypto.SHA384, nil
+		case elliptic.P521():
+			return crypto.SHA512, nil
+		}
+		return 0, fmt.Errorf("Unsupported X509 ECDSA curve %v", pub.Curve.Params().Name)
+	}
+	return 0, fmt.Errorf("Unsupported X509 public key type %T", key)
+}
+
+// X509PublicKey Public key taken from an X.509 certificate or a PKIX SubjectPublicKeyInfo structure,
+// in either PEM or DER encoding
+type X509PublicKey struct {
+	cert *x509.Certificate
+	key  crypto.PublicKey
+}
+
+// NewX509PublicKey implements the pki.PublicKey interface
+func NewX509PublicKey(r io.Reader) (*X509PublicKey, error) {
+	rawKey, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read X509 public key: %w", err)
+	}
+
+	der := rawKey
+	pemType := ""
+	if block, _ := pem.Decode(rawKey); block != nil {
+		der = block.Bytes
+		pemType = block.Type
+	}
+
+	var k X509PublicKey
+	switch pemType {
+	case "CERTIFICATE":
+		k.cert, err = x509.ParseCertificate(der)
+	case "PUBLIC KEY":
+		k.key, err = x509.ParsePKIXPublicKey(der)
+	case "":
+		// DER input could hold either structure
+		if k.cert, err = x509.ParseCertificate(der); err != nil {
+			k.key, err = x509.ParsePKIXPublicKey(der)
+		}
+	default:
+		return nil, fmt.Errorf("Invalid PEM type '%v' for X509 public key", pemType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Error reading X509 public key: %w", err)
+	}
+
+	if k.cert != nil {
+		k.key = k.cert.PublicKey
+	}
+
+	switch k.key.(type) {
+	case *rsa.PublicKey, *ecdsa.PublicKey, ed25519.PublicKey:
+	default:
+		return nil, fmt.Errorf("Unsupported X509 public key type %T", k.key)
+	}
+
+	return &k, nil
+}
+
+// CanonicalValue implements the pki.PublicKey interface
+func (k X509PublicKey) CanonicalValue() ([]byte, error) {
+	if k.key == nil {
+		return nil, fmt.Errorf("X509 public key has not been initialized")
+	}
+
+	var block pem.Block
+	if k.cert != nil {
+		block.Type = "CERTIFICATE"
+		block.Bytes = k.cert.Raw
+	} else {
+		der, err := x509.MarshalPKIXPublicKey(k.key)
+		if err != nil {
+			return nil, fmt.Errorf("Error generating canonical value of X509 public key: %w", err)
+		}
+		block.Type = "PUBLIC KEY"
+		block.Bytes = der
+	}
+
+	return pem.EncodeToMemory(&block), nil
+}
+
+// Fingerprints implements the pki.KeyIdentities interface; the SHA-256 digest of the certificate (if any) and of
+// the SubjectPublicKeyInfo are returned
+func (k X509PublicKey) Fingerprints() []string {
+	var fps []string
+	if k.cert != nil {
+		digest := sha256.Sum256(k.cert.Raw)
+		fps = append(fps, hex.EncodeToString(digest[:]))
+	}
+	if der, err := x509.MarshalPKIXPublicKey(k.key); err == nil {
+		digest := sha256.Sum256(der)
+		fps = append(fps, hex.EncodeToString(digest[:]))
+	}
+	return uniqueSorted(fps)
+}
+
+// EmailAddresses implements the pki.KeyIdentities interface, using the certificate's subject alternative names and
+// subject emailAddress attribute
+func (k X509PublicKey) EmailAddresses() []string {
+	if k.cert == nil {
+		return []string{}
+	}
+
+	var emails []string
+	for _, email := range k.cert.EmailAddresses {
+		emails = append(emails, strings.ToLower(email))
+	}
+	for _, name := range k.cert.Subject.Names {
+		if name.Type.Equal(oidEmailAddress) {
+			if email, ok := name.Value.(string); ok {
+				emails = append(emails, strings.ToLower(email))
+			}
+		}
+	}
+	return uniqueSorted(emails)
+}
@@ -0,0 +1,223 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pki
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"os"
+	"testing"
+)
+
+func TestReadX509PublicKey(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		inputFile  string
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "Not a valid public key file", inputFile: "testdata/bogus_armored.pgp", errorFound: true},
+		{caseDesc: "PGP public key (should fail)", inputFile: "testdata/valid_armored_public.pgp", errorFound: true},
+		{caseDesc: "PEM private key (should fail)", inputFile: "testdata/x509_ec_private.pem", errorFound: true},
+		{caseDesc: "Valid PEM certificate", inputFile: "testdata/x509_rsa_cert.pem", errorFound: false},
+		{caseDesc: "Valid DER certificate", inputFile: "testdata/x509_rsa_cert.der", errorFound: false},
+		{caseDesc: "Valid PEM ECDSA public key", inputFile: "testdata/x509_ec_public.pem", errorFound: false},
+		{caseDesc: "Valid DER ECDSA public key", inputFile: "testdata/x509_ec_public.der", errorFound: false},
+		{caseDesc: "Valid PEM Ed25519 public key", inputFile: "testdata/x509_ed25519_public.pem", errorFound: false},
+	}
+
+	for _, tc := range tests {
+		file, err := os.Open(tc.inputFile)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.inputFile)
+		}
+
+		if got, err := NewX509PublicKey(file); ((got != nil) == tc.errorFound) || ((err != nil) != tc.errorFound) {
+			t.Errorf("%v: unexpected result testing %v: %v", tc.caseDesc, tc.inputFile, err)
+		}
+	}
+}
+
+func TestReadErrorX509(t *testing.T) {
+	br := new(BadReader)
+	if _, err := NewX509PublicKey(br); err == nil {
+		t.Errorf("KnownBadReader: unexpected success testing a broken reader for public key")
+	}
+	if _, err := NewX509Signature(br); err == nil {
+		t.Errorf("KnownBadReader: unexpected success testing a broken reader for signature")
+	}
+}
+
+func TestCanonicalValueX509PublicKey(t *testing.T) {
+	type test struct {
+		caseDesc string
+		input    string
+		output   string
+		match    bool
+	}
+
+	var k X509PublicKey
+	if _, err := k.CanonicalValue(); err == nil {
+		t.Errorf("CanonicalValue did not error out for uninitialized key")
+	}
+
+	tests := []test{
+		{caseDesc: "DER and PEM versions of same certificate", input: "testdata/x509_rsa_cert.der", output: "testdata/x509_rsa_cert.pem", match: true},
+		{caseDesc: "DER and PEM versions of same public key", input: "testdata/x509_ec_public.der", output: "testdata/x509_ec_public.pem", match: true},
+		{caseDesc: "Different public keys", input: "testdata/x509_ec_public.pem", output: "testdata/x509_ed25519_public.pem", match: false},
+	}
+
+	for _, tc := range tests {
+		inputFile, err := os.Open(tc.input)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.input)
+		}
+		inputKey, err := NewX509PublicKey(inputFile)
+		if err != nil {
+			t.Errorf("%v: Error reading input for TestCanonicalValueX509PublicKey: %v", tc.caseDesc, err)
+		}
+		cvInput, err := inputKey.CanonicalValue()
+		if err != nil {
+			t.Errorf("%v: Error canonicalizing public key '%v': %v", tc.caseDesc, tc.input, err)
+		}
+
+		outputFile, err := os.Open(tc.output)
+		if err != nil {
+			t.Errorf("%v: cannot open %v", tc.caseDesc, tc.output)
+		}
+		outputKey, err := NewX509PublicKey(outputFile)
+		if err != nil {
+			t.Errorf("%v: Error reading input for TestCanonicalValueX509PublicKey: %v", tc.caseDesc, err)
+		}
+		cvOutput, err := outputKey.CanonicalValue()
+		if err != nil {
+			t.Errorf("%v: Error canonicalizing public key '%v': %v", tc.caseDesc, tc.output, err)
+		}
+
+		if bytes.Equal(cvInput, cvOutput) != tc.match {
+			t.Errorf("%v: %v equality of canonical values of %v and %v was expected but not generated", tc.caseDesc, tc.match, tc.input, tc.output)
+		}
+	}
+}
+
+func TestVerifyX509Signature(t *testing.T) {
+	type test struct {
+		caseDesc string
+		dataFile string
+		sigFile  string
+		keyFile  string
+		verified bool
+	}
+
+	tests := []test{
+		{caseDesc: "Valid RSA PKCS1v15 Signature, PEM Certificate", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.rsa.sig", keyFile: "testdata/x509_rsa_cert.pem", verified: true},
+		{caseDesc: "Valid RSA PSS Signature, DER Certificate", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.rsapss.sig", keyFile: "testdata/x509_rsa_cert.der", verified: true},
+		{caseDesc: "Valid ECDSA Signature, PEM Key", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ec.sig", keyFile: "testdata/x509_ec_public.pem", verified: true},
+		{caseDesc: "Valid base64 ECDSA Signature, DER Key", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ec.sig.b64", keyFile: "testdata/x509_ec_public.der", verified: true},
+		{caseDesc: "Valid Ed25519 Signature", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ed25519.sig", keyFile: "testdata/x509_ed25519_public.pem", verified: true},
+		{caseDesc: "Valid Signature, Incorrect Key", dataFile: "testdata/hello_world.txt", sigFile: "testdata/hello_world.txt.ec.sig", keyFile: "testdata/x509_rsa_cert.pem", verified: false},
+		{caseDesc: "Data does not match Signature", dataFile: "testdata/bogus_binary.pgp", sigFile: "testdata/hello_world.txt.ed25519.sig", keyFile: "testdata/x509_ed25519_public.pem", verified: false},
+	}
+
+	for _, tc := range tests {
+		keyFile, err := os.Open(tc.keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+		k, err := NewX509PublicKey(keyFile)
+		if err != nil {
+			t.Errorf("%v: error reading keyfile '%v': %v", tc.caseDesc, tc.keyFile, err)
+		}
+
+		sigFile, err := os.Open(tc.sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+		s, err := NewX509Signature(sigFile)
+		if err != nil {
+			t.Errorf("%v: error reading sigfile '%v': %v", tc.caseDesc, tc.sigFile, err)
+		}
+
+		dataFile, err := os.Open(tc.dataFile)
+		if err != nil {
+			t.Errorf("%v: error reading datafile '%v': %v", tc.caseDesc, tc.dataFile, err)
+		}
+
+		if err := s.Verify(dataFile, k); (err == nil) != tc.verified {
+			t.Errorf("%v: unexpected result in verifying sigature: %v", tc.caseDesc, err)
+		}
+	}
+
+	pgpKeyFile, _ := os.Open("testdata/valid_armored_public.pgp")
+	pgpKey, err := NewPGPPublicKey(pgpKeyFile)
+	if err != nil {
+		t.Fatalf("error reading PGP key: %v", err)
+	}
+	sigFile, _ := os.Open("testdata/hello_world.txt.ec.sig")
+	s, err := NewX509Signature(sigFile)
+	if err != nil {
+		t.Fatalf("error reading signature: %v", err)
+	}
+	if err := s.Verify(bytes.NewReader(nil), pgpKey); err == nil {
+		t.Errorf("X509 signature unexpectedly verified with a PGP key")
+	}
+}
+
+func TestX509DigestAlgorithm(t *testing.T) {
+	type test struct {
+		caseDesc   string
+		curve      elliptic.Curve
+		signWith   crypto.Hash
+		verified   bool
+		errorFound bool
+	}
+
+	tests := []test{
+		{caseDesc: "P-256 with SHA-256", curve: elliptic.P256(), signWith: crypto.SHA256, verified: true},
+		{caseDesc: "P-384 with SHA-384", curve: elliptic.P384(), signWith: crypto.SHA384, verified: true},
+		{caseDesc: "P-521 with SHA-512", curve: elliptic.P521(), signWith: crypto.SHA512, verified: true},
+		{caseDesc: "P-384 with SHA-256", curve: elliptic.P384(), signWith: crypto.SHA256, verified: false},
+		{caseDesc: "P-256 with SHA-512", curve: elliptic.P256(), signWith: crypto.SHA512, verified: false},
+		{caseDesc: "Unsupported curve", curve: elliptic.P224(), signWith: crypto.SHA256, verified: false, errorFound: true},
+	}
+
+	data := []byte("hello world")
+	for _, tc := range tests {
+		priv, err := ecdsa.GenerateKey(tc.curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h := tc.signWith.New()
+		h.Write(data)
+		sig, err := ecdsa.SignASN1(rand.Reader, priv, h.Sum(nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := x509DigestAlgorithm(&priv.PublicKey); (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result choosing digest: %v", tc.caseDesc, err)
+		}
+		s := X509Signature{signature: sig}
+		if err := s.Verify(bytes.NewReader(data), &X509PublicKey{key: &priv.PublicKey}); (err == nil) != tc.verified {
+			t.Errorf("%v: unexpected result verifying signature: %v", tc.caseDesc, err)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	tcrypto "github.com/google/trillian/crypto"
+)
+
+// Checkpoint is a tree head of the log in the text format used by signed notes:
+//
+//	<origin>
+//	<tree size>
+//	<base64 root hash>
+//	[extension lines]
+type Checkpoint struct {
+	Origin       string
+	Size         uint64
+	Hash         []byte
+	OtherContent []string
+}
+
+// MarshalText returns the body of the note
+func (c Checkpoint) MarshalText() ([]byte, error) {
+	if c.Origin == "" || strings.Contains(c.Origin, "\n") {
+		return nil, errors.New("checkpoint origin must be a single non-empty line")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s\n%d\n%s\n", c.Origin, c.Size, base64.StdEncoding.EncodeToString(c.Hash))
+	for _, line := range c.OtherContent {
+		if line == "" || strings.Contains(line, "\n") {
+			return nil, errors.New("checkpoint extension lines must be single non-empty lines")
+		}
+		fmt.Fprintf(&b, "%s\n", line)
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText parses the body of the note
+func (c *Checkpoint) UnmarshalText(data []byte) error {
+	if !bytes.HasSuffix(data, []byte("\n")) {
+		return errors.New("checkpoint must end with a newline")
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if len(lines) < 3 {
+		return errors.New("checkpoint must contain origin, size and root hash")
+	}
+
+	size, err := strconv.ParseUint(lines[1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint tree size: %w", err)
+	}
+	hash, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return fmt.Errorf("invalid checkpoint root hash: %w", err)
+	}
+
+	*c = Checkpoint{
+		Origin:       lines[0],
+		Size:         size,
+		Hash:         hash,
+		OtherContent: lines[3:],
+	}
+	if c.Origin == "" {
+		return errors.New("checkpoint origin must not be empty")
+	}
+	for _, line := range c.OtherContent {
+		if line == "" {
+			return errors.New("checkpoint must not contain empty lines")
+		}
+	}
+	return nil
+}
+
+// NoteSignature is one signature line of a signed note
+type NoteSignature struct {
+	Name      string
+	KeyHash   uint32
+	Signature []byte
+}
+
+// SignedCheckpoint is a Checkpoint together with the signatures over its text
+type SignedCheckpoint struct {
+	Checkpoint
+	Signatures []NoteSignature
+}
+
+const noteSignaturePrefix = "— "
+
+// signature type identifiers that go into a note key hash
+const (
+	noteSigTypeEd25519 byte = 0x01
+	noteSigTypeECDSA   byte = 0x02
+	noteSigTypeOther   byte = 0xff
+)
+
+// noteKeyHash identifies a named public key in a signature line. As the signed note format defines it, it
+// is the first four bytes of SHA-256(name || "\n" || signature type || key), where the key is the raw
+// public key for Ed25519 and its PKIX encoding otherwise
+func noteKeyHash(name string, pub crypto.PublicKey) (uint32, error) {
+	var sigType byte
+	var key []byte
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		sigType, key = noteSigTypeEd25519, k
+	default:
+		der, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return 0, err
+		}
+		sigType, key = noteSigTypeOther, der
+		if _, ok := pub.(*ecdsa.PublicKey); ok {
+			sigType = noteSigTypeECDSA
+		}
+	}
+
+	h := sha256.New()
+	h.Write([]byte(name + "\n"))
+	h.Write([]byte{sigType})
+	h.Write(key)
+	return binary.BigEndian.Uint32(h.Sum(nil)[:4]), nil
+}
+
+func validNoteName(name string) bool {
+	return name != "" && strings.IndexFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '+' }) == -1
+}
+
+// Sign adds a signature over the checkpoint by the named key
+func (s *SignedCheckpoint) Sign(name string, signer crypto.Signer) error {
+	if !validNoteName(name) {
+		return fmt.Errorf("invalid signer name '%v'", name)
+	}
+	body, err := s.Checkpoint.MarshalText()
+	if err != nil {
+		return err
+	}
+	keyHash, err := noteKeyHash(name, signer.Public())
+	if err != nil {
+		return err
+	}
+
+	sig, err := tcrypto.NewSigner(0, signer, crypto.SHA256).Sign(body)
+	if err != nil {
+		return err
+	}
+
+	s.Signatures = append(s.Signatures, NoteSignature{Name: name, KeyHash: keyHash, Signature: sig})
+	return nil
+}
+
+// Verify succeeds if at least one signature on the checkpoint was made by pub
+func (s SignedCheckpoint) Verify(pub crypto.PublicKey) error {
+	body, err := s.Checkpoint.MarshalText()
+	if err != nil {
+		return err
+	}
+
+	for _, sig := range s.Signatures {
+		keyHash, err := noteKeyHash(sig.Name, pub)
+		if err != nil {
+			return err
+		}
+		if sig.KeyHash != keyHash {
+			continue
+		}
+		if err := tcrypto.Verify(pub, crypto.SHA256, body, sig.Signature); err == nil {
+			return nil
+		}
+	}
+	return errors.New("no valid signature found on checkpoint for the provided key")
+}
+
+// MarshalText returns the signed note: the checkpoint, a blank line, then one line per signature
+func (s SignedCheckpoint) MarshalText() ([]byte, error) {
+	body, err := s.Checkpoint.MarshalText()
+	if err != nil {
+		return nil, err
+	}
+
+	b := bytes.NewBuffer(body)
+	b.WriteString("\n")
+	for _, sig := range s.Signatures {
+		hashAndSig := make([]byte, 4, 4+len(sig.Signature))
+		binary.BigEndian.PutUint32(hashAndSig, sig.KeyHash)
+		hashAndSig = append(hashAndSig, sig.Signature...)
+		fmt.Fprintf(b, "%s%s %s\n", noteSignaturePrefix, sig.Name, base64.StdEncoding.EncodeToString(hashAndSig))
+	}
+	return b.Bytes(), nil
+}
+
+// UnmarshalText parses a signed note; signatures are not verified
+func (s *SignedCheckpoint) UnmarshalText(data []byte) error {
+	split := bytes.Index(data, []byte("\n\n"))
+	if split == -1 {
+		return errors.New("signed checkpoint is missing signatures")
+	}
+
+	var c Checkpoint
+	if err := c.UnmarshalText(data[:split+1]); err != nil {
+		return err
+	}
+
+	var sigs []NoteSignature
+	sigBlock := strings.TrimSuffix(string(data[split+2:]), "\n")
+	for _, line := range strings.Split(sigBlock, "\n") {
+		if !strings.HasPrefix(line, noteSignaturePrefix) {
+			return fmt.Errorf("invalid signature line '%v'", line)
+		}
+		fields := strings.Split(strings.TrimPrefix(line, noteSignaturePrefix), " ")
+		if len(fields) != 2 || !validNoteName(fields[0]) {
+			return fmt.Errorf("invalid signature line '%v'", line)
+		}
+		hashAndSig, err := base64.StdEncoding.DecodeString(fields[1])
+		if err != nil || len(hashAndSig) <= 4 {
+			return fmt.Errorf("invalid signature encoding in line '%v'", line)
+		}
+		sigs = append(sigs, NoteSignature{
+			Name:      fields[0],
+			KeyHash:   binary.BigEndian.Uint32(hashAndSig[:4]),
+			Signature: hashAndSig[4:],
+		})
+	}
+
+	*s = SignedCheckpoint{Checkpoint: c, Signatures: sigs}
+	return nil
+}
@@ -0,0 +1,135 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+)
+
+func TestSignedCheckpoint(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sc := SignedCheckpoint{
+		Checkpoint: Checkpoint{
+			Origin:       "rekor.example.com - 1234",
+			Size:         42,
+			Hash:         bytes.Repeat([]byte{0xab}, 32),
+			OtherContent: []string{"Timestamp: 1606149600000000000"},
+		},
+	}
+	if err := sc.Sign("rekor.example.com", ecKey); err != nil {
+		t.Fatalf("error signing checkpoint: %v", err)
+	}
+	if err := sc.Sign("witness", edKey); err != nil {
+		t.Fatalf("error signing checkpoint: %v", err)
+	}
+	if err := sc.Sign("bad name", ecKey); err == nil {
+		t.Errorf("signing with a name containing whitespace should fail")
+	}
+
+	text, err := sc.MarshalText()
+	if err != nil {
+		t.Fatalf("error marshalling checkpoint: %v", err)
+	}
+
+	var parsed SignedCheckpoint
+	if err := parsed.UnmarshalText(text); err != nil {
+		t.Fatalf("error parsing checkpoint: %v\n%s", err, text)
+	}
+	if parsed.Origin != sc.Origin || parsed.Size != sc.Size || !bytes.Equal(parsed.Hash, sc.Hash) || len(parsed.OtherContent) != 1 || len(parsed.Signatures) != 2 {
+		t.Errorf("parsed checkpoint does not match original: %+v", parsed)
+	}
+
+	if err := parsed.Verify(ecKey.Public()); err != nil {
+		t.Errorf("error verifying ECDSA signature: %v", err)
+	}
+	if err := parsed.Verify(edKey.Public()); err != nil {
+		t.Errorf("error verifying Ed25519 signature: %v", err)
+	}
+	if err := parsed.Verify(otherKey.Public()); err == nil {
+		t.Errorf("checkpoint unexpectedly verified with an unrelated key")
+	}
+
+	parsed.Size++
+	if err := parsed.Verify(ecKey.Public()); err == nil {
+		t.Errorf("modified checkpoint unexpectedly verified")
+	}
+
+	for _, bad := range []string{
+		"",
+		"origin\n1\n",
+		"origin\nnot-a-number\nq83vEjRWeJA=\n\n— name AAAAAAAA\n",
+		"origin\n1\nq83vEjRWeJA=\n",
+		"origin\n1\nq83vEjRWeJA=\n\nnot a signature\n",
+	} {
+		if err := parsed.UnmarshalText([]byte(bad)); err == nil {
+			t.Errorf("unexpected success parsing invalid checkpoint %q", bad)
+		}
+	}
+}
+
+func TestNoteKeyHash(t *testing.T) {
+	// the example verifier key from the signed note documentation:
+	// PeterNeumann+c74f20a3+ARpc2QcUPDhMQegwxbzhKqiBfsVkmqq/LDE4izWy10TW
+	encoded, err := base64.StdEncoding.DecodeString("ARpc2QcUPDhMQegwxbzhKqiBfsVkmqq/LDE4izWy10TW")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub := ed25519.PublicKey(encoded[1:])
+
+	keyHash, err := noteKeyHash("PeterNeumann", pub)
+	if err != nil {
+		t.Fatalf("error computing key hash: %v", err)
+	}
+	if keyHash != 0xc74f20a3 {
+		t.Errorf("key hash %08x does not match c74f20a3", keyHash)
+	}
+	if other, _ := noteKeyHash("SomeoneElse", pub); other == keyHash {
+		t.Errorf("key hash does not depend on the key name")
+	}
+
+	// the example signer key for the same name; standard verifiers check a bare Ed25519 signature over the note text
+	seed, err := base64.StdEncoding.DecodeString("AYEKFALVFGyNhPJEMzD1QIDr+Y7hfZx09iUvxdXHKDFz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc := SignedCheckpoint{Checkpoint: Checkpoint{Origin: "example.com/log", Size: 1, Hash: bytes.Repeat([]byte{0x01}, 32)}}
+	if err := sc.Sign("PeterNeumann", ed25519.NewKeyFromSeed(seed[1:])); err != nil {
+		t.Fatalf("error signing checkpoint: %v", err)
+	}
+	body, _ := sc.Checkpoint.MarshalText()
+	if sig := sc.Signatures[0]; sig.KeyHash != 0xc74f20a3 || !ed25519.Verify(pub, body, sig.Signature) {
+		t.Errorf("signature line does not verify as a signed note: %+v", sig)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/viper"
+)
+
+const (
+	defaultMaxDecompressedSize = 1 << 30
+	defaultMaxCompressionRatio = 100
+
+	// ratioGracePeriod is how much content may be decompressed before the compression ratio is enforced, as
+	// small inputs legitimately compress far better than large ones
+	ratioGracePeriod = 1 << 20
+)
+
+// ErrDecompressionLimit is returned when decompressing content exceeds the configured size or ratio
+var ErrDecompressionLimit = errors.New("decompressed content exceeds the allowed size or compression ratio")
+
+// compressionFormat recognizes a compressed stream by its leading bytes and returns a reader of its
+// decompressed content
+type compressionFormat struct {
+	name      string
+	magic     []byte
+	newReader func(r io.Reader, maxSize int64) (io.ReadCloser, error)
+}
+
+var compressionFormats = []compressionFormat{
+	{name: "gzip", magic: []byte{0x1f, 0x8b}, newReader: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return gzip.NewReader(r)
+	}},
+	{name: "bzip2", magic: []byte("BZh"), newReader: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		return ioutil.NopCloser(bzip2.NewReader(r)), nil
+	}},
+	{name: "xz", magic: []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}, newReader: func(r io.Reader, _ int64) (io.ReadCloser, error) {
+		maxDict := viper.GetInt64("decompress.max_xz_dictionary")
+		if maxDict <= 0 {
+			maxDict = defaultMaxXZDictionary
+		}
+		return newXZReader(r, maxDict)
+	}},
+	{name: "zstd", magic: []byte{0x28, 0xb5, 0x2f, 0xfd}, newReader: func(r io.Reader, maxSize int64) (io.ReadCloser, error) {
+		// the window size is bounded too, so that a small stream cannot claim a large amount of memory
+		d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	}},
+}
+
+// SignedContent returns a reader of the content the signature of the leaf covers, given the artifact as
+// submitted: the decompressed artifact if Decompress is set, and the artifact itself otherwise
+func (r *RekorLeaf) SignedContent(artifact io.Reader) (io.ReadCloser, error) {
+	if !r.Decompress {
+		return ioutil.NopCloser(artifact), nil
+	}
+	return decompress(artifact)
+}
+
+// HashedContent returns a reader of the content the signature of the leaf covers, as SignedContent
+// does, while writing artifact as submitted to hasher. Once the reader returns io.EOF, all of artifact
+// has been hashed, including any of it the decompressor did not read.
+func (r *RekorLeaf) HashedContent(artifact io.Reader, hasher hash.Hash) (io.ReadCloser, error) {
+	if !r.Decompress {
+		return ioutil.NopCloser(io.TeeReader(artifact, hasher)), nil
+	}
+
+	// the artifact is hashed as it is passed to the decompressor, which may read ahead of the content
+	// it returns and from more than one goroutine
+	pr, pw := io.Pipe()
+	go func() {
+		_, err := io.Copy(io.MultiWriter(hasher, pw), artifact)
+		_ = pw.CloseWithError(err)
+	}()
+	content, err := decompress(pr)
+	if err != nil {
+		_ = pr.CloseWithError(err)
+		return nil, err
+	}
+	return &hashedContent{ReadCloser: content, artifact: pr}, nil
+}
+
+// hashedContent reads the rest of the artifact once the decompressed content ends, so that it is hashed
+type hashedContent struct {
+	io.ReadCloser
+	artifact *io.PipeReader
+}
+
+func (h *hashedContent) Read(p []byte) (int, error) {
+	n, err := h.ReadCloser.Read(p)
+	if err == io.EOF {
+		if _, err := io.Copy(ioutil.Discard, h.artifact); err != nil {
+			return n, err
+		}
+	}
+	return n, err
+}
+
+func (h *hashedContent) Close() error {
+	err := h.ReadCloser.Close()
+	_ = h.artifact.Close()
+	return err
+}
+
+// decompress detects whether r is compressed with gzip, bzip2, xz or zstd and returns a reader of its
+// decompressed content. Reading more than decompress.max_size bytes, or more than decompress.max_ratio
+// times the compressed size, returns ErrDecompressionLimit.
+func decompress(r io.Reader) (io.ReadCloser, error) {
+	maxSize := viper.GetInt64("decompress.max_size")
+	if maxSize <= 0 {
+		maxSize = defaultMaxDecompressedSize
+	}
+	maxRatio := viper.GetInt64("decompress.max_ratio")
+	if maxRatio <= 0 {
+		maxRatio = defaultMaxCompressionRatio
+	}
+
+	compressed := &countingReader{r: r}
+	br := bufio.NewReader(compressed)
+	for _, f := range compressionFormats {
+		header, err := br.Peek(len(f.magic))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if !bytes.Equal(header, f.magic) {
+			continue
+		}
+
+		dr, err := f.newReader(br, maxSize)
+		if err != nil {
+			return nil, fmt.Errorf("reading %v content: %w", f.name, err)
+		}
+		return &limitedDecompressor{ReadCloser: dr, compressed: compressed, maxSize: maxSize, maxRatio: maxRatio}, nil
+	}
+	return nil, errors.New("content is not compressed with gzip, bzip2, xz or zstd")
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// limitedDecompressor stops decompression once the size or compression ratio limit is exceeded
+type limitedDecompressor struct {
+	io.ReadCloser
+	compressed *countingReader
+	read       int64
+	maxSize    int64
+	maxRatio   int64
+}
+
+func (l *limitedDecompressor) Read(p []byte) (int, error) {
+	n, err := l.ReadCloser.Read(p)
+	l.read += int64(n)
+	if l.read > l.maxSize || (l.read > ratioGracePeriod && l.read > l.maxRatio*l.compressed.n) {
+		return 0, ErrDecompressionLimit
+	}
+	return n, err
+}
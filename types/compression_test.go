@@ -0,0 +1,262 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io/ioutil"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/ulikunitz/xz"
+)
+
+// loadEntry parses and loads an entry for data signed by the PGP test key
+func loadEntry(t *testing.T, data []byte, decompress bool) (*RekorEntry, error) {
+	t.Helper()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile("../pki/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	content, err := json.Marshal(map[string]interface{}{
+		"Data":       data,
+		"Signature":  read("hello_world.txt.asc.sig"),
+		"PublicKey":  read("valid_armored_public.pgp"),
+		"Decompress": decompress,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := ParseProposedLeaf(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := ParseRekorEntry(bytes.NewReader(content), leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return entry, entry.Load(context.TODO())
+}
+
+func TestLoadCompressed(t *testing.T) {
+	type TestCase struct {
+		caseDesc   string
+		file       string
+		decompress bool
+		errorFound bool
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Uncompressed content", file: "../pki/testdata/hello_world.txt", decompress: false, errorFound: false},
+		{caseDesc: "Uncompressed content with Decompress", file: "../pki/testdata/hello_world.txt", decompress: true, errorFound: true},
+		{caseDesc: "gzip", file: "testdata/hello_world.txt.gz", decompress: true, errorFound: false},
+		{caseDesc: "bzip2", file: "testdata/hello_world.txt.bz2", decompress: true, errorFound: false},
+		{caseDesc: "xz", file: "testdata/hello_world.txt.xz", decompress: true, errorFound: false},
+		{caseDesc: "zstd", file: "testdata/hello_world.txt.zst", decompress: true, errorFound: false},
+		// the signature covers the decompressed content, so verifying the compressed bytes fails
+		{caseDesc: "xz without Decompress", file: "testdata/hello_world.txt.xz", decompress: false, errorFound: true},
+		{caseDesc: "gzip without Decompress", file: "testdata/hello_world.txt.gz", decompress: false, errorFound: true},
+	}
+
+	plain, err := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := loadEntry(t, plain, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range testCases {
+		data, err := ioutil.ReadFile(tc.file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := loadEntry(t, data, tc.decompress)
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result loading entry: %v", tc.caseDesc, err)
+		}
+		// the SHA is of the content as submitted, so that it matches the hash of the compressed file
+		sum := sha256.Sum256(data)
+		if err == nil && entry.SHA != hex.EncodeToString(sum[:]) {
+			t.Errorf("%v: expected SHA of the submitted content %x, got %v", tc.caseDesc, sum, entry.SHA)
+		}
+	}
+
+	// Decompress is part of the logged leaf, and so of its hash, only when it is set
+	data, err := ioutil.ReadFile("testdata/hello_world.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := loadEntry(t, data, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaf := range []*RekorLeaf{&expected.RekorLeaf, &compressed.RekorLeaf} {
+		leafValue, err := json.Marshal(leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(leafValue, []byte("Decompress")) != leaf.Decompress {
+			t.Errorf("unexpected leaf value with Decompress %v: %s", leaf.Decompress, leafValue)
+		}
+		parsed, err := ParseRekorLeaf(bytes.NewReader(leafValue))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parsed.Decompress != leaf.Decompress {
+			t.Errorf("Decompress was not read back from the leaf value %s", leafValue)
+		}
+	}
+
+	// a corrupt stream is reported rather than hashed as empty content
+	if _, err := loadEntry(t, []byte{0x1f, 0x8b, 0xff}, true); err == nil {
+		t.Errorf("expected an error loading a corrupt gzip stream")
+	}
+}
+
+func TestLoadCompressedWithSHA(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/hello_world.txt.xz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedSum := sha256.Sum256(data)
+	plainSum := sha256.Sum256(plain)
+
+	// a SHA given with the entry is checked against the compressed content, not the decompressed content
+	for sha, valid := range map[string]bool{
+		hex.EncodeToString(compressedSum[:]): true,
+		hex.EncodeToString(plainSum[:]):      false,
+	} {
+		entry, err := loadEntry(t, data, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.SHA = sha
+		if err := entry.Load(context.TODO()); (err == nil) != valid {
+			t.Errorf("unexpected result loading entry with SHA %v: %v", sha, err)
+		}
+	}
+}
+
+func TestDecompressionLimits(t *testing.T) {
+	var bomb bytes.Buffer
+	zw, _ := gzip.NewWriterLevel(&bomb, gzip.BestCompression)
+	if _, err := zw.Write(make([]byte, 16<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := loadEntry(t, bomb.Bytes(), true); !errors.Is(err, ErrDecompressionLimit) {
+		t.Errorf("expected the compression ratio to be limited, got %v", err)
+	}
+
+	viper.Set("decompress.max_ratio", 1<<20)
+	defer viper.Set("decompress.max_ratio", nil)
+	viper.Set("decompress.max_size", 1<<20)
+	defer viper.Set("decompress.max_size", nil)
+	if _, err := loadEntry(t, bomb.Bytes(), true); !errors.Is(err, ErrDecompressionLimit) {
+		t.Errorf("expected the decompressed size to be limited, got %v", err)
+	}
+}
+
+// xzBlockHeaders returns the offsets of the block headers in an xz file, found by their CRC32
+func xzBlockHeaders(data []byte) []int {
+	var offsets []int
+	for i := 12; i < len(data); i++ {
+		end := i + (int(data[i])+1)*4
+		if data[i] == 0 || end > len(data) {
+			continue
+		}
+		if crc32.ChecksumIEEE(data[i:end-4]) == binary.LittleEndian.Uint32(data[end-4:end]) {
+			offsets = append(offsets, i)
+			i = end - 1
+		}
+	}
+	return offsets
+}
+
+func TestXZDictionaryLimit(t *testing.T) {
+	content := bytes.Repeat([]byte("Hello, World!\n"), 10000)
+	var stream bytes.Buffer
+	xw, err := xz.WriterConfig{DictCap: 1 << 20, BlockSize: 32 << 10}.NewWriter(&stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := xw.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := xw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	readAll := func(data []byte) ([]byte, error) {
+		r, err := decompress(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		return ioutil.ReadAll(r)
+	}
+
+	// files with several blocks and several streams separated by padding are read in full
+	multi := append(append(append([]byte(nil), stream.Bytes()...), 0, 0, 0, 0), stream.Bytes()...)
+	got, err := readAll(multi)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, append(append([]byte(nil), content...), content...)) {
+		t.Errorf("unexpected content of %d bytes", len(got))
+	}
+
+	headers := xzBlockHeaders(stream.Bytes())
+	if len(headers) < 2 {
+		t.Fatalf("expected several blocks, found %d", len(headers))
+	}
+	for _, offset := range []int{headers[0], headers[len(headers)-1]} {
+		// declare a 4GiB dictionary in the block header and fix up its CRC32
+		crafted := append([]byte(nil), stream.Bytes()...)
+		header := crafted[offset : offset+(int(crafted[offset])+1)*4]
+		dict := bytes.Index(header, []byte{0x21, 0x01}) + 2
+		header[dict] = 40
+		binary.LittleEndian.PutUint32(header[len(header)-4:], crc32.ChecksumIEEE(header[:len(header)-4]))
+
+		if _, err := readAll(crafted); !errors.Is(err, ErrDecompressionLimit) {
+			t.Errorf("expected the dictionary declared by the block at %d to be limited, got %v", offset, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// bufferedPipe is an in-memory pipe that holds up to size bytes the reader has not read yet, so the
+// writer is only held up by a reader that falls that far behind
+type bufferedPipe struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	size int
+	// werr is returned to the reader once the buffer is drained after the writer closes
+	werr error
+	// rerr is returned to the writer once the reader closes
+	rerr error
+}
+
+func newBufferedPipe(size int) *bufferedPipe {
+	p := &bufferedPipe{size: size}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *bufferedPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	n := 0
+	for len(b) > 0 {
+		for p.rerr == nil && p.werr == nil && p.buf.Len() >= p.size {
+			p.cond.Wait()
+		}
+		if p.rerr != nil {
+			return n, p.rerr
+		}
+		if p.werr != nil {
+			return n, io.ErrClosedPipe
+		}
+		chunk := b
+		if room := p.size - p.buf.Len(); len(chunk) > room {
+			chunk = chunk[:room]
+		}
+		p.buf.Write(chunk)
+		n += len(chunk)
+		b = b[len(chunk):]
+		p.cond.Broadcast()
+	}
+	return n, nil
+}
+
+func (p *bufferedPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for p.rerr == nil && p.werr == nil && p.buf.Len() == 0 {
+		p.cond.Wait()
+	}
+	if p.rerr != nil {
+		return 0, io.ErrClosedPipe
+	}
+	if p.buf.Len() > 0 {
+		n, _ := p.buf.Read(b)
+		p.cond.Broadcast()
+		return n, nil
+	}
+	return 0, p.werr
+}
+
+// CloseWrite closes the writing side: the reader reads what was written and then err, or io.EOF if err
+// is nil
+func (p *bufferedPipe) CloseWrite(err error) {
+	if err == nil {
+		err = io.EOF
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.werr == nil {
+		p.werr = err
+	}
+	p.cond.Broadcast()
+}
+
+// CloseRead closes the reading side: writes fail with err, or io.ErrClosedPipe if err is nil
+func (p *bufferedPipe) CloseRead(err error) {
+	if err == nil {
+		err = io.ErrClosedPipe
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.rerr == nil {
+		p.rerr = err
+	}
+	p.buf.Reset()
+	p.cond.Broadcast()
+}
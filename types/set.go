@@ -0,0 +1,90 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	tcrypto "github.com/google/trillian/crypto"
+)
+
+// EntryTimestamp is the statement made by the log when it accepts an entry
+type EntryTimestamp struct {
+	// LogID is the hex encoded SHA-256 digest of the PKIX encoding of the log's signing key
+	LogID string
+	// LeafHash is the hex encoded RFC 6962 leaf hash of the entry
+	LeafHash string
+	// QueuedTime is the time, in seconds since the Unix epoch, at which the log queued the entry. The entry
+	// is integrated into the tree some time later
+	QueuedTime int64
+}
+
+// SignedEntryTimestamp is a promise by the log to include an entry in the tree, which can be used as
+// proof of submission before the entry is covered by a signed tree head
+type SignedEntryTimestamp struct {
+	Payload EntryTimestamp
+	// Signature is over the JSON encoding of Payload, with fields in the order declared above and no whitespace
+	Signature []byte
+}
+
+// LogID returns the identifier of a log from its signing key
+func LogID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	digest := sha256.Sum256(der)
+	return hex.EncodeToString(digest[:]), nil
+}
+
+// NewSignedEntryTimestamp signs the payload with the log's key
+func NewSignedEntryTimestamp(payload EntryTimestamp, signer crypto.Signer) (*SignedEntryTimestamp, error) {
+	msg, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := tcrypto.NewSigner(0, signer, crypto.SHA256).Sign(msg)
+	if err != nil {
+		return nil, err
+	}
+	return &SignedEntryTimestamp{Payload: payload, Signature: sig}, nil
+}
+
+// Verify checks that the timestamp was signed by pub and that pub is the key of the log named in the payload
+func (s SignedEntryTimestamp) Verify(pub crypto.PublicKey) error {
+	logID, err := LogID(pub)
+	if err != nil {
+		return err
+	}
+	if logID != s.Payload.LogID {
+		return fmt.Errorf("signed entry timestamp is for log %v, not %v", s.Payload.LogID, logID)
+	}
+
+	msg, err := json.Marshal(s.Payload)
+	if err != nil {
+		return err
+	}
+	if err := tcrypto.Verify(pub, crypto.SHA256, msg, s.Signature); err != nil {
+		return fmt.Errorf("invalid signed entry timestamp: %w", err)
+	}
+	return nil
+}
@@ -17,9 +17,7 @@ limitations under the License.
 package types
 
 import (
-	"bufio"
 	"bytes"
-	"compress/gzip"
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
@@ -27,26 +25,53 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"net/http"
+	"io/ioutil"
+	"strings"
 
+	"github.com/projectrekor/rekor-server/fetch"
 	"github.com/projectrekor/rekor-server/pki"
 	"golang.org/x/sync/errgroup"
 )
 
+// signatureBufferSize is how much content is held for the signature check while the signature and public
+// key are fetched, so that the download is not held up by them
+const signatureBufferSize = 4 << 20
+
 // RekorEntry is the API request.
 type RekorEntry struct {
-	Data      []byte
-	URL       string
-	RekorLeaf `json:"-"`
+	Data []byte
+	URL  string
+	// SignatureURL and PublicKeyURL locate the signature and public key when they are not given inline
+	SignatureURL string
+	PublicKeyURL string
+	RekorLeaf    `json:"-"`
 }
 
 // RekorLeaf is the type we store in the log.
 type RekorLeaf struct {
+	// Format names the pki format of Signature & PublicKey; empty means pki.DefaultFormat
+	Format string `json:",omitempty"`
+	// SHA is the hex encoded SHA-256 of the content as submitted, which is the compressed content when
+	// Decompress is set
 	SHA       string
 	Signature []byte
 	PublicKey []byte
-	keyObject pki.PublicKey
-	sigObject pki.Signature
+	// Decompress states that the signature covers the decompressed content rather than the bytes as
+	// submitted; the content must then be compressed with gzip, bzip2, xz or zstd. It is omitted when
+	// false, so that other leaves hash as they did before it was added.
+	Decompress bool `json:",omitempty"`
+	keyObject  pki.PublicKey
+	sigObject  pki.Signature
+}
+
+// PublicKeyObject returns the parsed public key of the leaf
+func (r *RekorLeaf) PublicKeyObject() pki.PublicKey {
+	return r.keyObject
+}
+
+// SignatureObject returns the parsed signature of the leaf
+func (r *RekorLeaf) SignatureObject() pki.Signature {
+	return r.sigObject
 }
 
 // MarshalJSON Ensures that the canonicalized versions of public keys & signatures are stored in tLOG
@@ -57,6 +82,13 @@ func (r *RekorLeaf) MarshalJSON() ([]byte, error) {
 	}
 	var cLeaf canonicalLeaf
 	cLeaf.SHA = r.SHA
+	cLeaf.Decompress = r.Decompress
+
+	// leaves in the default format are stored without it, so that they hash identically to entries
+	// created before the format could be declared
+	if format := strings.ToLower(r.Format); format != pki.DefaultFormat {
+		cLeaf.Format = format
+	}
 
 	var err error
 	cLeaf.Signature, err = r.sigObject.CanonicalValue()
@@ -71,6 +103,16 @@ func (r *RekorLeaf) MarshalJSON() ([]byte, error) {
 }
 
 func ParseRekorLeaf(r io.Reader) (*RekorLeaf, error) {
+	return parseLeaf(r, false)
+}
+
+// ParseProposedLeaf parses the leaf of an entry submitted to the log, whose signature and public key may
+// be omitted in favour of fetching them from the SignatureURL and PublicKeyURL of the entry
+func ParseProposedLeaf(r io.Reader) (*RekorLeaf, error) {
+	return parseLeaf(r, true)
+}
+
+func parseLeaf(r io.Reader, allowMissing bool) (*RekorLeaf, error) {
 	var l RekorLeaf
 	dec := json.NewDecoder(r)
 	if err := dec.Decode(&l); err != nil && err != io.EOF {
@@ -84,24 +126,35 @@ func ParseRekorLeaf(r io.Reader) (*RekorLeaf, error) {
 		}
 	}
 
-	//TODO: make this create the appropriate signature & key objects based on
-	//      the content in the proposed leaf rather than being hardcoded to PGP
+	if l.Format == "" {
+		l.Format = pki.DefaultFormat
+	}
+
 	var err error
 	// check if this is an actual signature
-	l.sigObject, err = pki.NewPGPSignature(bytes.NewReader(l.Signature))
-	if err != nil {
-		return nil, err
+	if len(l.Signature) > 0 || !allowMissing {
+		l.sigObject, err = pki.NewSignature(l.Format, bytes.NewReader(l.Signature))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// check if this is an actual public key
-	l.keyObject, err = pki.NewPGPPublicKey(bytes.NewReader(l.PublicKey))
-	if err != nil {
-		return nil, err
+	if len(l.PublicKey) > 0 || !allowMissing {
+		l.keyObject, err = pki.NewPublicKey(l.Format, bytes.NewReader(l.PublicKey))
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	return &l, nil
 }
 
+// Complete reports whether the signature and public key of the leaf have been parsed
+func (r *RekorLeaf) Complete() bool {
+	return r.sigObject != nil && r.keyObject != nil
+}
+
 func ParseRekorEntry(r io.Reader, leaf *RekorLeaf) (*RekorEntry, error) {
 	var e RekorEntry
 	dec := json.NewDecoder(r)
@@ -119,81 +172,83 @@ func ParseRekorEntry(r io.Reader, leaf *RekorLeaf) (*RekorEntry, error) {
 		return nil, errors.New("SHA hash must be specified if URL is set")
 	}
 
+	if (e.sigObject == nil) == (e.SignatureURL == "") {
+		return nil, errors.New("exactly one of Signature or SignatureURL must be set")
+	}
+	if (e.keyObject == nil) == (e.PublicKeyURL == "") {
+		return nil, errors.New("exactly one of PublicKey or PublicKeyURL must be set")
+	}
+
 	return &e, nil
 }
 
 func (r *RekorEntry) Load(ctx context.Context) error {
 
-	hashR, hashW := io.Pipe()
-	sigR, sigW := io.Pipe()
+	sig := newBufferedPipe(signatureBufferSize)
 
 	var dataReader io.Reader
 	if r.URL != "" {
-		//TODO: set timeout here, SSL settings?
-		resp, err := http.DefaultClient.Get(r.URL)
+		body, err := fetch.Get(ctx, r.URL)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		// read first 512 bytes to determine if content is gzip compressed
-		bufReader := bufio.NewReaderSize(resp.Body, 512)
-		ctBuf, err := bufReader.Peek(512)
-		if err != nil && err != bufio.ErrBufferFull && err != io.EOF {
-			return err
-		}
-
-		if "application/x+gzip" == http.DetectContentType(ctBuf) {
-			dataReader, _ = gzip.NewReader(io.MultiReader(bufReader, resp.Body))
-		} else {
-			dataReader = io.MultiReader(bufReader, resp.Body)
-		}
+		defer body.Close()
+		dataReader = body
 	} else {
 		dataReader = bytes.NewReader(r.Data)
 	}
 
+	hasher := sha256.New()
+	content, err := r.HashedContent(dataReader, hasher)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
 	g, ctx := errgroup.WithContext(ctx)
 
+	// the signature and public key are fetched while the content is downloaded and hashed
+	fetched := make(chan struct{})
 	g.Go(func() error {
-		defer hashW.Close()
-		defer sigW.Close()
-
-		/* #nosec G110 */
-		if _, err := io.Copy(io.MultiWriter(hashW, sigW), dataReader); err != nil {
+		if err := r.fetchSignatureAndKey(ctx); err != nil {
 			return err
 		}
+		close(fetched)
 		return nil
 	})
 
-	hashResult := make(chan string)
-
+	var computedSHA string
 	g.Go(func() error {
-		defer hashR.Close()
-		defer close(hashResult)
-
-		hasher := sha256.New()
-
-		if _, err := io.Copy(hasher, hashR); err != nil {
+		// the signature check sees the error that ended the copy, such as exceeding a decompression limit,
+		// and a check that stops early closes its side with its own error, which the copy then returns
+		_, err := io.Copy(sig, content)
+		sig.CloseWrite(err)
+		if err != nil {
 			return err
 		}
 
-		computedSHA := hex.EncodeToString(hasher.Sum(nil))
+		computedSHA = hex.EncodeToString(hasher.Sum(nil))
 		if r.SHA != "" && computedSHA != r.SHA {
 			return fmt.Errorf("SHA mismatch: %s != %s", computedSHA, r.SHA)
 		}
+		return nil
+	})
 
+	g.Go(func() error {
 		select {
 		case <-ctx.Done():
+			sig.CloseRead(ctx.Err())
 			return ctx.Err()
-		case hashResult <- computedSHA:
-			return nil
+		case <-fetched:
 		}
-	})
 
-	g.Go(func() error {
-		defer sigR.Close()
-
-		if err := r.sigObject.Verify(sigR, r.keyObject); err != nil {
+		err := r.sigObject.Verify(sig, r.keyObject)
+		if err == nil {
+			// the rest of the content is still hashed if the check did not read all of it
+			_, err = io.Copy(ioutil.Discard, sig)
+		}
+		sig.CloseRead(err)
+		if err != nil {
 			return err
 		}
 
@@ -205,8 +260,6 @@ func (r *RekorEntry) Load(ctx context.Context) error {
 		}
 	})
 
-	computedSHA := <-hashResult
-
 	if err := g.Wait(); err != nil {
 		return err
 	}
@@ -218,3 +271,29 @@ func (r *RekorEntry) Load(ctx context.Context) error {
 
 	return nil
 }
+
+// fetchSignatureAndKey retrieves the signature and public key of the entry that were given by URL
+func (r *RekorEntry) fetchSignatureAndKey(ctx context.Context) error {
+	var g errgroup.Group
+	if r.SignatureURL != "" {
+		g.Go(func() error {
+			sig, err := pki.FetchSignature(ctx, r.Format, r.SignatureURL)
+			if err != nil {
+				return err
+			}
+			r.sigObject = sig
+			return nil
+		})
+	}
+	if r.PublicKeyURL != "" {
+		g.Go(func() error {
+			key, err := pki.FetchPublicKey(ctx, r.Format, r.PublicKeyURL)
+			if err != nil {
+				return err
+			}
+			r.keyObject = key
+			return nil
+		})
+	}
+	return g.Wait()
+}
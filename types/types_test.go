@@ -0,0 +1,96 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestLoadFetchesInParallel(t *testing.T) {
+	// the test server is on a loopback address, which is only fetched from when allowed
+	viper.Set("fetch.allow_private_addresses", true)
+	defer viper.Set("fetch.allow_private_addresses", nil)
+
+	sig, err := ioutil.ReadFile("../pki/testdata/hello_world.txt.asc.sig")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ioutil.ReadFile("../pki/testdata/valid_armored_complex_public.pgp")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the artifact fills the content held for the signature check, and is larger than the socket buffers,
+	// so it is only sent in full if it is read while the key is fetched
+	artifact := bytes.Repeat([]byte("a"), signatureBufferSize)
+	sum := sha256.Sum256(artifact)
+	for i := 0; i < 10; i++ {
+		downloaded := make(chan struct{})
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/artifact":
+				_, _ = w.Write(artifact)
+				close(downloaded)
+			case "/key":
+				// the key is only served once the artifact has been downloaded
+				select {
+				case <-downloaded:
+					_, _ = w.Write(key)
+				case <-time.After(5 * time.Second):
+					w.WriteHeader(http.StatusServiceUnavailable)
+				}
+			}
+		}))
+
+		content, err := json.Marshal(map[string]interface{}{
+			"URL":          server.URL + "/artifact",
+			"SHA":          hex.EncodeToString(sum[:]),
+			"Signature":    sig,
+			"PublicKeyURL": server.URL + "/key",
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaf, err := ParseProposedLeaf(bytes.NewReader(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry, err := ParseRekorEntry(bytes.NewReader(content), leaf)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the key did not make the signature, which is reported rather than the pipe the check read from
+		err = entry.Load(context.Background())
+		server.Close()
+		if err == nil || strings.Contains(err.Error(), "503") || strings.Contains(err.Error(), "closed pipe") {
+			t.Fatalf("expected the signature check to fail, got %v", err)
+		}
+	}
+}
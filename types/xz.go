@@ -0,0 +1,277 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package types
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ulikunitz/xz"
+)
+
+// defaultMaxXZDictionary is the largest dictionary the xz presets use
+const defaultMaxXZDictionary = 64 << 20
+
+const lzma2FilterID = 0x21
+
+// newXZReader returns a reader of the decompressed content of the xz stream r. The xz reader allocates
+// the dictionary each block declares, up to 4GiB, before any content is decompressed, so each block
+// header is checked against maxDict before it is passed on.
+func newXZReader(r io.Reader, maxDict int64) (io.ReadCloser, error) {
+	pr, pw := io.Pipe()
+	go func() {
+		g := &xzGuard{r: r, w: pw, maxDict: maxDict}
+		_ = pw.CloseWithError(g.run())
+	}()
+
+	xr, err := xz.NewReader(pr)
+	if err != nil {
+		_ = pr.Close()
+		return nil, err
+	}
+	return &xzReader{Reader: xr, pr: pr}, nil
+}
+
+type xzReader struct {
+	io.Reader
+	pr *io.PipeReader
+}
+
+// Close stops the guard reading the compressed stream
+func (x *xzReader) Close() error {
+	return x.pr.Close()
+}
+
+// xzGuard copies an xz file from r to w, walking its structure to find each block header and
+// rejecting blocks with an LZMA2 dictionary larger than maxDict before they are written
+type xzGuard struct {
+	r       io.Reader
+	w       io.Writer
+	maxDict int64
+	// n counts the bytes passed on, to find the padding that aligns blocks and indexes
+	n int64
+}
+
+func (g *xzGuard) run() error {
+	streamMagic := []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	for first := true; ; first = false {
+		start := make([]byte, 4)
+		if _, err := io.ReadFull(g.r, start); err != nil {
+			if err == io.EOF && !first {
+				return nil
+			}
+			return err
+		}
+		if err := g.write(start); err != nil {
+			return err
+		}
+		// streams may be followed by padding in multiples of four zero bytes
+		if !first && bytes.Equal(start, make([]byte, 4)) {
+			continue
+		}
+
+		rest, err := g.pass(8)
+		if err != nil {
+			return err
+		}
+		if header := append(start, rest...); !bytes.Equal(header[:len(streamMagic)], streamMagic) {
+			return errors.New("xz: invalid stream header")
+		}
+		if err := g.stream(checkSize(rest[3] & 0x0f)); err != nil {
+			return err
+		}
+	}
+}
+
+// checkSize returns the size of the check of each block for a check type
+func checkSize(checkType byte) int64 {
+	if checkType == 0 {
+		return 0
+	}
+	return 4 << ((checkType - 1) / 3)
+}
+
+// stream passes on the blocks, index and footer of a stream
+func (g *xzGuard) stream(check int64) error {
+	for {
+		size := make([]byte, 1)
+		if _, err := io.ReadFull(g.r, size); err != nil {
+			return noEOF(err)
+		}
+		g.n = 0
+		if size[0] == 0 {
+			// an index indicator ends the blocks
+			if err := g.write(size); err != nil {
+				return err
+			}
+			return g.index()
+		}
+
+		header := make([]byte, (int(size[0])+1)*4)
+		header[0] = size[0]
+		if _, err := io.ReadFull(g.r, header[1:]); err != nil {
+			return noEOF(err)
+		}
+		if err := g.checkBlockHeader(header); err != nil {
+			return err
+		}
+		if err := g.write(header); err != nil {
+			return err
+		}
+
+		if err := g.lzma2(); err != nil {
+			return err
+		}
+		if _, err := g.pass((4-g.n%4)%4 + check); err != nil {
+			return err
+		}
+	}
+}
+
+// checkBlockHeader rejects a block header declaring an LZMA2 dictionary larger than maxDict
+func (g *xzGuard) checkBlockHeader(header []byte) error {
+	flags := header[1]
+	r := bytes.NewReader(header[2 : len(header)-4])
+	// the compressed and uncompressed sizes are optional
+	for _, present := range []bool{flags&0x40 != 0, flags&0x80 != 0} {
+		if !present {
+			continue
+		}
+		if _, err := binary.ReadUvarint(r); err != nil {
+			return errors.New("xz: invalid block header")
+		}
+	}
+
+	for i := 0; i < int(flags&0x03)+1; i++ {
+		id, err := binary.ReadUvarint(r)
+		if err != nil {
+			return errors.New("xz: invalid block header")
+		}
+		propsSize, err := binary.ReadUvarint(r)
+		if err != nil || propsSize > uint64(r.Len()) {
+			return errors.New("xz: invalid block header")
+		}
+		props := make([]byte, propsSize)
+		if _, err := io.ReadFull(r, props); err != nil {
+			return errors.New("xz: invalid block header")
+		}
+		if id != lzma2FilterID {
+			continue
+		}
+		if len(props) != 1 || props[0] > 40 {
+			return errors.New("xz: invalid LZMA2 filter properties")
+		}
+		dict := int64(0xffffffff)
+		if props[0] < 40 {
+			dict = int64(2|props[0]&1) << (props[0]/2 + 11)
+		}
+		if dict > g.maxDict {
+			return fmt.Errorf("xz dictionary of %d bytes is larger than %d bytes: %w", dict, g.maxDict, ErrDecompressionLimit)
+		}
+	}
+	return nil
+}
+
+// lzma2 passes on the chunks of LZMA2 data in a block, using the sizes in the chunk headers
+func (g *xzGuard) lzma2() error {
+	for {
+		control, err := g.ReadByte()
+		if err != nil {
+			return err
+		}
+		// sizeAt is the offset in the chunk header of the size, less one, of the data that follows it
+		var header, sizeAt int64
+		switch {
+		case control == 0x00:
+			return nil
+		case control == 0x01 || control == 0x02:
+			// an uncompressed chunk holds the size of its data
+			header, sizeAt = 2, 0
+		case control >= 0x80:
+			// an LZMA chunk holds its uncompressed and then compressed size, and properties if it resets
+			// the state
+			header, sizeAt = 4, 2
+			if (control>>5)&0x03 >= 2 {
+				header = 5
+			}
+		default:
+			return errors.New("xz: invalid LZMA2 chunk")
+		}
+		h, err := g.pass(header)
+		if err != nil {
+			return err
+		}
+		size := int64(h[sizeAt])<<8 | int64(h[sizeAt+1])
+		if _, err := g.pass(size + 1); err != nil {
+			return err
+		}
+	}
+}
+
+// index passes on the index that follows the blocks of a stream, and the stream footer
+func (g *xzGuard) index() error {
+	records, err := binary.ReadUvarint(g)
+	if err != nil {
+		return noEOF(err)
+	}
+	for i := uint64(0); i < records; i++ {
+		// each record holds the unpadded and uncompressed sizes of a block
+		for j := 0; j < 2; j++ {
+			if _, err := binary.ReadUvarint(g); err != nil {
+				return noEOF(err)
+			}
+		}
+	}
+	// the index is padded to a multiple of four bytes and followed by its CRC32 and the stream footer
+	_, err = g.pass((4-g.n%4)%4 + 4 + 12)
+	return err
+}
+
+// ReadByte passes on one byte, so that the guard can read varints as they are passed on
+func (g *xzGuard) ReadByte() (byte, error) {
+	b, err := g.pass(1)
+	if err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// pass reads n bytes and writes them on
+func (g *xzGuard) pass(n int64) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(g.r, b); err != nil {
+		return nil, noEOF(err)
+	}
+	return b, g.write(b)
+}
+
+func (g *xzGuard) write(b []byte) error {
+	n, err := g.w.Write(b)
+	g.n += int64(n)
+	return err
+}
+
+// noEOF reports the end of the file within a stream as unexpected
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
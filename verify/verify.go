@@ -0,0 +1,118 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package verify checks verification bundles returned by the log without contacting it
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+// Bundle checks that b proves its entry is included in the log whose checkpoints are signed by pub,
+// and returns the entry. pub must come from a trusted source; the key in the bundle is only compared
+// against it.
+func Bundle(b *models.Bundle, pub crypto.PublicKey) (*types.RekorLeaf, error) {
+	if pub == nil {
+		return nil, errors.New("a trusted log public key is required")
+	}
+	if len(b.PublicKey) != 0 {
+		if err := matchesKey(b.PublicKey, pub); err != nil {
+			return nil, err
+		}
+	}
+
+	var checkpoint types.SignedCheckpoint
+	if err := checkpoint.UnmarshalText([]byte(b.SignedCheckpoint)); err != nil {
+		return nil, fmt.Errorf("parsing checkpoint: %w", err)
+	}
+	if err := checkpoint.Verify(pub); err != nil {
+		return nil, err
+	}
+
+	proof := b.InclusionProof
+	if uint64(proof.TreeSize) != checkpoint.Size || !bytes.Equal(proof.RootHash, checkpoint.Hash) {
+		return nil, errors.New("inclusion proof is not for the tree in the checkpoint")
+	}
+
+	leafHash := rfc6962.DefaultHasher.HashLeaf(b.LeafValue)
+	if b.UUID != hex.EncodeToString(leafHash) {
+		return nil, fmt.Errorf("UUID %v does not match the leaf hash %x", b.UUID, leafHash)
+	}
+
+	v := merkle.NewLogVerifier(rfc6962.DefaultHasher)
+	if err := v.VerifyInclusionProof(b.LogIndex, proof.TreeSize, proof.Hashes, proof.RootHash, leafHash); err != nil {
+		return nil, fmt.Errorf("verifying inclusion proof: %w", err)
+	}
+
+	leaf, err := types.ParseRekorLeaf(bytes.NewReader(b.LeafValue))
+	if err != nil {
+		return nil, fmt.Errorf("parsing entry: %w", err)
+	}
+	return leaf, nil
+}
+
+// Artifact checks that the content read from artifact is what was signed in leaf. If the leaf was
+// logged with Decompress set, artifact is the compressed file that was submitted.
+func Artifact(leaf *types.RekorLeaf, artifact io.Reader) error {
+	// the artifact is hashed as the signature check reads its content, so it is never held in memory
+	hasher := sha256.New()
+	content, err := leaf.HashedContent(artifact, hasher)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+
+	verifyErr := leaf.SignatureObject().Verify(content, leaf.PublicKeyObject())
+	// a failed check may stop reading early; the rest is still hashed to report a mismatched artifact
+	if _, err := io.Copy(ioutil.Discard, content); err != nil {
+		return err
+	}
+
+	if sum := hex.EncodeToString(hasher.Sum(nil)); sum != leaf.SHA {
+		return fmt.Errorf("artifact SHA %v does not match the entry SHA %v", sum, leaf.SHA)
+	}
+	return verifyErr
+}
+
+// matchesKey checks that the PEM encoded key in the bundle is pub
+func matchesKey(bundleKey []byte, pub crypto.PublicKey) error {
+	block, _ := pem.Decode(bundleKey)
+	if block == nil {
+		return errors.New("bundle public key is not PEM encoded")
+	}
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(block.Bytes, der) {
+		return errors.New("bundle was produced by a log with a different public key")
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package verify
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/trillian/merkle"
+	"github.com/google/trillian/merkle/rfc6962"
+	"github.com/projectrekor/rekor-server/models"
+	"github.com/projectrekor/rekor-server/types"
+)
+
+func testLeafValue(t *testing.T) []byte {
+	t.Helper()
+
+	read := func(name string) []byte {
+		b, err := ioutil.ReadFile("../pki/testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	sum := sha256.Sum256(read("hello_world.txt"))
+	entry, err := json.Marshal(map[string]interface{}{
+		"SHA":       hex.EncodeToString(sum[:]),
+		"Signature": read("hello_world.txt.asc.sig"),
+		"PublicKey": read("valid_armored_public.pgp"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := types.ParseRekorLeaf(bytes.NewReader(entry))
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafValue, err := json.Marshal(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leafValue
+}
+
+// testBundle builds a bundle for an entry at index 2 of a log of 5 leaves
+func testBundle(t *testing.T, signer crypto.Signer) *models.Bundle {
+	t.Helper()
+
+	leafValue := testLeafValue(t)
+	tree := merkle.NewInMemoryMerkleTree(rfc6962.DefaultHasher)
+	for i := 0; i < 5; i++ {
+		value := []byte(fmt.Sprintf("leaf %d", i))
+		if i == 2 {
+			value = leafValue
+		}
+		tree.AddLeaf(value)
+	}
+
+	var hashes [][]byte
+	for _, node := range tree.PathToCurrentRoot(3) {
+		hashes = append(hashes, node.Value.Hash())
+	}
+	rootHash := tree.CurrentRoot().Hash()
+
+	checkpoint := types.SignedCheckpoint{
+		Checkpoint: types.Checkpoint{Origin: "rekor.test - 1", Size: 5, Hash: rootHash},
+	}
+	if err := checkpoint.Sign("rekor.test", signer); err != nil {
+		t.Fatal(err)
+	}
+	text, err := checkpoint.MarshalText()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &models.Bundle{
+		UUID:      hex.EncodeToString(tree.LeafHash(3)),
+		LogIndex:  2,
+		LeafValue: leafValue,
+		InclusionProof: models.InclusionProof{
+			TreeSize: 5,
+			RootHash: rootHash,
+			Hashes:   hashes,
+		},
+		SignedCheckpoint: string(text),
+		PublicKey:        pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+	}
+}
+
+func TestBundle(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherSigner, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	type TestCase struct {
+		caseDesc   string
+		modify     func(b *models.Bundle)
+		key        crypto.PublicKey
+		errorFound bool
+	}
+
+	testCases := []TestCase{
+		{caseDesc: "Valid bundle", modify: func(b *models.Bundle) {}, key: signer.Public(), errorFound: false},
+		{caseDesc: "Valid bundle without the log key", modify: func(b *models.Bundle) { b.PublicKey = nil }, key: signer.Public(), errorFound: false},
+		{caseDesc: "No trusted key", modify: func(b *models.Bundle) {}, key: nil, errorFound: true},
+		{caseDesc: "Checkpoint signed by another log", modify: func(b *models.Bundle) { b.PublicKey = nil }, key: otherSigner.Public(), errorFound: true},
+		{caseDesc: "Bundle key differs from trusted key", modify: func(b *models.Bundle) {}, key: otherSigner.Public(), errorFound: true},
+		{caseDesc: "Tampered inclusion proof", modify: func(b *models.Bundle) { b.InclusionProof.Hashes[0][0] ^= 1 }, key: signer.Public(), errorFound: true},
+		{caseDesc: "Wrong log index", modify: func(b *models.Bundle) { b.LogIndex = 3 }, key: signer.Public(), errorFound: true},
+		{caseDesc: "Proof for another tree", modify: func(b *models.Bundle) { b.InclusionProof.TreeSize = 4 }, key: signer.Public(), errorFound: true},
+		{caseDesc: "Tampered checkpoint", modify: func(b *models.Bundle) {
+			b.SignedCheckpoint = strings.Replace(b.SignedCheckpoint, "\n5\n", "\n6\n", 1)
+		}, key: signer.Public(), errorFound: true},
+		{caseDesc: "Tampered entry", modify: func(b *models.Bundle) {
+			b.LeafValue = bytes.Replace(b.LeafValue, []byte(`"SHA":"`), []byte(`"SHA":"0`), 1)
+		}, key: signer.Public(), errorFound: true},
+		{caseDesc: "UUID does not match entry", modify: func(b *models.Bundle) { b.UUID = strings.Repeat("0", 64) }, key: signer.Public(), errorFound: true},
+	}
+
+	for _, tc := range testCases {
+		b := testBundle(t, signer)
+		tc.modify(b)
+		leaf, err := Bundle(b, tc.key)
+		if (err != nil) != tc.errorFound {
+			t.Errorf("%v: unexpected result verifying bundle: %v", tc.caseDesc, err)
+		}
+		if err == nil && leaf.SHA == "" {
+			t.Errorf("%v: entry was not returned", tc.caseDesc)
+		}
+	}
+}
+
+func TestArtifact(t *testing.T) {
+	signer, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	leaf, err := Bundle(testBundle(t, signer), signer.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	artifact, err := os.Open("../pki/testdata/hello_world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer artifact.Close()
+
+	if err := Artifact(leaf, artifact); err != nil {
+		t.Errorf("unexpected error verifying artifact: %v", err)
+	}
+	if err := Artifact(leaf, strings.NewReader("not the artifact")); err == nil {
+		t.Errorf("expected an error verifying a different artifact")
+	}
+	errRead := errors.New("read failed")
+	if err := Artifact(leaf, io.MultiReader(strings.NewReader("Hello"), failingReader{errRead})); !errors.Is(err, errRead) {
+		t.Errorf("expected the error reading the artifact, got %v", err)
+	}
+
+	// an entry logged with Decompress set is checked against the compressed artifact that was submitted
+	var decompressed map[string]interface{}
+	if err := json.Unmarshal(testLeafValue(t), &decompressed); err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := ioutil.ReadFile("../types/testdata/hello_world.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedSum := sha256.Sum256(compressed)
+	decompressed["Decompress"] = true
+	decompressed["SHA"] = hex.EncodeToString(compressedSum[:])
+	b, _ := json.Marshal(decompressed)
+	compressedLeaf, err := types.ParseRekorLeaf(bytes.NewReader(b))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Artifact(compressedLeaf, bytes.NewReader(compressed)); err != nil {
+		t.Errorf("unexpected error verifying compressed artifact: %v", err)
+	}
+	if err := Artifact(leaf, bytes.NewReader(compressed)); err == nil {
+		t.Errorf("expected an error verifying a compressed artifact for an entry without Decompress")
+	}
+	plain, err := ioutil.ReadFile("../pki/testdata/hello_world.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Artifact(compressedLeaf, bytes.NewReader(plain)); err == nil {
+		t.Errorf("expected an error verifying an uncompressed artifact for an entry with Decompress")
+	}
+}
+
+// failingReader fails every read with err
+type failingReader struct {
+	err error
+}
+
+func (f failingReader) Read([]byte) (int, error) {
+	return 0, f.err
+}
@@ -0,0 +1,519 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package webhook delivers signed notifications of log entry events to HTTP endpoints. Events are
+// written to an outbox on disk before delivery is attempted, and are retried with backoff until they
+// are delivered, so that they survive restarts and endpoint outages.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/projectrekor/rekor-server/logging"
+	bolt "go.etcd.io/bbolt"
+)
+
+// Event types
+const (
+	// EntryQueued is sent when an entry has been accepted and queued for integration into the log
+	EntryQueued = "entry.queued"
+	// EntryIntegrated is sent when a queued entry has been integrated into the log
+	EntryIntegrated = "entry.integrated"
+)
+
+const (
+	// SignatureHeader holds "sha256=" followed by the hex encoded HMAC-SHA256 of the request body,
+	// keyed with the shared secret
+	SignatureHeader = "X-Rekor-Signature"
+	// EventHeader holds the type of the event
+	EventHeader = "X-Rekor-Event"
+	// DeliveryHeader holds the ID of the event, which is the same for every attempt to deliver it
+	DeliveryHeader = "X-Rekor-Delivery"
+)
+
+const (
+	defaultMaxAttempts = 10
+	defaultRetryWait   = time.Second
+	maxRetryWait       = time.Hour
+	defaultTimeout     = 10 * time.Second
+	defaultMaxOutbox   = 10000
+	defaultMaxPending  = 10000
+	defaultPendingAge  = 24 * time.Hour
+)
+
+var (
+	outboxBucket  = []byte("outbox")
+	pendingBucket = []byte("pending")
+)
+
+// Entry identifies the log entry an event is about
+type Entry struct {
+	UUID string
+	SHA  string
+	// Fingerprints are the fingerprints of the public key of the entry, if its format has them
+	Fingerprints []string `json:",omitempty"`
+}
+
+// Event is the JSON body POSTed to each webhook
+type Event struct {
+	ID   string
+	Type string
+	Time time.Time
+	Entry
+	// LogIndex and IntegratedTime are set on EntryIntegrated events
+	LogIndex       *int64 `json:",omitempty"`
+	IntegratedTime int64  `json:",omitempty"`
+}
+
+// pendingEntry is an entry waiting to be integrated, with when it was queued
+type pendingEntry struct {
+	Entry
+	Queued time.Time
+}
+
+// delivery is an event waiting in the outbox to be delivered to one URL
+type delivery struct {
+	URL         string
+	Type        string
+	ID          string
+	Body        []byte
+	Attempts    int
+	NextAttempt time.Time
+}
+
+// Config configures a Dispatcher
+type Config struct {
+	// URLs receive every event
+	URLs []string
+	// Secret keys the HMAC signature of each request body
+	Secret []byte
+	// OutboxPath is the bbolt database holding undelivered events and entries awaiting integration
+	OutboxPath string
+	// HTTPClient is used to deliver events; by default http.DefaultClient is used
+	HTTPClient *http.Client
+	// Timeout bounds each attempt to deliver an event; by default it is 10 seconds
+	Timeout time.Duration
+	// MaxAttempts is the number of times delivery of an event is attempted before it is dropped
+	MaxAttempts int
+	// RetryWait is the delay before the first retry; it doubles with each further attempt, up to an hour
+	RetryWait time.Duration
+	// MaxOutbox is the number of undelivered events kept in the outbox, counting one per URL; when it is
+	// full the oldest are dropped to make room. By default it is 10000.
+	MaxOutbox int
+	// MaxPending is the number of queued entries awaiting integration that are kept; beyond it the oldest
+	// are dropped. By default it is 10000.
+	MaxPending int
+	// MaxPendingAge is how long a queued entry is awaited before it is dropped, as it may never be
+	// integrated if it was lost from the log's queue or the log was replaced. By default it is a day.
+	MaxPendingAge time.Duration
+}
+
+// Dispatcher delivers events to the configured webhooks
+type Dispatcher struct {
+	cfg  Config
+	db   *bolt.DB
+	wake chan struct{}
+
+	// mu serializes changes to the outbox so that outboxSize stays its number of deliveries
+	mu         sync.Mutex
+	outboxSize int
+}
+
+// New opens the outbox at cfg.OutboxPath, which may hold events that were not delivered before a
+// restart; call Run to deliver them
+func New(cfg Config) (*Dispatcher, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("at least one webhook URL is required")
+	}
+	if len(cfg.Secret) == 0 {
+		return nil, errors.New("a webhook secret is required to sign events")
+	}
+	if cfg.OutboxPath == "" {
+		return nil, errors.New("a path is required for the webhook outbox")
+	}
+	for _, u := range cfg.URLs {
+		if !strings.HasPrefix(u, "http://") && !strings.HasPrefix(u, "https://") {
+			return nil, fmt.Errorf("unsupported webhook URL %q", u)
+		}
+	}
+	if cfg.HTTPClient == nil {
+		cfg.HTTPClient = http.DefaultClient
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = defaultMaxAttempts
+	}
+	if cfg.RetryWait <= 0 {
+		cfg.RetryWait = defaultRetryWait
+	}
+	if cfg.MaxOutbox < 1 {
+		cfg.MaxOutbox = defaultMaxOutbox
+	}
+	if cfg.MaxPending < 1 {
+		cfg.MaxPending = defaultMaxPending
+	}
+	if cfg.MaxPendingAge <= 0 {
+		cfg.MaxPendingAge = defaultPendingAge
+	}
+
+	db, err := bolt.Open(cfg.OutboxPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error opening webhook outbox at %v: %w", cfg.OutboxPath, err)
+	}
+	var outboxSize int
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{outboxBucket, pendingBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		outboxSize = tx.Bucket(outboxBucket).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Dispatcher{cfg: cfg, db: db, wake: make(chan struct{}, 1), outboxSize: outboxSize}, nil
+}
+
+// Close closes the outbox
+func (d *Dispatcher) Close() error {
+	return d.db.Close()
+}
+
+// Sign returns the value of SignatureHeader for body
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	_, _ = mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature reports whether signature, the value of SignatureHeader, is valid for body; receivers
+// of events should check it before trusting them
+func VerifySignature(secret, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Queued sends an EntryQueued event, and remembers the entry until Integrated is called for it
+func (d *Dispatcher) Queued(entry Entry) error {
+	return d.enqueue(Event{Type: EntryQueued, Entry: entry}, func(tx *bolt.Tx) error {
+		b, err := json.Marshal(pendingEntry{Entry: entry, Queued: time.Now().UTC()})
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(pendingBucket).Put([]byte(entry.UUID), b)
+	})
+}
+
+// Pending returns the entries passed to Queued that have not been passed to Integrated, oldest first.
+// Entries queued more than MaxPendingAge ago, and the oldest beyond MaxPending, are dropped.
+func (d *Dispatcher) Pending() ([]Entry, error) {
+	var pending, dropped []pendingEntry
+	err := d.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(pendingBucket)
+		err := bucket.ForEach(func(_, v []byte) error {
+			var p pendingEntry
+			if err := json.Unmarshal(v, &p); err != nil {
+				return err
+			}
+			pending = append(pending, p)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		sort.SliceStable(pending, func(i, j int) bool { return pending[i].Queued.Before(pending[j].Queued) })
+		expiry := time.Now().Add(-d.cfg.MaxPendingAge)
+		for len(pending) > 0 && (len(pending) > d.cfg.MaxPending || pending[0].Queued.Before(expiry)) {
+			if err := bucket.Delete([]byte(pending[0].UUID)); err != nil {
+				return err
+			}
+			dropped = append(dropped, pending[0])
+			pending = pending[1:]
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range dropped {
+		logging.Logger.Errorf("dropping pending webhook entry %v queued at %v without seeing it integrated", p.UUID, p.Queued)
+	}
+
+	entries := make([]Entry, 0, len(pending))
+	for _, p := range pending {
+		entries = append(entries, p.Entry)
+	}
+	return entries, nil
+}
+
+// Integrated sends an EntryIntegrated event for a pending entry
+func (d *Dispatcher) Integrated(entry Entry, logIndex, integratedTime int64) error {
+	event := Event{Type: EntryIntegrated, Entry: entry, LogIndex: &logIndex, IntegratedTime: integratedTime}
+	return d.enqueue(event, func(tx *bolt.Tx) error {
+		return tx.Bucket(pendingBucket).Delete([]byte(entry.UUID))
+	})
+}
+
+// enqueue writes a delivery of event to each URL to the outbox, in the same transaction as update. If
+// the outbox is full, the oldest deliveries are dropped to make room, so that endpoints that are down
+// for a long time cannot fill the disk.
+func (d *Dispatcher) enqueue(event Event, update func(tx *bolt.Tx) error) error {
+	event.ID = event.Type + "-" + event.UUID
+	event.Time = time.Now().UTC()
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var dropped []delivery
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(outboxBucket)
+		c := outbox.Cursor()
+		for k, v := c.First(); k != nil && d.outboxSize-len(dropped)+len(d.cfg.URLs) > d.cfg.MaxOutbox; k, v = c.First() {
+			var del delivery
+			if err := json.Unmarshal(v, &del); err != nil {
+				return err
+			}
+			if err := c.Delete(); err != nil {
+				return err
+			}
+			dropped = append(dropped, del)
+		}
+
+		for _, u := range d.cfg.URLs {
+			v, err := json.Marshal(delivery{URL: u, Type: event.Type, ID: event.ID, Body: body, NextAttempt: event.Time})
+			if err != nil {
+				return err
+			}
+			seq, err := outbox.NextSequence()
+			if err != nil {
+				return err
+			}
+			key := make([]byte, 8)
+			binary.BigEndian.PutUint64(key, seq)
+			if err := outbox.Put(key, v); err != nil {
+				return err
+			}
+		}
+		return update(tx)
+	})
+	if err != nil {
+		return err
+	}
+	d.outboxSize += len(d.cfg.URLs) - len(dropped)
+	for _, del := range dropped {
+		logging.Logger.Errorf("dropping webhook event %v to %v as the outbox is full", del.ID, del.URL)
+	}
+
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers events from the outbox until ctx is done
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		next, err := d.deliverDue(ctx)
+		if err != nil {
+			logging.Logger.Errorf("delivering webhook events: %v", err)
+		}
+
+		wait := maxRetryWait
+		if !next.IsZero() {
+			wait = time.Until(next)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-d.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// queued is a delivery read from the outbox, with its key
+type queued struct {
+	key []byte
+	delivery
+}
+
+// deliverDue attempts each delivery that is due, returning when the next remaining one is due. The URLs
+// are delivered to concurrently so that a slow endpoint does not hold up the others, and each is sent
+// its events in order: a delivery waiting to be retried holds back the later deliveries to its URL.
+func (d *Dispatcher) deliverDue(ctx context.Context) (time.Time, error) {
+	due := map[string][]queued{}
+	held := map[string]bool{}
+	var next time.Time
+	now := time.Now()
+
+	err := d.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(outboxBucket).ForEach(func(k, v []byte) error {
+			var q queued
+			if err := json.Unmarshal(v, &q.delivery); err != nil {
+				return err
+			}
+			if held[q.URL] {
+				return nil
+			}
+			if q.NextAttempt.After(now) {
+				held[q.URL] = true
+				if next.IsZero() || q.NextAttempt.Before(next) {
+					next = q.NextAttempt
+				}
+				return nil
+			}
+			q.key = append([]byte(nil), k...)
+			due[q.URL] = append(due[q.URL], q)
+			return nil
+		})
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	var deliverErr error
+	for _, deliveries := range due {
+		wg.Add(1)
+		go func(deliveries []queued) {
+			defer wg.Done()
+			for _, q := range deliveries {
+				if ctx.Err() != nil {
+					return
+				}
+				retry, attemptErr := d.attempt(ctx, q)
+
+				mu.Lock()
+				if !retry.IsZero() && (next.IsZero() || retry.Before(next)) {
+					next = retry
+				}
+				if attemptErr != nil && deliverErr == nil {
+					deliverErr = attemptErr
+				}
+				mu.Unlock()
+				if attemptErr != nil || !retry.IsZero() {
+					return
+				}
+			}
+		}(deliveries)
+	}
+	wg.Wait()
+	return next, deliverErr
+}
+
+// attempt delivers q once and records the outcome in the outbox, returning when it is next due if it
+// is to be retried
+func (d *Dispatcher) attempt(ctx context.Context, q queued) (time.Time, error) {
+	attemptCtx, cancel := context.WithTimeout(ctx, d.cfg.Timeout)
+	err := d.deliver(attemptCtx, &q.delivery)
+	cancel()
+	if ctx.Err() != nil {
+		// an attempt interrupted by shutdown is not counted
+		return time.Time{}, nil
+	}
+
+	q.Attempts++
+	done := err == nil || q.Attempts >= d.cfg.MaxAttempts
+	if !done {
+		wait := d.cfg.RetryWait << (q.Attempts - 1)
+		if wait > maxRetryWait || wait <= 0 {
+			wait = maxRetryWait
+		}
+		q.NextAttempt = time.Now().Add(wait)
+		logging.Logger.Warnf("delivering webhook event %v to %v (attempt %d): %v", q.ID, q.URL, q.Attempts, err)
+	} else if err != nil {
+		logging.Logger.Errorf("dropping webhook event %v to %v after %d attempts: %v", q.ID, q.URL, q.Attempts, err)
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	removed := false
+	err = d.db.Update(func(tx *bolt.Tx) error {
+		outbox := tx.Bucket(outboxBucket)
+		// the delivery may have been dropped to make room while it was attempted
+		if outbox.Get(q.key) == nil {
+			done = true
+			return nil
+		}
+		if done {
+			removed = true
+			return outbox.Delete(q.key)
+		}
+		v, err := json.Marshal(q.delivery)
+		if err != nil {
+			return err
+		}
+		return outbox.Put(q.key, v)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if removed {
+		d.outboxSize--
+	}
+	if done {
+		return time.Time{}, nil
+	}
+	return q.NextAttempt, nil
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, del *delivery) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, del.URL, bytes.NewReader(del.Body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(d.cfg.Secret, del.Body))
+	req.Header.Set(EventHeader, del.Type)
+	req.Header.Set(DeliveryHeader, del.ID)
+
+	resp, err := d.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook returned %v", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,362 @@
+/*
+Copyright © 2020 Bob Callaway <bcallawa@redhat.com>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("test secret")
+
+// receiver records the events POSTed to it, failing the first failures requests
+type receiver struct {
+	t *testing.T
+
+	mu       sync.Mutex
+	failures int
+	events   []Event
+	received chan struct{}
+}
+
+func newReceiver(t *testing.T, failures int) (*receiver, *httptest.Server) {
+	r := &receiver{t: t, failures: failures, received: make(chan struct{}, 100)}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures > 0 {
+		r.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		r.t.Error(err)
+	}
+	if !VerifySignature(testSecret, body, req.Header.Get(SignatureHeader)) {
+		r.t.Errorf("invalid signature %q", req.Header.Get(SignatureHeader))
+	}
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		r.t.Error(err)
+	}
+	if req.Header.Get(EventHeader) != event.Type || req.Header.Get(DeliveryHeader) != event.ID {
+		r.t.Errorf("headers do not match event %+v: %v", event, req.Header)
+	}
+	r.events = append(r.events, event)
+	r.received <- struct{}{}
+}
+
+func (r *receiver) wait(n int) []Event {
+	r.t.Helper()
+	for i := 0; i < n; i++ {
+		select {
+		case <-r.received:
+		case <-time.After(10 * time.Second):
+			r.t.Fatalf("timed out waiting for event %d", i+1)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+func testDispatcher(t *testing.T, path string, urls ...string) *Dispatcher {
+	t.Helper()
+	d, err := New(Config{URLs: urls, Secret: testSecret, OutboxPath: path, RetryWait: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestDispatcher(t *testing.T) {
+	recv, server := newReceiver(t, 2)
+	other, otherServer := newReceiver(t, 0)
+	d := testDispatcher(t, filepath.Join(t.TempDir(), "outbox.db"), server.URL, otherServer.URL)
+	defer d.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	entry := Entry{UUID: "abcd", SHA: "1234", Fingerprints: []string{"86f575529d0f9ff4"}}
+	if err := d.Queued(entry); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := d.Pending()
+	if err != nil || len(pending) != 1 || pending[0].UUID != entry.UUID {
+		t.Errorf("expected entry to be pending, got %v (%v)", pending, err)
+	}
+
+	if err := d.Integrated(entry, 7, 1600000000); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := d.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("expected no pending entries, got %v (%v)", pending, err)
+	}
+
+	for _, r := range []*receiver{recv, other} {
+		events := r.wait(2)
+		if len(events) != 2 || events[0].Type != EntryQueued || events[1].Type != EntryIntegrated {
+			t.Fatalf("expected queued then integrated events, got %+v", events)
+		}
+		if events[0].UUID != entry.UUID || events[0].SHA != entry.SHA || len(events[0].Fingerprints) != 1 {
+			t.Errorf("unexpected queued event %+v", events[0])
+		}
+		if events[1].LogIndex == nil || *events[1].LogIndex != 7 || events[1].IntegratedTime != 1600000000 {
+			t.Errorf("unexpected integrated event %+v", events[1])
+		}
+	}
+}
+
+func TestDispatcherOutbox(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	recv, server := newReceiver(t, 1)
+
+	// an event that could not be delivered before a restart is delivered after it
+	d := testDispatcher(t, path, server.URL)
+	if err := d.Queued(Entry{UUID: "abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	d = testDispatcher(t, path, server.URL)
+	defer d.Close()
+	if pending, err := d.Pending(); err != nil || len(pending) != 1 {
+		t.Errorf("expected the queued entry to still be pending, got %v (%v)", pending, err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	if events := recv.wait(1); events[0].Type != EntryQueued || events[0].UUID != "abcd" {
+		t.Errorf("unexpected event %+v", events[0])
+	}
+}
+
+func TestDispatcherMaxAttempts(t *testing.T) {
+	recv, server := newReceiver(t, 100)
+	d, err := New(Config{URLs: []string{server.URL}, Secret: testSecret, OutboxPath: filepath.Join(t.TempDir(), "outbox.db"), MaxAttempts: 2, RetryWait: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	if err := d.Queued(Entry{UUID: "abcd"}); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		time.Sleep(5 * time.Millisecond)
+		if _, err := d.deliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if next, err := d.deliverDue(context.Background()); err != nil || !next.IsZero() {
+		t.Errorf("expected the event to be dropped after the maximum attempts, next attempt at %v (%v)", next, err)
+	}
+	if recv.failures != 98 {
+		t.Errorf("expected 2 delivery attempts, got %d", 100-recv.failures)
+	}
+}
+
+func TestDispatcherOrder(t *testing.T) {
+	recv, server := newReceiver(t, 1)
+	d := testDispatcher(t, filepath.Join(t.TempDir(), "outbox.db"), server.URL)
+	defer d.Close()
+
+	entry := Entry{UUID: "abcd"}
+	if err := d.Queued(entry); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Integrated(entry, 7, 1600000000); err != nil {
+		t.Fatal(err)
+	}
+
+	// the integrated event waits behind the queued event while it is retried, even once it is due
+	for i := 0; i < 3; i++ {
+		if _, err := d.deliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	events := recv.wait(2)
+	if len(events) != 2 || events[0].Type != EntryQueued || events[1].Type != EntryIntegrated {
+		t.Errorf("expected queued then integrated events, got %+v", events)
+	}
+}
+
+func TestDispatcherSlowEndpoint(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	defer close(release)
+	recv, server := newReceiver(t, 0)
+
+	d, err := New(Config{URLs: []string{slow.URL, server.URL}, Secret: testSecret, OutboxPath: filepath.Join(t.TempDir(), "outbox.db"), Timeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for _, uuid := range []string{"abcd", "abce"} {
+		if err := d.Queued(Entry{UUID: uuid}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a slow endpoint does not hold up the others, and each attempt to reach it is cut off by the timeout
+	start := time.Now()
+	next, err := d.deliverDue(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("delivery took %v despite the timeout", elapsed)
+	}
+	if events := recv.wait(2); events[0].UUID != "abcd" || events[1].UUID != "abce" {
+		t.Errorf("unexpected events %+v", events)
+	}
+	if next.IsZero() {
+		t.Errorf("expected the events to the slow endpoint to be retried")
+	}
+}
+
+func TestDispatcherOutboxLimit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	recv, server := newReceiver(t, 0)
+	cfg := Config{URLs: []string{server.URL}, Secret: testSecret, OutboxPath: path, MaxOutbox: 3}
+
+	d, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 4; i++ {
+		if err := d.Queued(Entry{UUID: fmt.Sprintf("abc%d", i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the limit holds across restarts
+	d, err = New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if err := d.Queued(Entry{UUID: "abc4"}); err != nil {
+		t.Fatal(err)
+	}
+	if d.outboxSize != 3 {
+		t.Errorf("expected 3 events in the outbox, got %d", d.outboxSize)
+	}
+
+	if _, err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	events := recv.wait(3)
+	for i, event := range events {
+		if want := fmt.Sprintf("abc%d", i+2); event.UUID != want {
+			t.Errorf("expected the oldest events to be dropped, got event for %v in place of %v", event.UUID, want)
+		}
+	}
+	if d.outboxSize != 0 {
+		t.Errorf("expected an empty outbox after delivery, got %d events", d.outboxSize)
+	}
+}
+
+func TestDispatcherPendingLimits(t *testing.T) {
+	_, server := newReceiver(t, 0)
+	d, err := New(Config{URLs: []string{server.URL}, Secret: testSecret, OutboxPath: filepath.Join(t.TempDir(), "outbox.db"), MaxPending: 2, MaxPendingAge: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	for i := 0; i < 3; i++ {
+		if err := d.Queued(Entry{UUID: fmt.Sprintf("abc%d", 2-i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the oldest entries beyond the limit are dropped, whatever order their UUIDs sort in
+	pending, err := d.Pending()
+	if err != nil || len(pending) != 2 || pending[0].UUID != "abc1" || pending[1].UUID != "abc0" {
+		t.Errorf("expected the two newest entries to be pending, got %v (%v)", pending, err)
+	}
+
+	// entries that are not integrated in time are dropped
+	time.Sleep(150 * time.Millisecond)
+	if pending, err := d.Pending(); err != nil || len(pending) != 0 {
+		t.Errorf("expected expired entries to be dropped, got %v (%v)", pending, err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.db")
+	for _, cfg := range []Config{
+		{Secret: testSecret, OutboxPath: path},
+		{URLs: []string{"https://example.com"}, OutboxPath: path},
+		{URLs: []string{"https://example.com"}, Secret: testSecret},
+		{URLs: []string{"ftp://example.com"}, Secret: testSecret, OutboxPath: path},
+	} {
+		if d, err := New(cfg); err == nil {
+			d.Close()
+			t.Errorf("expected an error for config %+v", cfg)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"ID":"entry.queued-abcd"}`)
+	signature := Sign(testSecret, body)
+	if !VerifySignature(testSecret, body, signature) {
+		t.Errorf("signature did not verify")
+	}
+	if VerifySignature([]byte("other secret"), body, signature) {
+		t.Errorf("signature verified with the wrong secret")
+	}
+	if VerifySignature(testSecret, []byte(`{"ID":"entry.queued-abce"}`), signature) {
+		t.Errorf("signature verified for a different body")
+	}
+}